@@ -1,79 +1,234 @@
-// Generates default self-signed ssl x509 certificate
+// Generates x509 certificates for HTTPS and mTLS setups of the shortener.
+//
+// By default writes self-signed certificate.crt and certificate.key for localhost to the current directory.
+// With -ca writes local CA (ca.crt, ca.key), server certificate signed by it (certificate.crt, certificate.key)
+// and client certificate (client.crt, client.key). Subject of the client certificate becomes user id,
+// when the shortener verifies client certificates by ca.crt.
+//
+// Example:
+//
+//	cert-generate -ca -dns localhost,sho.rt -ip 127.0.0.1 -key ecdsa -days 90 -out ./cert
 package main
 
 import (
-	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
-	"io/ioutil"
+	"flag"
+	"fmt"
 	"log"
 	"math/big"
 	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+// options of the generated certificates
+type options struct {
+	dnsNames     []string
+	ips          []net.IP
+	keyType      string
+	rsaBits      int
+	validity     time.Duration
+	organization string
+	clientName   string
+	outDir       string
+}
+
 func main() {
-	var err error
-	cert := &x509.Certificate{
-		// указываем уникальный номер сертификата
-		SerialNumber: big.NewInt(1658),
-		// заполняем базовую информацию о владельце сертификата
-		Subject: pkix.Name{
-			Organization: []string{"Default certificate"},
-			Country:      []string{"RU"},
-		},
-		// разрешаем использование сертификата для 127.0.0.1 и ::1
-		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		// сертификат верен, начиная со времени создания
-		NotBefore: time.Now(),
-		// время жизни сертификата — 10 лет
-		NotAfter:     time.Now().AddDate(10, 0, 0),
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		// устанавливаем использование ключа для цифровой подписи, а также клиентской и серверной авторизации
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature,
+	dnsFlag := flag.String("dns", "localhost", "DNS имена сертификата сервера через запятую")
+	ipFlag := flag.String("ip", "127.0.0.1,::1", "IP адреса сертификата сервера через запятую")
+	keyFlag := flag.String("key", "rsa", "Тип ключа: rsa, ecdsa или ed25519")
+	rsaBitsFlag := flag.Int("rsa-bits", 4096, "Длина RSA ключа")
+	daysFlag := flag.Int("days", 3650, "Срок действия сертификатов в днях")
+	orgFlag := flag.String("org", "Default certificate", "Организация владельца сертификатов")
+	caFlag := flag.Bool("ca", false, "Создать локальный CA и подписанные им сертификаты сервера и клиента")
+	clientFlag := flag.String("client", "client", "Имя (CN) клиентского сертификата, становится идентификатором пользователя")
+	outFlag := flag.String("out", ".", "Директория для сертификатов и ключей")
+	flag.Parse()
+
+	opts := options{
+		dnsNames:     splitList(*dnsFlag),
+		keyType:      *keyFlag,
+		rsaBits:      *rsaBitsFlag,
+		validity:     time.Duration(*daysFlag) * 24 * time.Hour,
+		organization: *orgFlag,
+		clientName:   *clientFlag,
+		outDir:       *outFlag,
+	}
+	for _, value := range splitList(*ipFlag) {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			log.Fatalf("invalid IP address: %s", value)
+		}
+		opts.ips = append(opts.ips, ip)
+	}
+	if *daysFlag <= 0 {
+		log.Fatal("validity must be positive")
+	}
+	if err := os.MkdirAll(opts.outDir, 0755); err != nil {
+		log.Fatal(err)
 	}
 
-	// создаём новый приватный RSA-ключ длиной 4096 бит
-	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	var err error
+	if *caFlag {
+		err = generateWithCA(opts)
+	} else {
+		err = generateSelfSigned(opts)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	// создаём x.509-сертификат
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, &privateKey.PublicKey, privateKey)
+// generateSelfSigned writes self-signed certificate for server and client authentication
+func generateSelfSigned(opts options) error {
+	key, err := generateKey(opts)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	template, err := newTemplate(opts, "localhost")
+	if err != nil {
+		return err
 	}
+	template.DNSNames = opts.dnsNames
+	template.IPAddresses = opts.ips
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	_, err = issue(opts.outDir, "certificate", template, key, template, key)
+	return err
+}
 
-	// кодируем сертификат и ключ в формате PEM, который используется для хранения и обмена криптографическими ключами
-	var certPEM bytes.Buffer
-	err = pem.Encode(&certPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: certBytes,
-	})
+// generateWithCA writes local CA and server and client certificates signed by it
+func generateWithCA(opts options) error {
+	caKey, err := generateKey(opts)
+	if err != nil {
+		return err
+	}
+	ca, err := newTemplate(opts, opts.organization+" CA")
+	if err != nil {
+		return err
+	}
+	ca.IsCA = true
+	ca.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	// signed certificates get authority key id from the issued CA certificate
+	caCert, err := issue(opts.outDir, "ca", ca, caKey, ca, caKey)
 	if err != nil {
-		log.Fatalln("Error encoding certificate in PEM format", err)
+		return err
 	}
 
-	var privateKeyPEM bytes.Buffer
-	err = pem.Encode(&privateKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	})
+	serverKey, err := generateKey(opts)
 	if err != nil {
-		log.Fatalln("Error encoding certificate key in PEM format", err)
+		return err
+	}
+	server, err := newTemplate(opts, "localhost")
+	if err != nil {
+		return err
+	}
+	server.DNSNames = opts.dnsNames
+	server.IPAddresses = opts.ips
+	server.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	if len(opts.dnsNames) > 0 {
+		server.Subject.CommonName = opts.dnsNames[0]
+	}
+	if _, err = issue(opts.outDir, "certificate", server, serverKey, caCert, caKey); err != nil {
+		return err
 	}
 
-	err = ioutil.WriteFile("certificate.crt", certPEM.Bytes(), 0644)
+	clientKey, err := generateKey(opts)
+	if err != nil {
+		return err
+	}
+	client, err := newTemplate(opts, opts.clientName)
 	if err != nil {
-		log.Fatalln("Error writing certificate file", err)
+		return err
+	}
+	client.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	_, err = issue(opts.outDir, "client", client, clientKey, caCert, caKey)
+	return err
+}
+
+// generateKey creates private key of the type from options
+func generateKey(opts options) (crypto.Signer, error) {
+	switch opts.keyType {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, opts.rsaBits)
+	case "ecdsa":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unknown key type %q, expected rsa, ecdsa or ed25519", opts.keyType)
 	}
-	err = ioutil.WriteFile("certificate.key", privateKeyPEM.Bytes(), 0644)
+}
+
+// newTemplate creates certificate template with random serial number, valid from now
+func newTemplate(opts options, commonName string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	if err != nil {
-		log.Fatalln("Error writing certificate key file", err)
+		return nil, err
+	}
+	keyUsage := x509.KeyUsageDigitalSignature
+	if opts.keyType == "rsa" {
+		// RSA key exchange of TLS 1.2 encrypts secret by the key of the certificate
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{opts.organization},
+		},
+		NotBefore:             now,
+		NotAfter:              now.Add(opts.validity),
+		KeyUsage:              keyUsage,
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+// issue signs certificate by the parent and writes it with its key as <name>.crt and <name>.key
+func issue(
+	dir, name string,
+	template *x509.Certificate,
+	key crypto.Signer,
+	parent *x509.Certificate,
+	parentKey crypto.Signer,
+) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0644); err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
 	}
+	return result
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadCert(t *testing.T, dir, name string) *x509.Certificate {
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key"))
+	require.NoError(t, err, "key matches certificate")
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+	return cert
+}
+
+func testOptions(t *testing.T, keyType string) options {
+	return options{
+		dnsNames:     []string{"localhost", "sho.rt"},
+		ips:          []net.IP{net.IPv4(127, 0, 0, 1)},
+		keyType:      keyType,
+		rsaBits:      1024,
+		validity:     24 * time.Hour,
+		organization: "Test",
+		clientName:   "billing",
+		outDir:       t.TempDir(),
+	}
+}
+
+func TestGenerateWithCA(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ecdsa", "ed25519"} {
+		t.Run(keyType, func(t *testing.T) {
+			opts := testOptions(t, keyType)
+			require.NoError(t, generateWithCA(opts))
+
+			ca := loadCert(t, opts.outDir, "ca")
+			assert.True(t, ca.IsCA)
+			roots := x509.NewCertPool()
+			roots.AddCert(ca)
+
+			server := loadCert(t, opts.outDir, "certificate")
+			_, err := server.Verify(x509.VerifyOptions{DNSName: "sho.rt", Roots: roots})
+			assert.NoError(t, err)
+			assert.Equal(t, "127.0.0.1", server.IPAddresses[0].String())
+			assert.WithinDuration(t, time.Now().Add(opts.validity), server.NotAfter, time.Minute)
+
+			client := loadCert(t, opts.outDir, "client")
+			_, err = client.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+			assert.NoError(t, err)
+			assert.Equal(t, "billing", client.Subject.CommonName)
+			assert.NotEqual(t, server.SerialNumber, client.SerialNumber)
+
+			info, err := os.Stat(filepath.Join(opts.outDir, "client.key"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		})
+	}
+}
+
+func TestGenerateSelfSigned(t *testing.T) {
+	opts := testOptions(t, "ecdsa")
+	require.NoError(t, generateSelfSigned(opts))
+	cert := loadCert(t, opts.outDir, "certificate")
+	assert.NoError(t, cert.VerifyHostname("sho.rt"))
+	assert.NoError(t, cert.VerifyHostname("127.0.0.1"))
+
+	opts.keyType = "dsa"
+	assert.Error(t, generateSelfSigned(opts))
+}
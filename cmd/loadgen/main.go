@@ -0,0 +1,199 @@
+// Sends load to the shortener and reports latency percentiles and error rates of the requests.
+//
+// Without -target the shortener is run in-process, so CPU and heap profiles show the shortener itself.
+// Synthetic workload is a random mix of operations: create, batch, redirect, list and delete.
+// Replay log has one request per line:
+//
+//	{"method":"POST","path":"/api/shorten","content_type":"application/json","body":"{\"url\":\"https://example.com\"}"}
+//
+// Examples:
+//
+//	loadgen -n 100000 -c 16 -cpuprofile profiles/loadgen.pprof
+//	loadgen -target http://localhost:8080 -mix create=20,redirect=70,list=10 -rate 500 -duration 1m
+//	loadgen -target http://localhost:8080 -replay requests.log -loop -duration 30s
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/putalexey/go-practicum/internal/app/loadgen"
+	"github.com/putalexey/go-practicum/internal/app/shortener"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+// inProcessURL is base url of the in-process shortener
+const inProcessURL = "http://loadgen.local"
+
+func main() {
+	target := flag.String("target", "", "Адрес сервера, без него сервер запускается в том же процессе")
+	fileStoragePath := flag.String("f", "", "Путь до файла с сокращёнными URL сервера в том же процессе, по умолчанию хранилище в памяти")
+	replayFile := flag.String("replay", "", "Файл с запросами для воспроизведения, по одному JSON на строку")
+	loop := flag.Bool("loop", false, "Воспроизводить запросы по кругу")
+	mix := flag.String("mix", "create=20,batch=5,redirect=60,list=10,delete=5", "Доли операций синтетической нагрузки")
+	batchSize := flag.Int("batch", 10, "Количество URL в пакетном запросе")
+	concurrency := flag.Int("c", 8, "Количество одновременных пользователей")
+	rate := flag.Float64("rate", 0, "Ограничение количества запросов в секунду, 0 - без ограничения")
+	requests := flag.Int64("n", 0, "Количество запросов, 0 - без ограничения")
+	duration := flag.Duration("duration", 0, "Длительность нагрузки, 0 - без ограничения")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "Начальное значение генератора случайных операций")
+	cpuProfile := flag.String("cpuprofile", "", "Файл для профиля CPU во время нагрузки")
+	memProfile := flag.String("memprofile", "", "Файл для профиля памяти после нагрузки")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	cfg := loadgen.Config{
+		Target:      *target,
+		Concurrency: *concurrency,
+		Rate:        *rate,
+		Requests:    *requests,
+		Duration:    *duration,
+		Seed:        *seed,
+	}
+	if cfg.Requests == 0 && cfg.Duration == 0 && (*replayFile == "" || *loop) {
+		cfg.Duration = 10 * time.Second
+	}
+
+	var err error
+	if *replayFile != "" {
+		cfg.Workload, err = readReplay(*replayFile, *loop)
+	} else {
+		cfg.Workload, err = newSynthetic(*mix, *batchSize)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.Target == "" {
+		var store storage.Storager = storage.NewMemoryStorage(nil)
+		if *fileStoragePath != "" {
+			if store, err = storage.NewFileStorage(*fileStoragePath); err != nil {
+				log.Fatal(err)
+			}
+		}
+		// deletions are queued by the router and stored by its batch deleter, which stops with routerCtx
+		routerCtx, stopRouter := context.WithCancel(ctx)
+		router := shortener.NewRouter(routerCtx, inProcessURL, store, shortener.WithRequestLog(false))
+		deleterDone := make(chan struct{})
+		go func() {
+			defer close(deleterDone)
+			router.BatchDeleter.Start()
+		}()
+		defer func() {
+			stopRouter()
+			<-deleterDone
+		}()
+		cfg.Target = inProcessURL
+		cfg.Transport = loadgen.HandlerTransport{Handler: router}
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err = pprof.StartCPUProfile(f); err != nil {
+			log.Fatal(err)
+		}
+	}
+	report, err := loadgen.Run(ctx, cfg)
+	if *cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *memProfile != "" {
+		if err = writeHeapProfile(*memProfile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err = printReport(os.Stdout, report); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readReplay(path string, loop bool) (*loadgen.Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	replay, err := loadgen.ReadReplay(f)
+	if err != nil {
+		return nil, err
+	}
+	replay.Loop = loop
+	return replay, nil
+}
+
+func newSynthetic(mix string, batchSize int) (*loadgen.Synthetic, error) {
+	weights, err := loadgen.ParseMix(mix)
+	if err != nil {
+		return nil, err
+	}
+	return loadgen.NewSynthetic(weights, batchSize)
+}
+
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// profile shows memory in use after the run, not the garbage
+	runtime.GC()
+	return pprof.WriteHeapProfile(f)
+}
+
+func printReport(w io.Writer, report loadgen.Report) error {
+	fmt.Fprintf(w, "requests: %d, duration: %s, rps: %.1f, errors: %.2f%%\n\n",
+		report.Total.Count, report.Duration.Round(time.Millisecond), report.RPS(), report.Total.ErrorRate()*100)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OP\tCOUNT\tERRORS\tP50\tP90\tP99\tMAX\tSTATUSES\t")
+	for _, op := range append(report.Ops, report.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f%%\t%s\t%s\t%s\t%s\t%s\t\n", op.Op, op.Count, op.ErrorRate()*100,
+			round(op.P50), round(op.P90), round(op.P99), round(op.Max), statuses(op.Statuses))
+	}
+	return tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+// statuses formats counts of the statuses like "201:10 409:2", 0 is transport error
+func statuses(counts map[int]int) string {
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		name := strconv.Itoa(code)
+		if code == 0 {
+			name = "err"
+		}
+		parts = append(parts, name+":"+strconv.Itoa(counts[code]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -1,87 +1,239 @@
 package config
 
 import (
-	"encoding/json"
 	"flag"
+	"fmt"
 	"github.com/caarlos0/env/v6"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
+// EnvConfig is config of the service, grouped by sections. Fields tagged reload:"runtime" are applied on SIGHUP,
+// changes of other fields require restart
 type EnvConfig struct {
-	Address         string `env:"SERVER_ADDRESS" json:"server_address"`
-	BaseURL         string `env:"BASE_URL" json:"base_url"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH" json:"file_storage_path"`
-	DatabaseDSN     string `env:"DATABASE_DSN" json:"database_dsn"`
-	ProfileCPUFile  string `env:"PROFILE_CPU" json:"profile_cpu_file"`
-	EnableHTTPS     bool   `env:"ENABLE_HTTPS" json:"enable_https"`
-	CertFile        string `env:"CERT" json:"cert_file"`
-	CertKeyFile     string `env:"CERT_KEY" json:"cert_key_file"`
+	Server  ServerConfig  `json:"server"`
+	TLS     TLSConfig     `json:"tls"`
+	Storage StorageConfig `json:"storage"`
+	Auth    AuthConfig    `json:"auth"`
+	Limits  LimitsConfig  `json:"limits"`
+	Logging LoggingConfig `json:"logging"`
+}
+
+// ServerConfig is addresses of the servers and options of the redirects
+type ServerConfig struct {
+	Address string `env:"SERVER_ADDRESS" json:"address"`
+	BaseURL string `env:"BASE_URL" json:"base_url" reload:"runtime"`
+	// ShortDomains are hosts of the short urls besides the host of BaseURL, like go.example.com.
+	// Shorts are looked up in the domain of the Host header, create requests can choose one of the domains
+	ShortDomains []string `env:"SHORT_DOMAINS" json:"short_domains" reload:"runtime"`
+	// AlwaysInterstitial shows "you are leaving" page before every redirect
+	AlwaysInterstitial bool `env:"ALWAYS_INTERSTITIAL" json:"always_interstitial" reload:"runtime"`
+	// AdminAddress serves admin endpoints, must differ from Address. Empty disables admin server
+	AdminAddress string `env:"ADMIN_ADDRESS" json:"admin_address"`
+	// PprofAddress serves net/http/pprof endpoints without authentication, so only loopback addresses are allowed.
+	// Must differ from Address. Empty disables endpoints, admin server serves them with authentication
+	PprofAddress string `env:"PPROF_ADDRESS" json:"pprof_address"`
+	// UnixSocket is path of the unix domain socket, which is listened instead of Address
+	UnixSocket string `env:"UNIX_SOCKET" json:"unix_socket"`
+	// H2C serves HTTP/2 without TLS, for load balancers talking HTTP/2 to the plain HTTP server
+	H2C bool `env:"H2C" json:"h2c"`
+	// ProxyProtocol requires PROXY protocol header on every connection from ProxyTrustedNetworks and takes
+	// client address from it
+	ProxyProtocol bool `env:"PROXY_PROTOCOL" json:"proxy_protocol"`
+	// ProxyTrustedNetworks are addresses or CIDR networks of the balancers. Headers of other peers are ignored,
+	// so clients connecting directly can't set their address. Peers of the unix socket are trusted
+	ProxyTrustedNetworks []string `env:"PROXY_TRUSTED_NETWORKS" json:"proxy_trusted_networks"`
+	// ReadTimeout, ReadHeaderTimeout, WriteTimeout and IdleTimeout of the server, zero disables timeout.
+	// Write timeout limits streaming of the bulk import and export too
+	ReadTimeout       Duration `env:"READ_TIMEOUT" json:"read_timeout"`
+	ReadHeaderTimeout Duration `env:"READ_HEADER_TIMEOUT" json:"read_header_timeout"`
+	WriteTimeout      Duration `env:"WRITE_TIMEOUT" json:"write_timeout"`
+	IdleTimeout       Duration `env:"IDLE_TIMEOUT" json:"idle_timeout"`
+}
+
+// TLSConfig is certificates of the server and the admin server. Certificates are reloaded, when files change
+type TLSConfig struct {
+	Enabled  bool   `env:"ENABLE_HTTPS" json:"enabled"`
+	CertFile string `env:"CERT" json:"cert_file"`
+	KeyFile  string `env:"CERT_KEY" json:"key_file"`
+	// MinVersion is minimal TLS version of the server: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `env:"TLS_MIN_VERSION" json:"min_version"`
+	// CipherSuites are names of the allowed cipher suites of TLS 1.0-1.2, empty allows Go defaults
+	CipherSuites []string `env:"TLS_CIPHER_SUITES" json:"cipher_suites"`
+	// ClientCAFile verifies client certificates by the CA bundle, subject of the certificate becomes user id
+	ClientCAFile string `env:"TLS_CLIENT_CA" json:"client_ca_file"`
+	// AdminCertFile and AdminKeyFile enable HTTPS of the admin server
+	AdminCertFile string `env:"ADMIN_CERT" json:"admin_cert_file"`
+	AdminKeyFile  string `env:"ADMIN_CERT_KEY" json:"admin_key_file"`
+	// AdminClientCAFile allows admin requests with client certificates signed by the CA
+	AdminClientCAFile string `env:"ADMIN_CLIENT_CA" json:"admin_client_ca_file"`
+}
+
+// StorageConfig selects storage of the records, file storage wins over the database
+type StorageConfig struct {
+	FilePath    string `env:"FILE_STORAGE_PATH" json:"file_path"`
+	DatabaseDSN string `env:"DATABASE_DSN" json:"database_dsn"`
+	// DedupScope defines who gets old short for the already shortened url: global, user or none.
+	// Dedup keys of the database records are recomputed on start, when the scope changes
+	DedupScope string `env:"DEDUP_SCOPE" json:"dedup_scope"`
+	// StripTrackingParams ignores utm_* and click id params, when detecting already shortened urls
+	StripTrackingParams bool `env:"STRIP_TRACKING_PARAMS" json:"strip_tracking_params" reload:"runtime"`
+}
+
+// AuthConfig is credentials of the admin server
+type AuthConfig struct {
+	// AdminToken allows admin requests with "Authorization: Bearer <token>" header
+	AdminToken string `env:"ADMIN_TOKEN" json:"admin_token" reload:"runtime"`
+}
+
+// LimitsConfig is sizes of the buffers and requests
+type LimitsConfig struct {
+	// MaxHeaderBytes limits size of the request headers
+	MaxHeaderBytes int `env:"MAX_HEADER_BYTES" json:"max_header_bytes"`
+	// DeleteBatchSize is number of queued urls, which are deleted at once
+	DeleteBatchSize int `env:"DELETE_BATCH_SIZE" json:"delete_batch_size"`
+}
+
+// LoggingConfig is request log and profiles
+type LoggingConfig struct {
+	// RequestLog logs every request of the shortener
+	RequestLog     bool   `env:"REQUEST_LOG" json:"request_log" reload:"runtime"`
+	ProfileCPUFile string `env:"PROFILE_CPU" json:"profile_cpu_file"`
+	// ProfileHeapFile, ProfileMutexFile and ProfileBlockFile get profiles on exit
+	ProfileHeapFile  string `env:"PROFILE_HEAP" json:"profile_heap_file"`
+	ProfileMutexFile string `env:"PROFILE_MUTEX" json:"profile_mutex_file"`
+	ProfileBlockFile string `env:"PROFILE_BLOCK" json:"profile_block_file"`
+	// ProfileDumpDir gets heap, mutex, block and goroutine profiles on SIGUSR1
+	ProfileDumpDir string `env:"PROFILE_DUMP_DIR" json:"profile_dump_dir"`
 }
 
 type ConfigFile struct {
 	File string `env:"CONFIG"`
 }
 
-func Parse() EnvConfig {
-	var err error
-	cfg := EnvConfig{
-		Address:         ":8080",
-		BaseURL:         "http://localhost:8080",
-		FileStoragePath: "",
-		DatabaseDSN:     "",
-		EnableHTTPS:     false,
-		CertFile:        "./cert/certificate.crt",
-		CertKeyFile:     "./cert/certificate.key",
-	}
+// args are flags parsed by Parse, they are applied again by Reload
+var args map[string]string
 
-	argFlags := parseFlags()
-	configFile := os.Getenv("CONFIG")
-	if file, ok := argFlags["Config"]; ok {
-		configFile = file
+// Parse reads config from the file, environment and flags. Flags override environment,
+// which overrides the file. Invalid config stops the program.
+// With -print-config flag prints effective config and exits, with -check-config only validates config
+func Parse() EnvConfig {
+	args = parseFlags()
+	cfg, sources, err := load(args)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if configFile != "" {
-		err = parseConfigFile(&cfg, configFile)
-		if err != nil {
+	if _, ok := args["PrintConfig"]; ok {
+		if err = PrintConfig(os.Stdout, cfg, sources); err != nil {
 			log.Fatal(err)
 		}
+		os.Exit(0)
 	}
 
-	err = env.Parse(&cfg)
+	err = Validate(cfg)
+	if _, ok := args["CheckConfig"]; ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("config is valid")
+		os.Exit(0)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	applyArgsToConfig(&cfg, argFlags)
-
 	return cfg
 }
 
-func parseConfigFile(cfg *EnvConfig, configFile string) error {
-	f, err := os.Open(configFile)
+// Reload reads config file and environment again, applying flags parsed by Parse.
+// Returns error, if config can't be read or is invalid
+func Reload() (EnvConfig, error) {
+	cfg, _, err := load(args)
 	if err != nil {
-		return err
+		return cfg, err
 	}
+	return cfg, Validate(cfg)
+}
 
-	d := json.NewDecoder(f)
-	err = d.Decode(&cfg)
-	if err != nil {
-		return err
+// load reads config and sources of its values
+func load(argFlags map[string]string) (EnvConfig, Sources, error) {
+	cfg := EnvConfig{
+		Server: ServerConfig{
+			Address:           ":8080",
+			BaseURL:           "http://localhost:8080",
+			ReadHeaderTimeout: Duration(10 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+		},
+		TLS: TLSConfig{
+			CertFile:   "./cert/certificate.crt",
+			KeyFile:    "./cert/certificate.key",
+			MinVersion: "1.2",
+		},
+		Storage: StorageConfig{
+			DedupScope: "global",
+		},
+		Limits: LimitsConfig{
+			MaxHeaderBytes:  1 << 20,
+			DeleteBatchSize: 5,
+		},
+		Logging: LoggingConfig{
+			RequestLog: true,
+		},
 	}
+	sources := newSources()
 
-	return nil
+	configFile := os.Getenv("CONFIG")
+	if file, ok := argFlags["Config"]; ok {
+		configFile = file
+	}
+	if configFile != "" {
+		keys, err := parseConfigFile(&cfg, configFile)
+		if err != nil {
+			return cfg, sources, err
+		}
+		sources.setFile(keys)
+	}
+
+	if err := env.Parse(&cfg); err != nil {
+		return cfg, sources, err
+	}
+	sources.setEnv()
+
+	applyArgsToConfig(&cfg, argFlags)
+	sources.setFlags(argFlags)
+
+	return cfg, sources, nil
 }
 
 func parseFlags() map[string]string {
-	configFileFlag := flag.String("c", "", "Файл конфига в формате JSON")
+	configFileFlag := flag.String("c", "", "Файл конфига в формате JSON, YAML или TOML")
 	addressFlag := flag.String("a", "", "Адрес запуска HTTP-сервера")
 	baseURLFlag := flag.String("b", "", "Базовый адрес результирующего сокращённого URL")
+	shortDomainsFlag := flag.String("domains", "", "Дополнительные домены сокращённых URL через запятую")
 	fileStoragePathFlag := flag.String("f", "", "Путь до файла с сокращёнными URL")
 	databaseDSNFlag := flag.String("d", "", "Адрес подключения к БД")
 	profileCPUFlag := flag.String("pcpu", "", "Файл для полайлинга cpu")
+	profileHeapFlag := flag.String("pheap", "", "Файл для профиля памяти при завершении")
+	profileMutexFlag := flag.String("pmutex", "", "Файл для профиля блокировок мьютексов при завершении")
+	profileBlockFlag := flag.String("pblock", "", "Файл для профиля блокировок горутин при завершении")
+	profileDumpDirFlag := flag.String("pdump", "", "Директория для профилей по сигналу SIGUSR1")
+	pprofAddressFlag := flag.String("pprof", "", "Адрес HTTP-сервера с эндпоинтами pprof на loopback-интерфейсе, отдельный от основного")
 	enableHTTPSFlag := flag.Bool("s", false, "Включить HTTPS")
 	certFile := flag.String("crypto-key", "", "Путь к файлу сертификата")
 	certKeyFile := flag.String("k", "", "Путь к ключу сертификата")
+	clientCAFileFlag := flag.String("client-ca", "", "Путь к сертификату CA для проверки клиентских сертификатов")
+	alwaysInterstitialFlag := flag.Bool("interstitial", false, "Показывать страницу-предупреждение перед каждым переходом")
+	stripTrackingParamsFlag := flag.Bool("strip-tracking", false, "Игнорировать utm-метки и идентификаторы кликов при поиске уже сокращённых URL")
+	dedupScopeFlag := flag.String("dedup", "", "Область поиска уже сокращённых URL: global, user или none")
+	adminAddressFlag := flag.String("admin", "", "Адрес запуска административного HTTP-сервера")
+	adminTokenFlag := flag.String("admin-token", "", "Токен доступа к административному серверу")
+	adminCertFileFlag := flag.String("admin-cert", "", "Путь к файлу сертификата административного сервера")
+	adminCertKeyFileFlag := flag.String("admin-key", "", "Путь к ключу сертификата административного сервера")
+	adminClientCAFileFlag := flag.String("admin-ca", "", "Путь к сертификату CA клиентских сертификатов административного сервера")
+	printConfigFlag := flag.Bool("print-config", false, "Вывести итоговый конфиг с источниками значений и выйти")
+	checkConfigFlag := flag.Bool("check-config", false, "Проверить конфиг и выйти")
 	flag.Parse()
 
 	cfg := make(map[string]string)
@@ -89,55 +241,151 @@ func parseFlags() map[string]string {
 		cfg["Config"] = *configFileFlag
 	}
 	if *addressFlag != "" {
-		cfg["Address"] = *addressFlag
+		cfg["server.address"] = *addressFlag
 	}
 	if *baseURLFlag != "" {
-		cfg["BaseURL"] = *baseURLFlag
+		cfg["server.base_url"] = *baseURLFlag
+	}
+	if *shortDomainsFlag != "" {
+		cfg["server.short_domains"] = *shortDomainsFlag
 	}
 	if *fileStoragePathFlag != "" {
-		cfg["FileStoragePath"] = *fileStoragePathFlag
+		cfg["storage.file_path"] = *fileStoragePathFlag
 	}
 	if *databaseDSNFlag != "" {
-		cfg["DatabaseDSN"] = *databaseDSNFlag
+		cfg["storage.database_dsn"] = *databaseDSNFlag
 	}
 	if *profileCPUFlag != "" {
-		cfg["ProfileCPUFile"] = *profileCPUFlag
+		cfg["logging.profile_cpu_file"] = *profileCPUFlag
+	}
+	if *profileHeapFlag != "" {
+		cfg["logging.profile_heap_file"] = *profileHeapFlag
+	}
+	if *profileMutexFlag != "" {
+		cfg["logging.profile_mutex_file"] = *profileMutexFlag
+	}
+	if *profileBlockFlag != "" {
+		cfg["logging.profile_block_file"] = *profileBlockFlag
+	}
+	if *profileDumpDirFlag != "" {
+		cfg["logging.profile_dump_dir"] = *profileDumpDirFlag
+	}
+	if *pprofAddressFlag != "" {
+		cfg["server.pprof_address"] = *pprofAddressFlag
 	}
 	if *enableHTTPSFlag {
-		cfg["EnableHTTPS"] = "on"
+		cfg["tls.enabled"] = "on"
 	}
 	if *certFile != "" {
-		cfg["CertFile"] = *certFile
+		cfg["tls.cert_file"] = *certFile
 	}
 	if *certKeyFile != "" {
-		cfg["CertKeyFile"] = *certKeyFile
+		cfg["tls.key_file"] = *certKeyFile
+	}
+	if *clientCAFileFlag != "" {
+		cfg["tls.client_ca_file"] = *clientCAFileFlag
+	}
+	if *alwaysInterstitialFlag {
+		cfg["server.always_interstitial"] = "on"
+	}
+	if *stripTrackingParamsFlag {
+		cfg["storage.strip_tracking_params"] = "on"
+	}
+	if *dedupScopeFlag != "" {
+		cfg["storage.dedup_scope"] = *dedupScopeFlag
+	}
+	if *adminAddressFlag != "" {
+		cfg["server.admin_address"] = *adminAddressFlag
+	}
+	if *adminTokenFlag != "" {
+		cfg["auth.admin_token"] = *adminTokenFlag
+	}
+	if *adminCertFileFlag != "" {
+		cfg["tls.admin_cert_file"] = *adminCertFileFlag
+	}
+	if *adminCertKeyFileFlag != "" {
+		cfg["tls.admin_key_file"] = *adminCertKeyFileFlag
+	}
+	if *adminClientCAFileFlag != "" {
+		cfg["tls.admin_client_ca_file"] = *adminClientCAFileFlag
+	}
+	if *printConfigFlag {
+		cfg["PrintConfig"] = "on"
+	}
+	if *checkConfigFlag {
+		cfg["CheckConfig"] = "on"
 	}
 	return cfg
 }
 
 func applyArgsToConfig(config *EnvConfig, args map[string]string) {
-	if value, ok := args["Address"]; ok {
-		config.Address = value
+	if value, ok := args["server.address"]; ok {
+		config.Server.Address = value
+	}
+	if value, ok := args["server.base_url"]; ok {
+		config.Server.BaseURL = value
+	}
+	if value, ok := args["server.short_domains"]; ok {
+		config.Server.ShortDomains = strings.Split(value, ",")
+	}
+	if value, ok := args["storage.file_path"]; ok {
+		config.Storage.FilePath = value
+	}
+	if value, ok := args["storage.database_dsn"]; ok {
+		config.Storage.DatabaseDSN = value
+	}
+	if value, ok := args["logging.profile_cpu_file"]; ok {
+		config.Logging.ProfileCPUFile = value
+	}
+	if value, ok := args["logging.profile_heap_file"]; ok {
+		config.Logging.ProfileHeapFile = value
+	}
+	if value, ok := args["logging.profile_mutex_file"]; ok {
+		config.Logging.ProfileMutexFile = value
+	}
+	if value, ok := args["logging.profile_block_file"]; ok {
+		config.Logging.ProfileBlockFile = value
+	}
+	if value, ok := args["logging.profile_dump_dir"]; ok {
+		config.Logging.ProfileDumpDir = value
+	}
+	if value, ok := args["server.pprof_address"]; ok {
+		config.Server.PprofAddress = value
+	}
+	if value, ok := args["tls.enabled"]; ok {
+		config.TLS.Enabled = value == "on"
+	}
+	if value, ok := args["tls.cert_file"]; ok {
+		config.TLS.CertFile = value
+	}
+	if value, ok := args["tls.key_file"]; ok {
+		config.TLS.KeyFile = value
+	}
+	if value, ok := args["tls.client_ca_file"]; ok {
+		config.TLS.ClientCAFile = value
+	}
+	if value, ok := args["server.always_interstitial"]; ok {
+		config.Server.AlwaysInterstitial = value == "on"
 	}
-	if value, ok := args["BaseURL"]; ok {
-		config.BaseURL = value
+	if value, ok := args["storage.strip_tracking_params"]; ok {
+		config.Storage.StripTrackingParams = value == "on"
 	}
-	if value, ok := args["FileStoragePath"]; ok {
-		config.FileStoragePath = value
+	if value, ok := args["storage.dedup_scope"]; ok {
+		config.Storage.DedupScope = value
 	}
-	if value, ok := args["DatabaseDSN"]; ok {
-		config.DatabaseDSN = value
+	if value, ok := args["server.admin_address"]; ok {
+		config.Server.AdminAddress = value
 	}
-	if value, ok := args["ProfileCPUFile"]; ok {
-		config.ProfileCPUFile = value
+	if value, ok := args["auth.admin_token"]; ok {
+		config.Auth.AdminToken = value
 	}
-	if value, ok := args["EnableHTTPS"]; ok {
-		config.EnableHTTPS = value == "on"
+	if value, ok := args["tls.admin_cert_file"]; ok {
+		config.TLS.AdminCertFile = value
 	}
-	if value, ok := args["CertFile"]; ok {
-		config.CertFile = value
+	if value, ok := args["tls.admin_key_file"]; ok {
+		config.TLS.AdminKeyFile = value
 	}
-	if value, ok := args["CertKeyFile"]; ok {
-		config.CertKeyFile = value
+	if value, ok := args["tls.admin_client_ca_file"]; ok {
+		config.TLS.AdminClientCAFile = value
 	}
 }
@@ -0,0 +1,25 @@
+package config
+
+import "time"
+
+// Duration is time.Duration written as "30s" or "1m30s" in config files and environment
+type Duration time.Duration
+
+// UnmarshalText parses duration by time.ParseDuration
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText writes duration as time.Duration.String
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
@@ -0,0 +1,28 @@
+package config
+
+import "reflect"
+
+// field of the config section with its dot separated path of json names, like "server.address"
+type field struct {
+	path  string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+// fields returns fields of the config sections in order of declaration
+func fields(v reflect.Value) []field {
+	return appendFields(nil, v, "")
+}
+
+func appendFields(result []field, v reflect.Value, prefix string) []field {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		path := prefix + t.Field(i).Tag.Get("json")
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			result = appendFields(result, v.Field(i), path+".")
+			continue
+		}
+		result = append(result, field{path: path, tag: t.Field(i).Tag, value: v.Field(i)})
+	}
+	return result
+}
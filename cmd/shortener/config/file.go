@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// legacyKeys maps keys of the flat JSON config to the fields of the sections
+var legacyKeys = map[string]string{
+	"server_address":        "server.address",
+	"base_url":              "server.base_url",
+	"always_interstitial":   "server.always_interstitial",
+	"admin_address":         "server.admin_address",
+	"pprof_address":         "server.pprof_address",
+	"enable_https":          "tls.enabled",
+	"cert_file":             "tls.cert_file",
+	"cert_key_file":         "tls.key_file",
+	"admin_cert_file":       "tls.admin_cert_file",
+	"admin_cert_key_file":   "tls.admin_key_file",
+	"admin_client_ca_file":  "tls.admin_client_ca_file",
+	"file_storage_path":     "storage.file_path",
+	"database_dsn":          "storage.database_dsn",
+	"dedup_scope":           "storage.dedup_scope",
+	"strip_tracking_params": "storage.strip_tracking_params",
+	"admin_token":           "auth.admin_token",
+	"profile_cpu_file":      "logging.profile_cpu_file",
+	"profile_heap_file":     "logging.profile_heap_file",
+	"profile_mutex_file":    "logging.profile_mutex_file",
+	"profile_block_file":    "logging.profile_block_file",
+	"profile_dump_dir":      "logging.profile_dump_dir",
+}
+
+// parseConfigFile reads config from the file and returns paths of the fields set in the file.
+// Format is detected by extension: .yaml, .yml, .toml, JSON otherwise.
+// Keys of the flat JSON config are accepted in all formats
+func parseConfigFile(cfg *EnvConfig, configFile string) ([]string, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		err = json.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+
+	for key, path := range legacyKeys {
+		if value, ok := values[key]; ok {
+			delete(values, key)
+			setPath(values, strings.Split(path, "."), value)
+		}
+	}
+
+	// sections are decoded by json tags, so all formats share them
+	data, err = json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+
+	paths := leafPaths(values, "")
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// setPath sets value to the nested maps by keys, creating missing maps
+func setPath(values map[string]interface{}, keys []string, value interface{}) {
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := values[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			values[key] = next
+		}
+		values = next
+	}
+	values[keys[len(keys)-1]] = value
+}
+
+// leafPaths returns dot separated paths of the values, which are not maps
+func leafPaths(values map[string]interface{}, prefix string) []string {
+	paths := make([]string, 0, len(values))
+	for key, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok {
+			paths = append(paths, leafPaths(nested, prefix+key+".")...)
+			continue
+		}
+		paths = append(paths, prefix+key)
+	}
+	return paths
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "json",
+			file:    "config.json",
+			content: `{"server": {"address": ":9090", "base_url": "https://sho.rt", "read_timeout": "30s"}, "tls": {"enabled": true}, "limits": {"delete_batch_size": 10}}`,
+		},
+		{
+			name:    "flat json",
+			file:    "config.json",
+			content: `{"server_address": ":9090", "base_url": "https://sho.rt", "enable_https": true, "server": {"read_timeout": "30s"}, "limits": {"delete_batch_size": 10}}`,
+		},
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `
+server:
+  address: ":9090"
+  base_url: https://sho.rt
+  read_timeout: 30s
+tls:
+  enabled: true
+limits:
+  delete_batch_size: 10
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			content: `
+[server]
+address = ":9090"
+base_url = "https://sho.rt"
+read_timeout = "30s"
+
+[tls]
+enabled = true
+
+[limits]
+delete_batch_size = 10
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(file, []byte(tt.content), 0600))
+
+			cfg := EnvConfig{Storage: StorageConfig{DedupScope: "global"}}
+			paths, err := parseConfigFile(&cfg, file)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"limits.delete_batch_size", "server.address", "server.base_url", "server.read_timeout", "tls.enabled"}, paths)
+			assert.Equal(t, Duration(30*time.Second), cfg.Server.ReadTimeout)
+			assert.Equal(t, ":9090", cfg.Server.Address)
+			assert.Equal(t, "https://sho.rt", cfg.Server.BaseURL)
+			assert.True(t, cfg.TLS.Enabled)
+			assert.Equal(t, 10, cfg.Limits.DeleteBatchSize)
+			assert.Equal(t, "global", cfg.Storage.DedupScope, "fields missing in the file are kept")
+		})
+	}
+
+	t.Run("invalid file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("server: [\n"), 0600))
+		_, err := parseConfigFile(&EnvConfig{}, file)
+		assert.Error(t, err)
+
+		require.NoError(t, os.WriteFile(file, []byte("server:\n  read_timeout: soon\n"), 0600))
+		_, err = parseConfigFile(&EnvConfig{}, file)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+[server]
+address = ":7070"
+base_url = "https://file.example"
+admin_address = ":7071"
+
+[storage]
+dedup_scope = "user"
+`), 0600))
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args map[string]string
+		// want is server address, base url and admin address
+		want [3]string
+	}{
+		{
+			name: "file overrides defaults",
+			want: [3]string{":7070", "https://file.example", ":7071"},
+		},
+		{
+			name: "env overrides file",
+			env:  map[string]string{"SERVER_ADDRESS": ":8080", "BASE_URL": "https://env.example"},
+			want: [3]string{":8080", "https://env.example", ":7071"},
+		},
+		{
+			name: "flags override env",
+			env:  map[string]string{"SERVER_ADDRESS": ":8080", "BASE_URL": "https://env.example"},
+			args: map[string]string{"Config": file, "server.address": ":9090"},
+			want: [3]string{":9090", "https://env.example", ":7071"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG", file)
+			for _, name := range []string{"SERVER_ADDRESS", "BASE_URL", "ADMIN_ADDRESS"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			cfg, _, err := load(tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, [3]string{cfg.Server.Address, cfg.Server.BaseURL, cfg.Server.AdminAddress})
+			assert.Equal(t, "user", cfg.Storage.DedupScope)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+)
+
+const redacted = "REDACTED"
+
+var dsnPasswordPattern = regexp.MustCompile(`password=\S*`)
+
+// Redacted returns config without secrets for the config dumps
+func Redacted(cfg EnvConfig) EnvConfig {
+	if cfg.Auth.AdminToken != "" {
+		cfg.Auth.AdminToken = redacted
+	}
+	cfg.Storage.DatabaseDSN = redactDSN(cfg.Storage.DatabaseDSN)
+	return cfg
+}
+
+// redactDSN hides password of the url or key=value DSN
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			return u.String()
+		}
+		return dsn
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "password="+redacted)
+}
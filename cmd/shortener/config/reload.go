@@ -0,0 +1,31 @@
+package config
+
+import "reflect"
+
+// Diff returns paths of the fields changed in next config. Changes of runtime fields
+// can be applied by Merge, restart fields require restart of the service
+func Diff(current, next EnvConfig) (runtime []string, restart []string) {
+	currentFields, nextFields := fields(reflect.ValueOf(current)), fields(reflect.ValueOf(next))
+	for i, f := range currentFields {
+		if reflect.DeepEqual(f.value.Interface(), nextFields[i].value.Interface()) {
+			continue
+		}
+		if f.tag.Get("reload") == "runtime" {
+			runtime = append(runtime, f.path)
+		} else {
+			restart = append(restart, f.path)
+		}
+	}
+	return runtime, restart
+}
+
+// Merge returns current config with runtime fields taken from the next config
+func Merge(current, next EnvConfig) EnvConfig {
+	currentFields, nextFields := fields(reflect.ValueOf(&current).Elem()), fields(reflect.ValueOf(next))
+	for i, f := range currentFields {
+		if f.tag.Get("reload") == "runtime" {
+			f.value.Set(nextFields[i].value)
+		}
+	}
+	return current
+}
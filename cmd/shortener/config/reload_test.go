@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffAndMerge(t *testing.T) {
+	current := EnvConfig{
+		Server: ServerConfig{Address: ":8080", BaseURL: "http://localhost:8080"},
+		Auth:   AuthConfig{AdminToken: "old"},
+	}
+	next := EnvConfig{
+		Server: ServerConfig{Address: ":8081", BaseURL: "https://sho.rt", AlwaysInterstitial: true},
+		Auth:   AuthConfig{AdminToken: "new"},
+	}
+
+	runtime, restart := Diff(current, next)
+	assert.Equal(t, []string{"server.base_url", "server.always_interstitial", "auth.admin_token"}, runtime)
+	assert.Equal(t, []string{"server.address"}, restart)
+
+	merged := Merge(current, next)
+	assert.Equal(t, ":8080", merged.Server.Address)
+	assert.Equal(t, "https://sho.rt", merged.Server.BaseURL)
+	assert.Equal(t, "new", merged.Auth.AdminToken)
+	assert.True(t, merged.Server.AlwaysInterstitial)
+
+	runtime, restart = Diff(merged, merged)
+	assert.Empty(t, runtime)
+	assert.Empty(t, restart)
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("CONFIG", file)
+	t.Setenv("BASE_URL", "")
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"server": {"base_url": "https://sho.rt"}, "storage": {"dedup_scope": "user"}}`), 0600))
+	cfg, err := Reload()
+	require.NoError(t, err)
+	assert.Equal(t, "https://sho.rt", cfg.Server.BaseURL)
+	assert.Equal(t, "user", cfg.Storage.DedupScope)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"server": {"base_url": "sho.rt"}}`), 0600))
+	_, err = Reload()
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"base_url": `), 0600))
+	_, err = Reload()
+	assert.Error(t, err)
+}
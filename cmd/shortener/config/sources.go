@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"text/tabwriter"
+)
+
+// Source is where the value of the config field comes from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Sources maps paths of the config fields to sources of their values
+type Sources map[string]Source
+
+func newSources() Sources {
+	sources := make(Sources)
+	for _, f := range fields(reflect.ValueOf(EnvConfig{})) {
+		sources[f.path] = SourceDefault
+	}
+	return sources
+}
+
+func (s Sources) setFile(paths []string) {
+	for _, path := range paths {
+		if _, ok := s[path]; ok {
+			s[path] = SourceFile
+		}
+	}
+}
+
+// setEnv marks fields with non-empty environment variables, empty variables are ignored by env.Parse
+func (s Sources) setEnv() {
+	for _, f := range fields(reflect.ValueOf(EnvConfig{})) {
+		if value, ok := os.LookupEnv(f.tag.Get("env")); ok && value != "" {
+			s[f.path] = SourceEnv
+		}
+	}
+}
+
+// setFlags marks fields set by flags, args are keyed by paths of the fields
+func (s Sources) setFlags(args map[string]string) {
+	for path := range args {
+		if _, ok := s[path]; ok {
+			s[path] = SourceFlag
+		}
+	}
+}
+
+// PrintConfig writes effective config with redacted secrets and sources of the values
+func PrintConfig(w io.Writer, cfg EnvConfig, sources Sources) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tVALUE\tSOURCE")
+	for _, f := range fields(reflect.ValueOf(Redacted(cfg))) {
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", f.path, f.value.Interface(), sources[f.path])
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/putalexey/go-practicum/internal/app/certmanager"
+	"github.com/putalexey/go-practicum/internal/app/domains"
+	"github.com/putalexey/go-practicum/internal/app/proxyproto"
+)
+
+// ValidationErrors lists all problems found in the config
+type ValidationErrors []string
+
+func (e ValidationErrors) Error() string {
+	return "invalid config:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// isLoopback reports whether the address listens only on the loopback interface
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Validate checks the whole config and returns ValidationErrors with every problem found
+func Validate(cfg EnvConfig) error {
+	var errs ValidationErrors
+	addf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	requireFile := func(name, path string) {
+		if path == "" {
+			addf("%s: file is required", name)
+		} else if _, err := os.Stat(path); err != nil {
+			addf("%s: %s", name, err)
+		}
+	}
+
+	server, tls, store := cfg.Server, cfg.TLS, cfg.Storage
+	if server.Address == "" && server.UnixSocket == "" {
+		addf("server.address: address or unix socket is required")
+	}
+	if u, err := url.Parse(server.BaseURL); err != nil {
+		addf("server.base_url: %s", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		addf("server.base_url: absolute http or https url expected, got %q", server.BaseURL)
+	}
+	for _, name := range server.ShortDomains {
+		if err := domains.ValidateName(name); err != nil {
+			addf("server.short_domains: %s", err)
+		}
+	}
+	if server.PprofAddress != "" {
+		if !isLoopback(server.PprofAddress) {
+			addf("server.pprof_address: pprof endpoints aren't authenticated, loopback address like localhost:6060 expected, got %q",
+				server.PprofAddress)
+		} else if server.PprofAddress == server.Address {
+			addf("server.pprof_address: must differ from the server address")
+		}
+	}
+	for _, timeout := range []struct {
+		name  string
+		value Duration
+	}{
+		{"server.read_timeout", server.ReadTimeout},
+		{"server.read_header_timeout", server.ReadHeaderTimeout},
+		{"server.write_timeout", server.WriteTimeout},
+		{"server.idle_timeout", server.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			addf("%s: must not be negative, got %s", timeout.name, timeout.value)
+		}
+	}
+	if _, err := proxyproto.ParseNetworks(server.ProxyTrustedNetworks); err != nil {
+		addf("server.proxy_trusted_networks: %s", err)
+	} else if server.ProxyProtocol && server.UnixSocket == "" && len(server.ProxyTrustedNetworks) == 0 {
+		addf("server.proxy_trusted_networks: required with server.proxy_protocol, headers of any peer would be trusted")
+	}
+	if server.H2C && tls.Enabled {
+		addf("server.h2c: HTTP/2 without TLS can't be enabled with tls.enabled")
+	}
+	if tls.Enabled {
+		requireFile("tls.cert_file", tls.CertFile)
+		requireFile("tls.key_file", tls.KeyFile)
+		if tls.ClientCAFile != "" {
+			requireFile("tls.client_ca_file", tls.ClientCAFile)
+		}
+	} else if tls.ClientCAFile != "" {
+		addf("tls.client_ca_file: client certificates require tls.enabled")
+	}
+	if _, err := certmanager.ParseVersion(tls.MinVersion); err != nil {
+		addf("tls.min_version: %s", err)
+	}
+	if _, err := certmanager.ParseCipherSuites(tls.CipherSuites); err != nil {
+		addf("tls.cipher_suites: %s", err)
+	}
+	if store.FilePath != "" && store.DatabaseDSN != "" {
+		addf("storage.file_path and storage.database_dsn: only one storage can be set")
+	}
+	switch store.DedupScope {
+	case "global", "user", "none":
+	default:
+		addf("storage.dedup_scope: unknown scope %q, expected global, user or none", store.DedupScope)
+	}
+	if cfg.Limits.MaxHeaderBytes < 1 {
+		addf("limits.max_header_bytes: must be positive, got %d", cfg.Limits.MaxHeaderBytes)
+	}
+	if cfg.Limits.DeleteBatchSize < 1 {
+		addf("limits.delete_batch_size: must be positive, got %d", cfg.Limits.DeleteBatchSize)
+	}
+
+	if server.AdminAddress != "" {
+		if server.AdminAddress == server.Address {
+			addf("server.admin_address: must differ from the server address")
+		}
+		if cfg.Auth.AdminToken == "" && tls.AdminClientCAFile == "" {
+			addf("auth.admin_token: admin server requires token or client CA")
+		}
+		if tls.AdminCertFile != "" || tls.AdminKeyFile != "" {
+			requireFile("tls.admin_cert_file", tls.AdminCertFile)
+			requireFile("tls.admin_key_file", tls.AdminKeyFile)
+		}
+		if tls.AdminClientCAFile != "" {
+			requireFile("tls.admin_client_ca_file", tls.AdminClientCAFile)
+			if tls.AdminCertFile == "" {
+				addf("tls.admin_client_ca_file: client certificates require tls.admin_cert_file")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(cert, []byte("cert"), 0600))
+
+	valid := EnvConfig{
+		Server:  ServerConfig{Address: ":8080", BaseURL: "http://localhost:8080"},
+		Storage: StorageConfig{DedupScope: "global"},
+		Limits:  LimitsConfig{MaxHeaderBytes: 1 << 20, DeleteBatchSize: 5},
+	}
+	tests := []struct {
+		name   string
+		modify func(cfg *EnvConfig)
+		want   ValidationErrors
+	}{
+		{name: "valid", modify: func(cfg *EnvConfig) {}},
+		{
+			name:   "relative base url",
+			modify: func(cfg *EnvConfig) { cfg.Server.BaseURL = "localhost:8080" },
+			want:   ValidationErrors{`server.base_url: absolute http or https url expected, got "localhost:8080"`},
+		},
+		{
+			name:   "unparsable base url",
+			modify: func(cfg *EnvConfig) { cfg.Server.BaseURL = "http://[::1" },
+			want:   ValidationErrors{`server.base_url: parse "http://[::1": missing ']' in host`},
+		},
+		{
+			name:   "short domains",
+			modify: func(cfg *EnvConfig) { cfg.Server.ShortDomains = []string{"go.example.com", "https://go.example.org"} },
+			want:   ValidationErrors{`server.short_domains: invalid domain "https://go.example.org", expected host with optional port`},
+		},
+		{
+			name: "both storages",
+			modify: func(cfg *EnvConfig) {
+				cfg.Storage.FilePath = "shorts.json"
+				cfg.Storage.DatabaseDSN = "postgres://localhost/shortener"
+			},
+			want: ValidationErrors{"storage.file_path and storage.database_dsn: only one storage can be set"},
+		},
+		{
+			name: "proxy protocol without trusted networks",
+			modify: func(cfg *EnvConfig) {
+				cfg.Server.ProxyProtocol = true
+			},
+			want: ValidationErrors{"server.proxy_trusted_networks: required with server.proxy_protocol, headers of any peer would be trusted"},
+		},
+		{
+			name: "proxy protocol with trusted networks",
+			modify: func(cfg *EnvConfig) {
+				cfg.Server.ProxyProtocol = true
+				cfg.Server.ProxyTrustedNetworks = []string{"10.0.0.0/8", "192.0.2.1"}
+			},
+		},
+		{
+			name:   "invalid trusted network",
+			modify: func(cfg *EnvConfig) { cfg.Server.ProxyTrustedNetworks = []string{"10.0.0.0/33"} },
+			want:   ValidationErrors{"server.proxy_trusted_networks: invalid CIDR address: 10.0.0.0/33"},
+		},
+		{
+			name:   "pprof on loopback",
+			modify: func(cfg *EnvConfig) { cfg.Server.PprofAddress = "127.0.0.1:6060" },
+		},
+		{
+			name:   "pprof on the server address",
+			modify: func(cfg *EnvConfig) { cfg.Server.Address, cfg.Server.PprofAddress = "localhost:8080", "localhost:8080" },
+			want:   ValidationErrors{"server.pprof_address: must differ from the server address"},
+		},
+		{
+			name: "https with existing certificate",
+			modify: func(cfg *EnvConfig) {
+				cfg.TLS.Enabled = true
+				cfg.TLS.CertFile = cert
+				cfg.TLS.KeyFile = cert
+			},
+		},
+		{
+			name: "https with missing certificate",
+			modify: func(cfg *EnvConfig) {
+				cfg.TLS.Enabled = true
+				cfg.TLS.CertFile = filepath.Join(filepath.Dir(cert), "missing.pem")
+			},
+			want: ValidationErrors{
+				"tls.cert_file: stat " + filepath.Join(filepath.Dir(cert), "missing.pem") + ": no such file or directory",
+				"tls.key_file: file is required",
+			},
+		},
+		{
+			name: "tls options",
+			modify: func(cfg *EnvConfig) {
+				cfg.TLS.MinVersion = "1.4"
+				cfg.TLS.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+				cfg.TLS.ClientCAFile = cert
+			},
+			want: ValidationErrors{
+				"tls.client_ca_file: client certificates require tls.enabled",
+				`tls.min_version: unknown TLS version "1.4", expected 1.0, 1.1, 1.2 or 1.3`,
+				`tls.cipher_suites: unknown or insecure cipher suite "TLS_RSA_WITH_RC4_128_SHA"`,
+			},
+		},
+		{
+			name:   "unix socket without address",
+			modify: func(cfg *EnvConfig) { cfg.Server.Address, cfg.Server.UnixSocket = "", "/tmp/shortener.sock" },
+		},
+		{
+			name: "server options",
+			modify: func(cfg *EnvConfig) {
+				cfg.Server.Address = ""
+				cfg.Server.WriteTimeout = Duration(-time.Second)
+				cfg.Server.H2C = true
+				cfg.TLS.Enabled, cfg.TLS.CertFile, cfg.TLS.KeyFile = true, cert, cert
+				cfg.Limits.MaxHeaderBytes = 0
+			},
+			want: ValidationErrors{
+				"server.address: address or unix socket is required",
+				"server.write_timeout: must not be negative, got -1s",
+				"server.h2c: HTTP/2 without TLS can't be enabled with tls.enabled",
+				"limits.max_header_bytes: must be positive, got 0",
+			},
+		},
+		{
+			name: "all problems are reported",
+			modify: func(cfg *EnvConfig) {
+				cfg.Storage.DedupScope = "all"
+				cfg.Server.PprofAddress = ":8080"
+				cfg.Server.AdminAddress = ":8080"
+				cfg.Limits.DeleteBatchSize = 0
+			},
+			want: ValidationErrors{
+				`server.pprof_address: pprof endpoints aren't authenticated, loopback address like localhost:6060 expected, got ":8080"`,
+				`storage.dedup_scope: unknown scope "all", expected global, user or none`,
+				"limits.delete_batch_size: must be positive, got 0",
+				"server.admin_address: must differ from the server address",
+				"auth.admin_token: admin server requires token or client CA",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			err := Validate(cfg)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var errs ValidationErrors
+			require.True(t, errors.As(err, &errs))
+			assert.Equal(t, tt.want, errs)
+		})
+	}
+}
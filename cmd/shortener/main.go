@@ -5,10 +5,9 @@ import (
 	"fmt"
 	"github.com/putalexey/go-practicum/cmd/shortener/config"
 	"github.com/putalexey/go-practicum/internal/app"
+	"github.com/putalexey/go-practicum/internal/app/profiling"
 	"log"
-	"os"
 	"os/signal"
-	"runtime/pprof"
 	"sync"
 	"syscall"
 )
@@ -25,17 +24,21 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
 	cfg := config.Parse()
-	if cfg.ProfileCPUFile != "" {
-		fProfileCPU, err := os.Create(cfg.ProfileCPUFile)
-		if err != nil {
-			panic(err)
-		}
-		defer fProfileCPU.Close()
-		if err := pprof.StartCPUProfile(fProfileCPU); err != nil {
-			panic(err)
-		}
-		defer pprof.StopCPUProfile()
+	profiler, err := profiling.Start(profiling.Config{
+		CPUFile:   cfg.Logging.ProfileCPUFile,
+		HeapFile:  cfg.Logging.ProfileHeapFile,
+		MutexFile: cfg.Logging.ProfileMutexFile,
+		BlockFile: cfg.Logging.ProfileBlockFile,
+		DumpDir:   cfg.Logging.ProfileDumpDir,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer func() {
+		if err := profiler.Stop(); err != nil {
+			log.Println("ERROR:", err)
+		}
+	}()
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer stop()
@@ -44,6 +47,15 @@ func main() {
 	defer cancel()
 
 	finished := sync.WaitGroup{}
+	if cfg.Server.PprofAddress != "" {
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			if err := profiling.Serve(ctx, cfg.Server.PprofAddress); err != nil {
+				log.Println("ERROR: pprof server:", err)
+			}
+		}()
+	}
 	finished.Add(1)
 	go func() {
 		defer finished.Done()
@@ -0,0 +1,248 @@
+// Package accountlink lets users keep their urls across browsers. Authenticated user issues short-lived claim code
+// and redeems it from another browser, urls and workspaces of the other browser's user are moved to the user of the code.
+// Codes are kept in memory of the instance, which issued them. Issued codes and merges are written to the audit log.
+// Failed redeem attempts are throttled per client, so codes can't be guessed
+package accountlink
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+// DefaultTTL is lifetime of the claim code
+const DefaultTTL = 10 * time.Minute
+
+// codeAlphabet has no characters, which are easily confused, like 0 and O
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const codeLength = 12
+
+// Failed redeem attempts are counted in windows of failureWindow. When a client reaches the limit, it can try
+// once per throttleInterval until the window ends. Clients behind one proxy share the address, so they are slowed
+// down, not locked out. Identities are free to mint, so clients are counted by address
+const (
+	failureWindow     = 10 * time.Minute
+	maxClientFailures = 5
+	throttleInterval  = 2 * time.Second
+)
+
+var (
+	// ErrInvalidCode is returned for unknown, expired and already redeemed codes
+	ErrInvalidCode = errors.New("claim code is invalid or expired")
+	// ErrSameUser is returned, when the code is redeemed by the user, who issued it
+	ErrSameUser = errors.New("claim code belongs to the current user")
+	// ErrTooManyAttempts is returned, when the client failed to redeem codes too many times and tries too often
+	ErrTooManyAttempts = errors.New("too many failed claim attempts, try again later")
+)
+
+type claim struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// clientFailures are failed redeem attempts of the client in the current window
+type clientFailures struct {
+	count int
+	last  time.Time
+}
+
+// Result of the merge of the users
+type Result struct {
+	// UserID is user, the other user was merged into
+	UserID string
+	// Records is number of reassigned records
+	Records int
+	// Skipped are keys of the records, which duplicate records of the user and stay with the old user
+	Skipped []string
+	// Workspaces is number of workspaces, the user got membership in
+	Workspaces int
+}
+
+// Linker issues claim codes and merges users, who redeem them
+type Linker struct {
+	mu    sync.Mutex
+	store storage.Storager
+	ttl   time.Duration
+	audit *log.Logger
+	// codes by code, each user has one code at most
+	codes map[string]claim
+	now   func() time.Time
+	// failed redeem attempts of the current window by client
+	windowStart time.Time
+	failures    map[string]*clientFailures
+}
+
+// NewLinker creates linker, which moves records of the store. Codes live for ttl, DefaultTTL if ttl isn't positive
+func NewLinker(store storage.Storager, ttl time.Duration, audit *log.Logger) *Linker {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Linker{
+		store:    store,
+		ttl:      ttl,
+		audit:    audit,
+		codes:    make(map[string]claim),
+		now:      time.Now,
+		failures: make(map[string]*clientFailures),
+	}
+}
+
+// Issue returns new claim code of the user and its expiration time, previous code of the user is revoked
+func (l *Linker) Issue(userID string) (string, time.Time, error) {
+	code, err := newCode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for c, cl := range l.codes {
+		if cl.userID == userID || !now.Before(cl.expiresAt) {
+			delete(l.codes, c)
+		}
+	}
+	expiresAt := now.Add(l.ttl)
+	l.codes[code] = claim{userID: userID, expiresAt: expiresAt}
+	l.audit.Printf("AUDIT: claim code issued for user %s, expires at %s", userID, expiresAt.UTC().Format(time.RFC3339))
+	return code, expiresAt, nil
+}
+
+// Claim redeems the code and merges userID into the user, the code was issued for. Client is address of the request,
+// it's used to limit failed attempts. Code can be redeemed once, even if the merge fails
+func (l *Linker) Claim(ctx context.Context, code, userID, client string) (Result, error) {
+	target, err := l.redeem(normalizeCode(code), userID, client)
+	if err != nil {
+		l.audit.Printf("AUDIT: claim code rejected for user %s from %s: %v", userID, client, err)
+		return Result{}, err
+	}
+
+	result, err := l.merge(ctx, userID, target)
+	if err != nil {
+		l.audit.Printf("AUDIT: merge of user %s into %s failed after %d records and %d workspaces: %v",
+			userID, target, result.Records, result.Workspaces, err)
+		return result, err
+	}
+	l.audit.Printf("AUDIT: user %s merged into %s: %d records reassigned, %d skipped, %d workspaces",
+		userID, target, result.Records, len(result.Skipped), result.Workspaces)
+	return result, nil
+}
+
+// redeem removes the code and returns user of the code. Unknown and expired codes are counted as failures of the client
+func (l *Linker) redeem(code, userID, client string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.windowStart) >= failureWindow {
+		l.windowStart = now
+		l.failures = make(map[string]*clientFailures)
+	}
+	failures, ok := l.failures[client]
+	if !ok {
+		failures = &clientFailures{}
+		l.failures[client] = failures
+	}
+	if failures.count >= maxClientFailures && now.Sub(failures.last) < throttleInterval {
+		return "", ErrTooManyAttempts
+	}
+
+	cl, ok := l.codes[code]
+	if !ok || !now.Before(cl.expiresAt) {
+		delete(l.codes, code)
+		failures.count++
+		failures.last = now
+		return "", ErrInvalidCode
+	}
+	if cl.userID == userID {
+		return "", ErrSameUser
+	}
+	delete(l.codes, code)
+	return cl.userID, nil
+}
+
+// merge reassigns records of the user from to the user to and moves memberships in workspaces
+func (l *Linker) merge(ctx context.Context, from, to string) (Result, error) {
+	result := Result{UserID: to}
+
+	keys, err := l.recordKeys(ctx, from)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range keys {
+		err = l.store.Reassign(ctx, key, to)
+		var conflictErr *storage.RecordConflictError
+		if errors.As(err, &conflictErr) {
+			result.Skipped = append(result.Skipped, key)
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("reassign %s: %w", key, err)
+		}
+		result.Records++
+	}
+
+	memberships, err := l.store.LoadWorkspacesForUser(ctx, from)
+	if err != nil {
+		return result, err
+	}
+	for _, m := range memberships {
+		role, err := l.store.MemberRole(ctx, m.ID, to)
+		if err != nil {
+			return result, err
+		}
+		// the user keeps the higher role, if both users are members
+		if !role.Allows(m.Role) {
+			if err = l.store.SetMember(ctx, storage.Member{WorkspaceID: m.ID, UserID: to, Role: m.Role}); err != nil {
+				return result, err
+			}
+			result.Workspaces++
+		}
+		if err = l.store.RemoveMember(ctx, m.ID, from); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// recordKeys returns keys of all records of the user, including deleted ones
+func (l *Linker) recordKeys(ctx context.Context, userID string) ([]string, error) {
+	it, err := l.store.IterateForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Record().Key())
+	}
+	return keys, it.Err()
+}
+
+func newCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < codeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// normalizeCode makes codes typed by hand comparable: case and separators are ignored
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
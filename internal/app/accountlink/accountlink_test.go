@@ -0,0 +1,116 @@
+package accountlink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+func TestLinker_Claim(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage(storage.RecordMap{
+		"a1": {Short: "a1", Full: "http://example.com/1", UserID: "original"},
+		"b1": {Short: "b1", Full: "http://example.com/1", UserID: "browser"},
+		"b2": {Short: "b2", Full: "http://example.com/2", UserID: "browser", Deleted: true},
+	})
+	store.SetDedupScope(storage.DedupUser)
+	w, err := storage.NewWorkspace("team")
+	require.NoError(t, err)
+	require.NoError(t, store.CreateWorkspace(ctx, w, "browser"))
+
+	var audit bytes.Buffer
+	linker := NewLinker(store, time.Minute, log.New(&audit, "", 0))
+
+	code, expiresAt, err := linker.Issue("original")
+	require.NoError(t, err)
+	assert.Len(t, code, codeLength)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+	_, err = linker.Claim(ctx, code, "original", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrSameUser)
+
+	result, err := linker.Claim(ctx, strings.ToLower(code[:4]+"-"+code[4:]), "browser", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, Result{UserID: "original", Records: 1, Skipped: []string{"b1"}, Workspaces: 1}, result,
+		"record duplicating url of the user stays with the old user")
+
+	r, err := store.Load(ctx, "b2")
+	require.NoError(t, err)
+	assert.Equal(t, "original", r.UserID, "deleted records are reassigned too")
+	role, err := store.MemberRole(ctx, w.ID, "original")
+	require.NoError(t, err)
+	assert.Equal(t, storage.RoleAdmin, role)
+	role, err = store.MemberRole(ctx, w.ID, "browser")
+	require.NoError(t, err)
+	assert.Empty(t, role)
+
+	_, err = linker.Claim(ctx, code, "another", "10.0.0.2")
+	assert.ErrorIs(t, err, ErrInvalidCode, "code is redeemed once")
+
+	assert.Contains(t, audit.String(), "AUDIT: claim code issued for user original")
+	assert.Contains(t, audit.String(), "AUDIT: user browser merged into original: 1 records reassigned, 1 skipped, 1 workspaces")
+	assert.Contains(t, audit.String(), "AUDIT: claim code rejected for user another from 10.0.0.2")
+	assert.NotContains(t, audit.String(), code, "codes aren't logged")
+}
+
+func TestLinker_Expiration(t *testing.T) {
+	linker := NewLinker(storage.NewMemoryStorage(nil), time.Minute, log.New(&bytes.Buffer{}, "", 0))
+	now := time.Now()
+	linker.now = func() time.Time { return now }
+
+	first, _, err := linker.Issue("user")
+	require.NoError(t, err)
+	second, _, err := linker.Issue("user")
+	require.NoError(t, err)
+	_, err = linker.Claim(context.Background(), first, "other", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidCode, "new code revokes previous one")
+
+	now = now.Add(time.Minute)
+	_, err = linker.Claim(context.Background(), second, "other", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+	assert.Empty(t, linker.codes)
+}
+
+func TestLinker_FailedAttempts(t *testing.T) {
+	ctx := context.Background()
+	linker := NewLinker(storage.NewMemoryStorage(nil), time.Hour, log.New(&bytes.Buffer{}, "", 0))
+	now := time.Now()
+	linker.now = func() time.Time { return now }
+	code, _, err := linker.Issue("user")
+	require.NoError(t, err)
+
+	for i := 0; i < maxClientFailures; i++ {
+		_, err = linker.Claim(ctx, "WRONGCODE", fmt.Sprintf("guesser-%d", i), "10.0.0.1")
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	}
+	_, err = linker.Claim(ctx, code, "guesser", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrTooManyAttempts, "valid code is rejected too, after the client failed too many times")
+
+	for i := 0; i < 100; i++ {
+		_, err = linker.Claim(ctx, "WRONGCODE", "guesser", fmt.Sprintf("10.0.1.%d", i))
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	}
+	_, err = linker.Claim(ctx, code, "other", "10.0.0.2")
+	assert.NoError(t, err, "failures of other clients don't limit the client")
+
+	now = now.Add(throttleInterval)
+	_, err = linker.Claim(ctx, "WRONGCODE", "guesser", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidCode, "client is slowed down, not locked out")
+	_, err = linker.Claim(ctx, "WRONGCODE", "guesser", "10.0.0.1")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+
+	now = now.Add(failureWindow)
+	for i := 0; i < maxClientFailures; i++ {
+		_, err = linker.Claim(ctx, "WRONGCODE", "guesser", "10.0.0.1")
+		assert.ErrorIs(t, err, ErrInvalidCode, "failures are forgotten in the next window")
+	}
+}
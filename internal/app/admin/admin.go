@@ -0,0 +1,252 @@
+// Package admin is router of the admin server with operational endpoints, served on its own address
+package admin
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/putalexey/go-practicum/internal/app/certmanager"
+	"github.com/putalexey/go-practicum/internal/app/metrics"
+	"github.com/putalexey/go-practicum/internal/app/profiling"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+type Admin struct {
+	*chi.Mux
+	storage      storage.Storager
+	batchDeleter *storage.BatchDeleter
+	token        string
+	metrics      *metrics.Metrics
+	config       interface{}
+	settings     atomic.Value
+}
+
+// settings of the router, which can be changed by Reload while the router serves requests
+type settings struct {
+	token  string
+	config interface{}
+}
+
+// Option configures optional features of the Admin
+type Option func(a *Admin)
+
+// WithToken allows requests with "Authorization: Bearer <token>" header
+func WithToken(token string) Option {
+	return func(a *Admin) {
+		a.token = token
+	}
+}
+
+// WithMetrics serves request metrics collected in m
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(a *Admin) {
+		a.metrics = m
+	}
+}
+
+// WithConfig serves config as json, secrets of the config must be redacted
+func WithConfig(config interface{}) Option {
+	return func(a *Admin) {
+		a.config = config
+	}
+}
+
+// NewRouter creates admin router.
+// Requests are allowed with the token set by WithToken or with the client certificate verified by TLS server.
+// List of routes:
+// * {GET} /healthz - storage status check
+// * {GET} /metrics - request and storage metrics in Prometheus text format
+// * {GET} /config - config of the service
+// * {GET} /debug/pprof/ - net/http/pprof endpoints
+// * {POST} /shorts/{id}/disable - disable redirects by the short, ?domain= selects short domain
+// * {POST} /shorts/{id}/enable - enable redirects by the short, ?domain= selects short domain
+// * {POST} /trash/purge - remove deleted records permanently
+// * {POST} /deleter/flush - delete queued urls without waiting for the timer
+//
+// There is no route to reload blocklists, the service has no blocklists. Token and config are reloaded by Reload.
+func NewRouter(store storage.Storager, batchDeleter *storage.BatchDeleter, opts ...Option) *Admin {
+	a := &Admin{
+		Mux:          chi.NewMux(),
+		storage:      store,
+		batchDeleter: batchDeleter,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.settings.Store(settings{token: a.token, config: a.config})
+
+	a.Use(middleware.Logger)
+	a.Use(middleware.Recoverer)
+	a.Use(a.authorize)
+
+	a.Get("/healthz", a.health)
+	a.Get("/metrics", a.serveMetrics)
+	a.Get("/config", a.serveConfig)
+	a.Mount("/debug/pprof/", profiling.Handler())
+	a.Post("/shorts/{id}/disable", a.setDisabled(true))
+	a.Post("/shorts/{id}/enable", a.setDisabled(false))
+	a.Post("/trash/purge", a.purgeTrash)
+	a.Post("/deleter/flush", a.flushDeleter)
+
+	return a
+}
+
+// Reload atomically replaces token and config set by WithToken and WithConfig.
+// Options not passed are reset to defaults, others are ignored
+func (a *Admin) Reload(opts ...Option) {
+	s := &Admin{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	a.settings.Store(settings{token: s.token, config: s.config})
+}
+
+func (a *Admin) current() settings {
+	return a.settings.Load().(settings)
+}
+
+// authorize allows requests with the token or verified client certificate
+func (a *Admin) authorize(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		expected := a.current().token
+		if token != header && expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		jsonError(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (a *Admin) health(w http.ResponseWriter, r *http.Request) {
+	if err := a.storage.Ping(r.Context()); err != nil {
+		log.Println("ERROR:", err)
+		jsonError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+func (a *Admin) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	stats, err := a.storage.Stats(r.Context())
+	if err != nil {
+		log.Println("ERROR:", err)
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if a.metrics != nil {
+		if _, err = a.metrics.WriteTo(w); err != nil {
+			log.Println("ERROR:", err)
+			return
+		}
+	}
+	for _, gauge := range []struct {
+		name  string
+		help  string
+		value int64
+	}{
+		{"shortener_records", "Number of stored records.", stats.Records},
+		{"shortener_records_deleted", "Number of deleted records.", stats.Deleted},
+		{"shortener_records_disabled", "Number of disabled records.", stats.Disabled},
+		{"shortener_users", "Number of users with records.", stats.Users},
+		{"shortener_clicks", "Number of redirects by all records.", stats.Clicks},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", gauge.name, gauge.help, gauge.name, gauge.name, gauge.value)
+	}
+}
+
+func (a *Admin) serveConfig(w http.ResponseWriter, _ *http.Request) {
+	config := a.current().config
+	if config == nil {
+		jsonError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, config, http.StatusOK)
+}
+
+func (a *Admin) setDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		short := chi.URLParam(r, "id")
+		domain := r.URL.Query().Get("domain")
+		err := a.storage.SetDisabled(r.Context(), storage.Key(domain, short), disabled)
+		var notFound *storage.RecordNotFoundError
+		if errors.As(err, &notFound) {
+			jsonError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response := map[string]interface{}{"short": short, "disabled": disabled}
+		if domain != "" {
+			response["domain"] = domain
+		}
+		jsonResponse(w, response, http.StatusOK)
+	}
+}
+
+func (a *Admin) purgeTrash(w http.ResponseWriter, r *http.Request) {
+	purged, err := a.storage.PurgeDeleted(r.Context())
+	if err != nil {
+		log.Println("ERROR:", err)
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, map[string]int64{"purged": purged}, http.StatusOK)
+}
+
+func (a *Admin) flushDeleter(w http.ResponseWriter, _ *http.Request) {
+	a.batchDeleter.Flush()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// TLSConfig returns config of the TLS server verifying client certificates by CA in the file.
+// Clients without certificate are allowed only if required is false, they must present the token then
+func TLSConfig(clientCAFile string, required bool) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+	pool, err := certmanager.LoadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if required {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+func jsonResponse(w http.ResponseWriter, v interface{}, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("ERROR:", err)
+	}
+}
+
+func jsonError(w http.ResponseWriter, msg string, code int) {
+	jsonResponse(w, map[string]string{"error": msg}, code)
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/putalexey/go-practicum/internal/app/metrics"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+const testToken = "secret"
+
+func newTestAdmin() (*Admin, storage.Storager) {
+	store := storage.NewMemoryStorage(storage.RecordMap{
+		"some":    {Short: "some", Full: "http://test.example.com", UserID: "test", Clicks: 3},
+		"deleted": {Short: "deleted", Full: "http://test.example.com/2", UserID: "test", Deleted: true},
+	})
+	deleter := storage.NewBatchDeleterWithContext(context.Background(), store, 5)
+	a := NewRouter(store, deleter,
+		WithToken(testToken),
+		WithMetrics(metrics.New()),
+		WithConfig(map[string]string{"server_address": ":8080"}),
+	)
+	return a, store
+}
+
+func doRequest(t *testing.T, a http.Handler, method, target, token string) (int, string) {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, req)
+	result := w.Result()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	return result.StatusCode, string(body)
+}
+
+func TestAdmin_Authorize(t *testing.T) {
+	a, _ := newTestAdmin()
+	for _, token := range []string{"", "wrong"} {
+		code, _ := doRequest(t, a, http.MethodGet, "/healthz", token)
+		assert.Equal(t, http.StatusUnauthorized, code, token)
+	}
+	code, body := doRequest(t, a, http.MethodGet, "/healthz", testToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+
+	for _, header := range []string{testToken, "Basic " + testToken} {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "token without Bearer scheme is rejected: %s", header)
+	}
+
+	noToken := NewRouter(storage.NewMemoryStorage(nil), nil)
+	code, _ = doRequest(t, noToken, http.MethodGet, "/healthz", "")
+	assert.Equal(t, http.StatusUnauthorized, code, "admin without token allows only client certificates")
+}
+
+func TestAdmin_Reload(t *testing.T) {
+	a, _ := newTestAdmin()
+	a.Reload(WithToken("rotated"), WithConfig(map[string]string{"server_address": ":8081"}))
+
+	code, _ := doRequest(t, a, http.MethodGet, "/healthz", testToken)
+	assert.Equal(t, http.StatusUnauthorized, code, "old token is revoked")
+	code, body := doRequest(t, a, http.MethodGet, "/config", "rotated")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"server_address":":8081"}`, body)
+}
+
+func TestAdmin_Routes(t *testing.T) {
+	ctx := context.Background()
+	a, store := newTestAdmin()
+
+	t.Run("disables and enables short", func(t *testing.T) {
+		code, body := doRequest(t, a, http.MethodPost, "/shorts/some/disable", testToken)
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `{"short":"some","disabled":true}`, body)
+		r, err := store.Load(ctx, "some")
+		require.NoError(t, err)
+		assert.True(t, r.Disabled)
+
+		code, _ = doRequest(t, a, http.MethodPost, "/shorts/some/enable", testToken)
+		assert.Equal(t, http.StatusOK, code)
+		r, err = store.Load(ctx, "some")
+		require.NoError(t, err)
+		assert.False(t, r.Disabled)
+
+		code, _ = doRequest(t, a, http.MethodPost, "/shorts/other/disable", testToken)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("serves metrics", func(t *testing.T) {
+		code, body := doRequest(t, a, http.MethodGet, "/metrics", testToken)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "shortener_records 2\n")
+		assert.Contains(t, body, "shortener_clicks 3\n")
+		assert.Contains(t, body, "shortener_http_requests_in_flight")
+	})
+
+	t.Run("serves config", func(t *testing.T) {
+		code, body := doRequest(t, a, http.MethodGet, "/config", testToken)
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `{"server_address":":8080"}`, body)
+	})
+
+	t.Run("serves pprof", func(t *testing.T) {
+		code, _ := doRequest(t, a, http.MethodGet, "/debug/pprof/goroutine?debug=1", testToken)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("purges trash", func(t *testing.T) {
+		code, body := doRequest(t, a, http.MethodPost, "/trash/purge", testToken)
+		assert.Equal(t, http.StatusOK, code)
+		response := map[string]int64{}
+		require.NoError(t, json.Unmarshal([]byte(body), &response))
+		assert.Equal(t, int64(1), response["purged"])
+		_, err := store.Load(ctx, "deleted")
+		assert.Error(t, err)
+	})
+
+	t.Run("flushes deleter", func(t *testing.T) {
+		code, _ := doRequest(t, a, http.MethodPost, "/deleter/flush", testToken)
+		assert.Equal(t, http.StatusAccepted, code)
+	})
+}
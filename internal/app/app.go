@@ -5,11 +5,18 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/putalexey/go-practicum/cmd/shortener/config"
+	"github.com/putalexey/go-practicum/internal/app/admin"
+	"github.com/putalexey/go-practicum/internal/app/certmanager"
 	_ "github.com/putalexey/go-practicum/internal/app/docs"
+	"github.com/putalexey/go-practicum/internal/app/metrics"
 	"github.com/putalexey/go-practicum/internal/app/shortener"
 	"github.com/putalexey/go-practicum/internal/app/storage"
 )
@@ -19,24 +26,64 @@ import (
 // @description API server for shorting log urls to short ones
 // @BasePath /
 
+// certCheckInterval is period of checking certificate files for changes
+const certCheckInterval = 30 * time.Second
+
+// storageFlushInterval is interval of writing clicks, which storage keeps in memory
+const storageFlushInterval = 10 * time.Second
+
+// flusher is storage, which keeps some changes in memory, like FileStorage
+type flusher interface {
+	Flush() error
+}
+
 // Run starts http server with shortener module as router. If ctx context is canceled,
 // then http server will gracefully shutdown
 func Run(ctx context.Context, cfg config.EnvConfig) {
 	var err error
 
-	if cfg.EnableHTTPS && (cfg.CertFile == "" || cfg.CertKeyFile == "") {
-		log.Fatal("Certificate paths not provided")
+	if err = config.Validate(cfg); err != nil {
+		log.Fatal(err)
 	}
 
-	store, err := initStorage(cfg)
+	store, err := initStorage(ctx, cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	router := shortener.NewRouter(ctx, cfg.BaseURL, store)
-	srv := http.Server{
-		Addr:    cfg.Address,
-		Handler: router,
+	requestMetrics := metrics.New()
+	router := shortener.NewRouter(
+		ctx,
+		cfg.Server.BaseURL,
+		store,
+		shortener.WithInterstitial(cfg.Server.AlwaysInterstitial),
+		shortener.WithStripTrackingParams(cfg.Storage.StripTrackingParams),
+		shortener.WithDomains(cfg.Server.ShortDomains),
+		shortener.WithRequestLog(cfg.Logging.RequestLog),
+		shortener.WithDeleteBatchSize(cfg.Limits.DeleteBatchSize),
+		shortener.WithMetrics(requestMetrics),
+	)
+	srv := newServer(cfg, router)
+	ln, err := listen(cfg.Server)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// certificates are reloaded on SIGHUP and on changes of the files
+	var certs []*certmanager.Manager
+	if cfg.TLS.Enabled {
+		serverCerts, err := certmanager.New(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv.TLSConfig, err = serverCerts.ServerConfig(certmanager.Options{
+			MinVersion:   cfg.TLS.MinVersion,
+			CipherSuites: cfg.TLS.CipherSuites,
+			ClientCAFile: cfg.TLS.ClientCAFile,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		certs = append(certs, serverCerts)
 	}
 
 	srvCtx, srvCancel := context.WithCancel(ctx)
@@ -46,21 +93,71 @@ func Run(ctx context.Context, cfg config.EnvConfig) {
 		defer srvCancel()
 		defer wg.Done()
 		var err error
-		if cfg.EnableHTTPS {
-			err = srv.ListenAndServeTLS(cfg.CertFile, cfg.CertKeyFile)
+		if cfg.TLS.Enabled {
+			err = srv.ServeTLS(ln, "", "")
 		} else {
-			err = srv.ListenAndServe()
+			err = srv.Serve(ln)
 		}
 		if err != nil {
 			log.Println(err)
 		}
 	}()
+	var adminSrv *http.Server
+	var adminRouter *admin.Admin
+	if cfg.Server.AdminAddress != "" {
+		var adminCerts *certmanager.Manager
+		if cfg.TLS.AdminCertFile != "" {
+			adminCerts, err = certmanager.New(cfg.TLS.AdminCertFile, cfg.TLS.AdminKeyFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			certs = append(certs, adminCerts)
+		}
+		adminSrv, adminRouter, err = newAdminServer(cfg, store, router.BatchDeleter, requestMetrics, adminCerts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer srvCancel()
+			defer wg.Done()
+			var err error
+			if cfg.TLS.AdminCertFile != "" {
+				err = adminSrv.ListenAndServeTLS("", "")
+			} else {
+				err = adminSrv.ListenAndServe()
+			}
+			if err != nil {
+				log.Println("admin server:", err)
+			}
+		}()
+	}
+	for _, m := range certs {
+		wg.Add(1)
+		go func(m *certmanager.Manager) {
+			defer wg.Done()
+			m.Watch(srvCtx, certCheckInterval)
+		}(m)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reloadOnSignal(srvCtx, cfg, router, adminRouter, certs)
+	}()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		router.BatchDeleter.Start()
 		log.Println("Batch deleter stopped")
 	}()
+	storeFlusher, _ := store.(flusher)
+	if storeFlusher != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			flushPeriodically(srvCtx, storeFlusher, storageFlushInterval)
+		}()
+	}
 
 	<-srvCtx.Done()
 	log.Println("Shutting down server...")
@@ -68,20 +165,151 @@ func Run(ctx context.Context, cfg config.EnvConfig) {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			log.Println("Admin server forced to shutdown:", err)
+		}
+	}
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Server forced to shutdown: %s", err)
 	}
 	wg.Wait()
+	if storeFlusher != nil {
+		if err := storeFlusher.Flush(); err != nil {
+			log.Println("ERROR: storage flush:", err)
+		}
+	}
+}
+
+// flushPeriodically writes changes, which storage keeps in memory, until ctx is canceled
+func flushPeriodically(ctx context.Context, f flusher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Flush(); err != nil {
+				log.Println("ERROR: storage flush:", err)
+			}
+		}
+	}
+}
+
+// newAdminServer creates admin server, which requests are guarded by the token or client certificates.
+// Config must be validated by config.Validate
+func newAdminServer(
+	cfg config.EnvConfig,
+	store storage.Storager,
+	batchDeleter *storage.BatchDeleter,
+	m *metrics.Metrics,
+	certs *certmanager.Manager,
+) (*http.Server, *admin.Admin, error) {
+	tlsConfig, err := admin.TLSConfig(cfg.TLS.AdminClientCAFile, cfg.Auth.AdminToken == "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if certs != nil {
+		tlsConfig.GetCertificate = certs.GetCertificate
+	}
+	router := admin.NewRouter(
+		store,
+		batchDeleter,
+		admin.WithToken(cfg.Auth.AdminToken),
+		admin.WithMetrics(m),
+		admin.WithConfig(config.Redacted(cfg)),
+	)
+	return &http.Server{
+		Addr:      cfg.Server.AdminAddress,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}, router, nil
+}
+
+// reloadOnSignal reads config again on SIGHUP and applies changes, which are safe at runtime.
+// Invalid config is rejected, changes requiring restart are reported and ignored.
+// Certificates are loaded from their files again
+func reloadOnSignal(
+	ctx context.Context,
+	cfg config.EnvConfig,
+	router *shortener.Shortener,
+	adminRouter *admin.Admin,
+	certs []*certmanager.Manager,
+) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		for _, m := range certs {
+			if err := m.Reload(); err != nil {
+				log.Println("ERROR: certificate reload:", err)
+			}
+		}
+		next, err := config.Reload()
+		if err != nil {
+			log.Println("Config rejected:", err)
+			continue
+		}
+		runtime, restart := config.Diff(cfg, next)
+		if len(restart) > 0 {
+			log.Println("Config changes require restart:", strings.Join(restart, ", "))
+		}
+		if len(runtime) == 0 {
+			log.Println("Config reloaded, no changes to apply")
+			continue
+		}
+		cfg = config.Merge(cfg, next)
+		router.Reload(
+			cfg.Server.BaseURL,
+			shortener.WithInterstitial(cfg.Server.AlwaysInterstitial),
+			shortener.WithRequestLog(cfg.Logging.RequestLog),
+			shortener.WithStripTrackingParams(cfg.Storage.StripTrackingParams),
+			shortener.WithDomains(cfg.Server.ShortDomains),
+		)
+		if adminRouter != nil {
+			adminRouter.Reload(admin.WithToken(cfg.Auth.AdminToken), admin.WithConfig(config.Redacted(cfg)))
+		}
+		log.Println("Config reloaded, applied:", strings.Join(runtime, ", "))
+	}
 }
 
 // initStorage initializes one of supported storagers
-func initStorage(cfg config.EnvConfig) (storage.Storager, error) {
-	if cfg.FileStoragePath != "" {
-		return storage.NewFileStorage(cfg.FileStoragePath)
+func initStorage(ctx context.Context, cfg config.EnvConfig) (storage.Storager, error) {
+	dedupScope, err := storage.ParseDedupScope(cfg.Storage.DedupScope)
+	if err != nil {
+		return nil, err
 	}
-	if cfg.DatabaseDSN != "" {
-		return storage.NewDBStorage(cfg.DatabaseDSN, "migrations")
+
+	if cfg.Storage.FilePath != "" {
+		store, err := storage.NewFileStorage(cfg.Storage.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		store.SetDedupScope(dedupScope)
+		return store, nil
+	}
+	if cfg.Storage.DatabaseDSN != "" {
+		store, err := storage.NewDBStorage(cfg.Storage.DatabaseDSN, "migrations")
+		if err != nil {
+			return nil, err
+		}
+		store.SetDedupScope(dedupScope)
+		if err = store.SyncDedupScope(ctx); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return store, nil
 	}
 
-	return storage.NewMemoryStorage(nil), nil
+	store := storage.NewMemoryStorage(nil)
+	store.SetDedupScope(dedupScope)
+	return store, nil
 }
@@ -0,0 +1,198 @@
+// Package certmanager serves TLS certificates loaded from files and reloads them, when the files change,
+// so renewed certificates are used without restart of the server
+package certmanager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Manager keeps certificate loaded from the cert and key files. Failed reload keeps previous certificate
+type Manager struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Value // *tls.Certificate
+	mu       sync.Mutex
+	modTime  [2]time.Time
+}
+
+// New loads certificate from the files
+func New(certFile, keyFile string) (*Manager, error) {
+	m := &Manager{certFile: certFile, keyFile: keyFile}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload loads certificate from the files
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modTime, err := m.modTimes()
+	if err != nil {
+		return err
+	}
+	return m.load(modTime)
+}
+
+// reloadIfChanged loads certificate, if any of the files changed since the last load
+func (m *Manager) reloadIfChanged() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modTime, err := m.modTimes()
+	if err != nil {
+		return false, err
+	}
+	if modTime == m.modTime {
+		return false, nil
+	}
+	return true, m.load(modTime)
+}
+
+func (m *Manager) load(modTime [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(m.certFile, m.keyFile)
+	if err != nil {
+		return err
+	}
+	m.cert.Store(&cert)
+	m.modTime = modTime
+	return nil
+}
+
+func (m *Manager) modTimes() ([2]time.Time, error) {
+	var modTime [2]time.Time
+	for i, file := range []string{m.certFile, m.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTime, err
+		}
+		modTime[i] = info.ModTime()
+	}
+	return modTime, nil
+}
+
+// Watch checks files every interval and reloads certificate on changes, until ctx is done.
+// Certificate written partially is loaded on the next check
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := m.reloadIfChanged()
+		if err != nil {
+			log.Println("ERROR: certificate reload:", err)
+			continue
+		}
+		if reloaded {
+			log.Println("Certificate reloaded:", m.certFile)
+		}
+	}
+}
+
+// GetCertificate returns current certificate, it is used as tls.Config.GetCertificate
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.cert.Load().(*tls.Certificate), nil
+}
+
+// Options of the TLS server
+type Options struct {
+	// MinVersion is minimal TLS version: 1.0, 1.1, 1.2 or 1.3. Empty means 1.2
+	MinVersion string
+	// CipherSuites are names of the allowed cipher suites of TLS 1.0-1.2, empty means Go defaults
+	CipherSuites []string
+	// ClientCAFile verifies client certificates by the CA bundle. Clients without certificates are allowed
+	ClientCAFile string
+}
+
+// ServerConfig returns config of the TLS server with certificates of the manager
+func (m *Manager) ServerConfig(opts Options) (*tls.Config, error) {
+	version, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:     version,
+		CipherSuites:   suites,
+		GetCertificate: m.GetCertificate,
+	}
+	if opts.ClientCAFile != "" {
+		cfg.ClientCAs, err = LoadCertPool(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion returns TLS version by its number, like 1.2. Empty version means 1.2
+func ParseVersion(version string) (uint16, error) {
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	v, ok := versions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites returns ids of the cipher suites by names, like TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256.
+// Only suites without known security issues are accepted
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// LoadCertPool reads PEM encoded certificates of the CA bundle
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+	return pool, nil
+}
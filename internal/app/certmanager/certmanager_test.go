@@ -0,0 +1,151 @@
+package certmanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes certificate signed by parent, or self-signed if parent is nil, and its key
+func writeCert(t *testing.T, dir, name string, serial int64, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func serialOf(t *testing.T, m *Manager) int64 {
+	cert, err := m.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
+
+func TestManager_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeCert(t, dir, "server", 1, false, nil, nil)
+
+	m, err := New(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), serialOf(t, m))
+
+	reloaded, err := m.reloadIfChanged()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "files are not changed")
+
+	writeCert(t, dir, "server", 2, false, nil, nil)
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	reloaded, err = m.reloadIfChanged()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, int64(2), serialOf(t, m))
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	assert.Error(t, m.Reload())
+	assert.Equal(t, int64(2), serialOf(t, m), "failed reload keeps previous certificate")
+
+	_, err = New(filepath.Join(dir, "missing.crt"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestManager_ServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", 1, true, nil, nil)
+	writeCert(t, dir, "server", 2, false, ca, caKey)
+	writeCert(t, dir, "client", 3, false, ca, caKey)
+
+	m, err := New(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	require.NoError(t, err)
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := m.ServerConfig(Options{MinVersion: "2.0"})
+		assert.Error(t, err)
+		_, err = m.ServerConfig(Options{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}})
+		assert.Error(t, err, "insecure suites are rejected")
+		_, err = m.ServerConfig(Options{ClientCAFile: filepath.Join(dir, "server.key")})
+		assert.Error(t, err)
+	})
+
+	cfg, err := m.ServerConfig(Options{
+		MinVersion:   "1.2",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, cfg.CipherSuites)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) > 0 {
+			w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}
+	}))
+	// StartTLS replaces certificates of the config, so listener is wrapped instead
+	srv.Listener = tls.NewListener(srv.Listener, cfg)
+	srv.Start()
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "http://", "https://", 1)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	require.NoError(t, err)
+
+	for name, certs := range map[string][]tls.Certificate{"anonymous": nil, "client": {clientCert}} {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		if name == "anonymous" {
+			assert.Empty(t, body, "clients without certificates are allowed")
+		} else {
+			assert.Equal(t, "client", string(body))
+		}
+	}
+}
@@ -34,6 +34,12 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Domain of the short url, domain of the request host if empty",
+                        "name": "domain",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -44,7 +50,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "invalid url: http//example",
+                        "description": "unknown domain: example.com",
                         "schema": {
                             "type": "string"
                         }
@@ -137,7 +143,16 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "201": {
-                        "description": "Created",
+                        "description": "All urls saved",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.CreateShortBatchResponseItem"
+                            }
+                        }
+                    },
+                    "207": {
+                        "description": "Some urls saved, others were added earlier or have errors",
                         "schema": {
                             "type": "array",
                             "items": {
@@ -151,6 +166,198 @@ const docTemplate = `{
                             "$ref": "#/definitions/responses.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "All urls were added earlier, old short urls are returned",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.CreateShortBatchResponseItem"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/shorten/bulk": {
+            "post": {
+                "description": "Lines are read in NDJSON format or CSV with \"correlation_id,original_url[,alias]\" columns.\nLines are stored in chunks, so the import is not atomic: results of the stored lines are returned even if\nthe import is interrupted.",
+                "consumes": [
+                    "application/x-ndjson",
+                    "text/csv"
+                ],
+                "produces": [
+                    "application/x-ndjson"
+                ],
+                "summary": "Import many urls, results are streamed back line by line",
+                "parameters": [
+                    {
+                        "description": "Lines of the import",
+                        "name": "lines",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.BulkItem"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Domain of the short urls, domain of the request host if empty",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "One result per line",
+                        "schema": {
+                            "$ref": "#/definitions/responses.BulkResultItem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get id of the current user, which is used to invite the user to workspaces",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/responses.UserResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/campaigns": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get urls user shortened with UTM tags, grouped by campaign",
+                "responses": {
+                    "200": {
+                        "description": "List of campaigns with urls",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.CampaignItem"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "No Content. User not added any tagged urls yet"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/claim": {
+            "post": {
+                "description": "Urls and workspaces of the current user are moved to the user, who issued the code,\nand the browser is switched to that user with new auth cookie",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Redeem claim code issued in another browser",
+                "parameters": [
+                    {
+                        "description": "Claim code",
+                        "name": "claim",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.ClaimRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ClaimResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Code is invalid, expired or issued by the current user",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Users of client certificates can't be linked",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many failed attempts",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/claim-codes": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Issue short-lived code, which moves urls of another browser to the current user",
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ClaimCodeResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Users of client certificates can't be linked",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -203,7 +410,7 @@ const docTemplate = `{
                 "summary": "Delete urls user shortened earlier",
                 "parameters": [
                     {
-                        "description": "List of urls to delete",
+                        "description": "List of shorts to delete from the domain of the request host",
                         "name": "deleteURLs",
                         "in": "body",
                         "required": true,
@@ -234,34 +441,63 @@ const docTemplate = `{
                 }
             }
         },
-        "/ping": {
+        "/api/user/urls/export": {
             "get": {
+                "description": "Records are streamed, so the response is truncated if error occurs during the export",
                 "produces": [
-                    "text/plain"
+                    "application/json",
+                    "application/x-ndjson",
+                    "text/csv"
+                ],
+                "summary": "Export all urls user shortened, including deleted ones",
+                "parameters": [
+                    {
+                        "enum": [
+                            "json",
+                            "ndjson",
+                            "csv"
+                        ],
+                        "type": "string",
+                        "description": "Format of the export, json by default",
+                        "name": "format",
+                        "in": "query"
+                    }
                 ],
-                "summary": "returns \"OK\" if service is working and storage is available",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.ExportItem"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "DB unavailable",
+                        "description": "Internal Server Error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/responses.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/{id}": {
-            "get": {
+        "/api/user/urls/{id}": {
+            "patch": {
+                "description": "Urls of the workspace can be changed by its editors and admins",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
-                "summary": "Redirects to the full url, if found in storage by {id}",
+                "summary": "Change settings of the url user shortened earlier",
                 "parameters": [
                     {
                         "type": "string",
@@ -269,75 +505,830 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Changed settings",
+                        "name": "settings",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.UpdateShortRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "307": {
-                        "description": "redirects to full url",
-                        "headers": {
-                            "Location": {
-                                "type": "string",
-                                "description": "http://example.com/"
-                            }
+                    "200": {
+                        "description": "Updated url",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ShortInfoResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad request",
+                        "description": "Bad Request",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "Not found",
+                        "description": "Not Found",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/responses.ErrorResponse"
                         }
                     },
-                    "410": {
-                        "description": "Record has been deleted",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/responses.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "requests.CreateShortBatchItem": {
-            "type": "object",
-            "properties": {
-                "correlation_id": {
-                    "type": "string"
-                },
-                "original_url": {
-                    "type": "string"
-                }
-            }
-        },
-        "requests.CreateShortRequest": {
-            "type": "object",
-            "properties": {
-                "url": {
-                    "type": "string",
-                    "example": "http://example.com/asd"
-                }
-            }
-        },
-        "responses.CreateShortBatchResponseItem": {
-            "type": "object",
-            "properties": {
-                "correlation_id": {
-                    "type": "string"
-                },
-                "short_url": {
-                    "type": "string"
-                }
-            }
+        },
+        "/api/workspaces": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get workspaces of the current user",
+                "responses": {
+                    "200": {
+                        "description": "Workspaces with roles of the user",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.WorkspaceItem"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "No Content. User isn't member of any workspace"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create workspace, current user becomes its admin",
+                "parameters": [
+                    {
+                        "description": "Workspace",
+                        "name": "workspace",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.CreateWorkspaceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created workspace",
+                        "schema": {
+                            "$ref": "#/definitions/responses.WorkspaceItem"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/workspaces/{workspace}/members": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get members of the workspace, viewer role is required",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "workspace id",
+                        "name": "workspace",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Members with their roles",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.MemberItem"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/workspaces/{workspace}/members/{user}": {
+            "put": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Invite user to the workspace or change role of the member, admin role is required",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "workspace id",
+                        "name": "workspace",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "user",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Role of the member",
+                        "name": "role",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.SetMemberRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Member with the new role",
+                        "schema": {
+                            "$ref": "#/definitions/responses.MemberItem"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The last admin can't be demoted",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Remove user from the workspace, admin role is required",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "workspace id",
+                        "name": "workspace",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "user id",
+                        "name": "user",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Member removed"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The last admin can't be removed",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/workspaces/{workspace}/urls": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get urls of the workspace, viewer role is required",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "workspace id",
+                        "name": "workspace",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "List of urls of the workspace",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.ListShortItem"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "No Content. Workspace has no urls yet"
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete urls of the workspace, editor role is required",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "workspace id",
+                        "name": "workspace",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "List of shorts to delete from the domain of the request host",
+                        "name": "deleteURLs",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Urls deleted"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Url doesn't belong to the workspace",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ping": {
+            "get": {
+                "produces": [
+                    "text/plain"
+                ],
+                "summary": "returns \"OK\" if service is working and storage is available",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "DB unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/{id}": {
+            "get": {
+                "description": "Redirect status and passing of the query to the full url are configured per url.\nIf {id} ends with \"+\", preview page of the link is shown instead of redirect.\nInterstitial page is shown before redirect, if it's enabled for the link or globally.\n{id} is looked up in the short domain of the Host header.",
+                "produces": [
+                    "text/plain",
+                    "text/html"
+                ],
+                "summary": "Redirects to the full url, if found in storage by {id}",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "url id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "preview or interstitial page"
+                    },
+                    "301": {
+                        "description": "redirects to full url"
+                    },
+                    "302": {
+                        "description": "redirects to full url"
+                    },
+                    "307": {
+                        "description": "redirects to full url",
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "http://example.com/"
+                            }
+                        }
+                    },
+                    "308": {
+                        "description": "redirects to full url"
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "410": {
+                        "description": "Link has been disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/{id}/qr": {
+            "get": {
+                "produces": [
+                    "image/png",
+                    "image/svg+xml"
+                ],
+                "summary": "Renders QR code of the short url",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "url id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "png",
+                        "description": "Image format: png or svg",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 256,
+                        "description": "Image width and height in pixels",
+                        "name": "size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 4,
+                        "description": "Quiet zone width in modules",
+                        "name": "margin",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "M",
+                        "description": "Error correction level: L, M, Q or H",
+                        "name": "level",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "QR code image"
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "410": {
+                        "description": "Record has been deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "requests.BulkItem": {
+            "type": "object",
+            "properties": {
+                "alias": {
+                    "description": "Alias is the short of the url, generated if empty",
+                    "type": "string",
+                    "example": "my-link"
+                },
+                "correlation_id": {
+                    "type": "string"
+                },
+                "original_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "requests.ClaimRequest": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "K7QX-M2PA-9HTR"
+                }
+            }
+        },
+        "requests.CreateShortBatchItem": {
+            "type": "object",
+            "properties": {
+                "correlation_id": {
+                    "type": "string"
+                },
+                "domain": {
+                    "description": "Domain of the short url from the allowed domains, domain of the request host if empty",
+                    "type": "string",
+                    "example": "go.example.com"
+                },
+                "interstitial": {
+                    "description": "Interstitial shows \"you are leaving\" page before redirect",
+                    "type": "boolean"
+                },
+                "max_clicks": {
+                    "description": "MaxClicks makes link self-destruct after number of redirects, 0 - unlimited",
+                    "type": "integer",
+                    "example": 1
+                },
+                "original_url": {
+                    "type": "string"
+                },
+                "passthrough": {
+                    "description": "Passthrough passes query of the short url to the full url: \"merge\" - params of the full url take precedence,\n\"override\" - params of the short url take precedence. Empty - query is ignored",
+                    "type": "string",
+                    "enum": [
+                        "merge",
+                        "override"
+                    ],
+                    "example": "merge"
+                },
+                "redirect_status": {
+                    "description": "RedirectStatus is http status of redirect: 301, 302, 307 or 308. Default is 307",
+                    "type": "integer",
+                    "example": 301
+                },
+                "utm": {
+                    "$ref": "#/definitions/utm.Tags"
+                },
+                "workspace": {
+                    "description": "Workspace shares the url with members of the workspace, editor role is required",
+                    "type": "string",
+                    "example": "5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"
+                }
+            }
+        },
+        "requests.CreateShortRequest": {
+            "type": "object",
+            "properties": {
+                "domain": {
+                    "description": "Domain of the short url from the allowed domains, domain of the request host if empty",
+                    "type": "string",
+                    "example": "go.example.com"
+                },
+                "interstitial": {
+                    "description": "Interstitial shows \"you are leaving\" page before redirect",
+                    "type": "boolean"
+                },
+                "max_clicks": {
+                    "description": "MaxClicks makes link self-destruct after number of redirects, 0 - unlimited",
+                    "type": "integer",
+                    "example": 1
+                },
+                "passthrough": {
+                    "description": "Passthrough passes query of the short url to the full url: \"merge\" - params of the full url take precedence,\n\"override\" - params of the short url take precedence. Empty - query is ignored",
+                    "type": "string",
+                    "enum": [
+                        "merge",
+                        "override"
+                    ],
+                    "example": "merge"
+                },
+                "qr": {
+                    "description": "QR requests link to the QR code image of the short url in response",
+                    "type": "boolean"
+                },
+                "redirect_status": {
+                    "description": "RedirectStatus is http status of redirect: 301, 302, 307 or 308. Default is 307",
+                    "type": "integer",
+                    "example": 301
+                },
+                "url": {
+                    "type": "string",
+                    "example": "http://example.com/asd"
+                },
+                "utm": {
+                    "description": "UTM tags are added to the url, source is required",
+                    "$ref": "#/definitions/utm.Tags"
+                },
+                "workspace": {
+                    "description": "Workspace shares the url with members of the workspace, editor role is required",
+                    "type": "string",
+                    "example": "5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"
+                }
+            }
+        },
+        "requests.CreateWorkspaceRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "Marketing"
+                }
+            }
+        },
+        "requests.SetMemberRequest": {
+            "type": "object",
+            "properties": {
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "viewer",
+                        "editor",
+                        "admin"
+                    ],
+                    "example": "editor"
+                }
+            }
+        },
+        "requests.UpdateShortRequest": {
+            "type": "object",
+            "properties": {
+                "interstitial": {
+                    "type": "boolean"
+                },
+                "max_clicks": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "passthrough": {
+                    "type": "string",
+                    "enum": [
+                        "",
+                        "merge",
+                        "override"
+                    ],
+                    "example": "override"
+                },
+                "redirect_status": {
+                    "type": "integer",
+                    "example": 308
+                }
+            }
+        },
+        "responses.BulkResultItem": {
+            "type": "object",
+            "properties": {
+                "conflict": {
+                    "description": "Conflict is true, when url was added earlier, old short url is returned",
+                    "type": "boolean"
+                },
+                "correlation_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error describes why url of the line was not saved",
+                    "type": "string",
+                    "example": "invalid url: http//example"
+                },
+                "line": {
+                    "description": "Line is number of the line in the import, 0 if error is not related to a line",
+                    "type": "integer"
+                },
+                "short_url": {
+                    "type": "string"
+                }
+            }
+        },
+        "responses.CampaignItem": {
+            "type": "object",
+            "properties": {
+                "campaign": {
+                    "type": "string",
+                    "example": "spring_sale"
+                },
+                "urls": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/responses.ListShortItem"
+                    }
+                }
+            }
+        },
+        "responses.ClaimCodeResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code is redeemed in another browser to move its urls to the current user",
+                    "type": "string",
+                    "example": "K7QXM2PA9HTR"
+                },
+                "expires_at": {
+                    "type": "string",
+                    "example": "2022-01-07T00:21:53Z"
+                }
+            }
+        },
+        "responses.ClaimResponse": {
+            "type": "object",
+            "properties": {
+                "records": {
+                    "description": "Records is number of moved urls",
+                    "type": "integer",
+                    "example": 3
+                },
+                "skipped": {
+                    "description": "Skipped is number of urls, which the user has shortened already, they aren't moved",
+                    "type": "integer",
+                    "example": 1
+                },
+                "user_id": {
+                    "description": "UserID is user, the browser is switched to",
+                    "type": "string",
+                    "example": "0d2d0c2e-8c7a-4f43-9d1c-7c2f7f3a0b4e"
+                }
+            }
+        },
+        "responses.CreateShortBatchResponseItem": {
+            "type": "object",
+            "properties": {
+                "conflict": {
+                    "description": "Conflict is true, when url was added earlier, old short url is returned",
+                    "type": "boolean"
+                },
+                "correlation_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error describes why url of the item was not saved",
+                    "type": "string",
+                    "example": "invalid url: http//example"
+                },
+                "short_url": {
+                    "type": "string"
+                }
+            }
         },
         "responses.CreateShortResponse": {
             "type": "object",
             "properties": {
+                "dedup_scope": {
+                    "description": "DedupScope is set on conflict: \"global\" - url was shortened by any user, \"user\" - by the current user",
+                    "type": "string",
+                    "enum": [
+                        "global",
+                        "user"
+                    ],
+                    "example": "user"
+                },
+                "qr": {
+                    "type": "string",
+                    "example": "http://shortener.org/123/qr"
+                },
                 "result": {
                     "type": "string",
                     "example": "http://shortener.org/123"
@@ -353,18 +1344,160 @@ const docTemplate = `{
                 }
             }
         },
+        "responses.ExportItem": {
+            "type": "object",
+            "properties": {
+                "clicks": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2022-01-07T00:11:53Z"
+                },
+                "deleted": {
+                    "type": "boolean"
+                },
+                "original_url": {
+                    "type": "string",
+                    "example": "http://example.com/"
+                },
+                "short_url": {
+                    "type": "string",
+                    "example": "http://shortener.org/123"
+                }
+            }
+        },
         "responses.ListShortItem": {
             "type": "object",
             "properties": {
+                "base_url": {
+                    "description": "BaseURL is original url without UTM tags",
+                    "type": "string",
+                    "example": "http://example.com/"
+                },
+                "original_url": {
+                    "type": "string",
+                    "example": "http://example.com/"
+                },
+                "short_url": {
+                    "type": "string",
+                    "example": "http://shortener.org/123"
+                },
+                "utm": {
+                    "$ref": "#/definitions/utm.Tags"
+                },
+                "workspace_id": {
+                    "description": "WorkspaceID is workspace sharing the url, empty for personal urls",
+                    "type": "string",
+                    "example": "5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"
+                }
+            }
+        },
+        "responses.MemberItem": {
+            "type": "object",
+            "properties": {
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "viewer",
+                        "editor",
+                        "admin"
+                    ],
+                    "example": "editor"
+                },
+                "user_id": {
+                    "type": "string",
+                    "example": "0d2d0c2e-8c7a-4f43-9d1c-7c2f7f3a0b4e"
+                }
+            }
+        },
+        "responses.ShortInfoResponse": {
+            "type": "object",
+            "properties": {
+                "clicks": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "interstitial": {
+                    "type": "boolean"
+                },
+                "max_clicks": {
+                    "type": "integer",
+                    "example": 10
+                },
                 "original_url": {
                     "type": "string",
                     "example": "http://example.com/"
                 },
+                "passthrough": {
+                    "type": "string",
+                    "example": "merge"
+                },
+                "redirect_status": {
+                    "type": "integer",
+                    "example": 307
+                },
                 "short_url": {
                     "type": "string",
                     "example": "http://shortener.org/123"
                 }
             }
+        },
+        "responses.UserResponse": {
+            "type": "object",
+            "properties": {
+                "user_id": {
+                    "type": "string",
+                    "example": "0d2d0c2e-8c7a-4f43-9d1c-7c2f7f3a0b4e"
+                }
+            }
+        },
+        "responses.WorkspaceItem": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2022-01-07T00:11:53Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Marketing"
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "viewer",
+                        "editor",
+                        "admin"
+                    ],
+                    "example": "admin"
+                }
+            }
+        },
+        "utm.Tags": {
+            "type": "object",
+            "properties": {
+                "campaign": {
+                    "type": "string"
+                },
+                "content": {
+                    "type": "string"
+                },
+                "medium": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "term": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,102 @@
+// Package domains keeps short domains served by the shortener besides the domain of the base url.
+// Records of the domain of the base url have empty domain, so they don't change, when base url changes
+package domains
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrUnknownDomain is returned for domains missing in the registry
+var ErrUnknownDomain = errors.New("unknown domain")
+
+// Resolver finds domains of the requests
+type Resolver interface {
+	// FromHost returns domain served on the host of the request, empty for the base url and unknown hosts
+	FromHost(host string) string
+	// Lookup returns domain chosen by the user. Empty name and host of the base url mean domain of the base url
+	Lookup(name string) (string, error)
+}
+
+// Registry of the allowed short domains
+type Registry struct {
+	baseURL  string
+	baseHost string
+	scheme   string
+	domains  map[string]bool
+	names    []string
+}
+
+var _ Resolver = &Registry{}
+
+// NewRegistry creates registry of the domains. Short urls of the domains use scheme of the base url
+func NewRegistry(baseURL string, names []string) *Registry {
+	r := &Registry{baseURL: baseURL, scheme: "http", domains: make(map[string]bool, len(names))}
+	if u, err := url.Parse(baseURL); err == nil {
+		r.baseHost = strings.ToLower(u.Host)
+		if u.Scheme != "" {
+			r.scheme = u.Scheme
+		}
+	}
+	for _, name := range names {
+		name = normalize(name)
+		if name != "" && name != r.baseHost && !r.domains[name] {
+			r.domains[name] = true
+			r.names = append(r.names, name)
+		}
+	}
+	return r
+}
+
+// Names returns registered domains in the order they were passed to NewRegistry
+func (r *Registry) Names() []string {
+	return r.names
+}
+
+// FromHost returns domain of the registered host. Host is matched with port first, then without it
+func (r *Registry) FromHost(host string) string {
+	host = normalize(host)
+	if r.domains[host] {
+		return host
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil && r.domains[hostname] {
+		return hostname
+	}
+	return ""
+}
+
+// Lookup returns domain by name or ErrUnknownDomain
+func (r *Registry) Lookup(name string) (string, error) {
+	name = normalize(name)
+	if name == "" || name == r.baseHost {
+		return "", nil
+	}
+	if !r.domains[name] {
+		return "", fmt.Errorf("%w: %s", ErrUnknownDomain, name)
+	}
+	return name, nil
+}
+
+// URL returns absolute short url of the short on the domain
+func (r *Registry) URL(domain, short string) string {
+	if domain == "" {
+		return fmt.Sprintf("%s/%s", r.baseURL, short)
+	}
+	return fmt.Sprintf("%s://%s/%s", r.scheme, domain, short)
+}
+
+// ValidateName checks, that name is host with optional port, like go.example.com or go.example.com:8080
+func ValidateName(name string) error {
+	u, err := url.Parse("//" + name)
+	if err != nil || name == "" || u.Host != name || u.User != nil {
+		return fmt.Errorf("invalid domain %q, expected host with optional port", name)
+	}
+	return nil
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
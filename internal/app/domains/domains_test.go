@@ -0,0 +1,49 @@
+package domains
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry("https://sho.rt", []string{"Go.Example.com", "links.example.org:8443", "sho.rt", "go.example.com"})
+	assert.Equal(t, []string{"go.example.com", "links.example.org:8443"}, r.Names(), "base url host and duplicates are skipped")
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"go.example.com", "go.example.com"},
+		{"GO.example.com:8080", "go.example.com"},
+		{"links.example.org:8443", "links.example.org:8443"},
+		{"links.example.org", ""},
+		{"sho.rt", ""},
+		{"unknown.example.com", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, r.FromHost(tt.host), tt.host)
+	}
+
+	domain, err := r.Lookup("go.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "go.example.com", domain)
+	domain, err = r.Lookup("sho.rt")
+	require.NoError(t, err)
+	assert.Empty(t, domain, "host of the base url is the default domain")
+	_, err = r.Lookup("evil.example.com")
+	assert.ErrorIs(t, err, ErrUnknownDomain)
+
+	assert.Equal(t, "https://sho.rt/abc", r.URL("", "abc"))
+	assert.Equal(t, "https://go.example.com/abc", r.URL("go.example.com", "abc"))
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"go.example.com", "go.example.com:8080", "localhost"} {
+		assert.NoError(t, ValidateName(name), name)
+	}
+	for _, name := range []string{"", "https://go.example.com", "go.example.com/path", "user@go.example.com"} {
+		assert.Error(t, ValidateName(name), name)
+	}
+}
@@ -0,0 +1,178 @@
+// Package loadgen sends synthetic or replayed workload to the shortener and measures latencies of the requests
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config of the load run
+type Config struct {
+	// Target is base url of the shortener, e.g. "http://localhost:8080"
+	Target string
+	// Transport sends requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// Concurrency is number of workers, each worker acts as a separate user
+	Concurrency int
+	// Rate limits requests per second of all workers, 0 - unlimited
+	Rate float64
+	// Requests limits number of requests, 0 - unlimited
+	Requests int64
+	// Duration limits time of the run, 0 - unlimited
+	Duration time.Duration
+	// Seed of the random operations of the synthetic workload
+	Seed     int64
+	Workload Workload
+}
+
+// HandlerTransport serves requests with the handler in-process, without network
+type HandlerTransport struct {
+	Handler http.Handler
+}
+
+func (t HandlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.Handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// Run sends the workload until it's over, limits are reached or ctx is canceled
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	if cfg.Concurrency <= 0 {
+		return Report{}, errors.New("concurrency must be positive")
+	}
+	if cfg.Workload == nil {
+		return Report{}, errors.New("workload is not set")
+	}
+	// only replay without loop is over by itself
+	replay, isReplay := cfg.Workload.(*Replay)
+	if cfg.Requests == 0 && cfg.Duration == 0 && (!isReplay || replay.Loop) {
+		return Report{}, errors.New("requests or duration limit is required")
+	}
+	transport := cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	target := strings.TrimSuffix(cfg.Target, "/")
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var tokens <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	rec := newRecorder()
+	var issued int64
+	wg := sync.WaitGroup{}
+	started := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return Report{}, err
+		}
+		w := worker{
+			target:   target,
+			workload: cfg.Workload,
+			recorder: rec,
+			session:  &Session{Rand: rand.New(rand.NewSource(cfg.Seed + int64(i)))},
+			client: &http.Client{
+				Transport: transport,
+				Jar:       jar,
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				if cfg.Requests > 0 && atomic.AddInt64(&issued, 1) > cfg.Requests {
+					return
+				}
+				if !w.step(ctx) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return rec.report(time.Since(started)), nil
+}
+
+type worker struct {
+	target   string
+	workload Workload
+	recorder *recorder
+	session  *Session
+	client   *http.Client
+}
+
+// step sends next request of the workload, returns false when the workload is over
+func (w worker) step(ctx context.Context) bool {
+	req, ok := w.workload.Next(w.session)
+	if !ok {
+		return false
+	}
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, w.target+req.Path, body)
+	if err != nil {
+		w.recorder.record(req.Op, 0, 0, err)
+		return true
+	}
+	if req.ContentType != "" {
+		httpReq.Header.Set("Content-Type", req.ContentType)
+	}
+
+	started := time.Now()
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		// requests interrupted by the end of the run are not counted
+		if ctx.Err() == nil {
+			w.recorder.record(req.Op, time.Since(started), 0, err)
+		}
+		return true
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	latency := time.Since(started)
+	if err != nil && ctx.Err() != nil {
+		return true
+	}
+	w.recorder.record(req.Op, latency, resp.StatusCode, err)
+	w.workload.Observe(w.session, req, resp.StatusCode, data)
+	return true
+}
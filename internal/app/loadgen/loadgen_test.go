@@ -0,0 +1,134 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/putalexey/go-practicum/internal/app/shortener"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+func newTransport() http.RoundTripper {
+	router := shortener.NewRouter(context.Background(), "http://loadgen.local", storage.NewMemoryStorage(nil),
+		shortener.WithRequestLog(false))
+	return HandlerTransport{Handler: router}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(latencies, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(latencies, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(latencies, 100))
+	assert.Equal(t, time.Millisecond, percentile(latencies[:1], 90))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("create=40, redirect=50,list=10")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{OpCreate: 40, OpRedirect: 50, OpList: 10}, mix)
+
+	for _, s := range []string{"create", "create=a", "create=-1", "unknown=1"} {
+		_, err = ParseMix(s)
+		assert.Error(t, err, s)
+	}
+	_, err = NewSynthetic(map[string]int{OpCreate: 0}, 10)
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("synthetic workload", func(t *testing.T) {
+		mix, err := ParseMix("create=30,batch=10,redirect=40,list=10,delete=10")
+		require.NoError(t, err)
+		workload, err := NewSynthetic(mix, 5)
+		require.NoError(t, err)
+
+		report, err := Run(ctx, Config{
+			Target:      "http://loadgen.local",
+			Transport:   newTransport(),
+			Concurrency: 4,
+			Requests:    200,
+			Workload:    workload,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 200, report.Total.Count)
+		assert.Equal(t, 0, report.Total.Errors)
+		assert.Greater(t, report.RPS(), 0.0)
+
+		counts := make(map[string]int)
+		for _, op := range report.Ops {
+			counts[op.Op] = op.Count
+			assert.LessOrEqual(t, op.P50, op.P99)
+			assert.LessOrEqual(t, op.P99, op.Max)
+		}
+		assert.Greater(t, counts[OpRedirect], 0)
+		assert.Equal(t, counts[OpRedirect], report.Ops[indexOf(report.Ops, OpRedirect)].Statuses[http.StatusTemporaryRedirect])
+	})
+
+	t.Run("replay log", func(t *testing.T) {
+		workload, err := ReadReplay(strings.NewReader(`{"method":"POST","path":"/","body":"https://example.com"}
+
+{"method":"GET","path":"/ping"}
+{"method":"GET","path":"/unknown"}
+`))
+		require.NoError(t, err)
+
+		report, err := Run(ctx, Config{
+			Target:      "http://loadgen.local",
+			Transport:   newTransport(),
+			Concurrency: 2,
+			Workload:    workload,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, report.Total.Count)
+		require.Len(t, report.Ops, 3)
+		assert.Equal(t, "GET /ping", report.Ops[0].Op)
+		assert.Equal(t, "GET /{id}", report.Ops[1].Op)
+		assert.Equal(t, 1, report.Ops[1].Statuses[http.StatusNotFound])
+		assert.Equal(t, "POST /", report.Ops[2].Op)
+		assert.Equal(t, 1, report.Ops[2].Statuses[http.StatusCreated])
+	})
+
+	t.Run("requires limit", func(t *testing.T) {
+		workload, err := NewSynthetic(map[string]int{OpList: 1}, 0)
+		require.NoError(t, err)
+		_, err = Run(ctx, Config{Concurrency: 1, Workload: workload})
+		assert.Error(t, err)
+	})
+
+	t.Run("limits rate", func(t *testing.T) {
+		workload, err := NewSynthetic(map[string]int{OpList: 1}, 0)
+		require.NoError(t, err)
+		report, err := Run(ctx, Config{
+			Target:      "http://loadgen.local",
+			Transport:   newTransport(),
+			Concurrency: 4,
+			Rate:        100,
+			Requests:    10,
+			Workload:    workload,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 10, report.Total.Count)
+		assert.GreaterOrEqual(t, report.Duration, 90*time.Millisecond)
+	})
+}
+
+func indexOf(ops []OpStats, op string) int {
+	for i := range ops {
+		if ops[i].Op == op {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,131 @@
+package loadgen
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OpStats are stats of the requests of one operation
+type OpStats struct {
+	Op    string
+	Count int
+	// Errors are requests failed with transport error or 5xx status
+	Errors int
+	// Statuses counts responses by status code, 0 is transport error
+	Statuses map[int]int
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// ErrorRate is share of the failed requests
+func (s OpStats) ErrorRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count)
+}
+
+// Report is result of the load run
+type Report struct {
+	Duration time.Duration
+	// Total is stats of all requests, Op is "total"
+	Total OpStats
+	// Ops are stats by operation, ordered by name
+	Ops []OpStats
+}
+
+// RPS is number of requests done per second
+func (r Report) RPS() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Total.Count) / r.Duration.Seconds()
+}
+
+type opRecord struct {
+	latencies []time.Duration
+	errors    int
+	statuses  map[int]int
+}
+
+// recorder collects latencies and statuses of the requests from all workers
+type recorder struct {
+	mu  sync.Mutex
+	ops map[string]*opRecord
+}
+
+func newRecorder() *recorder {
+	return &recorder{ops: make(map[string]*opRecord)}
+}
+
+func (r *recorder) record(op string, latency time.Duration, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.ops[op]
+	if !ok {
+		rec = &opRecord{statuses: make(map[int]int)}
+		r.ops[op] = rec
+	}
+	rec.latencies = append(rec.latencies, latency)
+	rec.statuses[status]++
+	if err != nil || status >= http.StatusInternalServerError {
+		rec.errors++
+	}
+}
+
+func (r *recorder) report(duration time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{Duration: duration}
+	total := &opRecord{statuses: make(map[int]int)}
+	for op, rec := range r.ops {
+		report.Ops = append(report.Ops, rec.stats(op))
+		total.latencies = append(total.latencies, rec.latencies...)
+		total.errors += rec.errors
+		for status, n := range rec.statuses {
+			total.statuses[status] += n
+		}
+	}
+	sort.Slice(report.Ops, func(i, j int) bool {
+		return report.Ops[i].Op < report.Ops[j].Op
+	})
+	report.Total = total.stats("total")
+	return report
+}
+
+func (rec *opRecord) stats(op string) OpStats {
+	sort.Slice(rec.latencies, func(i, j int) bool {
+		return rec.latencies[i] < rec.latencies[j]
+	})
+	stats := OpStats{
+		Op:       op,
+		Count:    len(rec.latencies),
+		Errors:   rec.errors,
+		Statuses: rec.statuses,
+		P50:      percentile(rec.latencies, 50),
+		P90:      percentile(rec.latencies, 90),
+		P99:      percentile(rec.latencies, 99),
+	}
+	if len(rec.latencies) > 0 {
+		stats.Max = rec.latencies[len(rec.latencies)-1]
+	}
+	return stats
+}
+
+// percentile returns nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
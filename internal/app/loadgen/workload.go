@@ -0,0 +1,249 @@
+package loadgen
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Synthetic operations
+const (
+	OpCreate   = "create"
+	OpBatch    = "batch"
+	OpRedirect = "redirect"
+	OpList     = "list"
+	OpDelete   = "delete"
+)
+
+// Request of the workload, it's also the line of the replay log
+type Request struct {
+	// Op is name of the operation in the report, derived from method and path if empty
+	Op          string `json:"op,omitempty"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// Session is state of the worker: the user it acts as and shorts the user created
+type Session struct {
+	Rand   *rand.Rand
+	Shorts []string
+}
+
+// Workload produces requests for the workers
+type Workload interface {
+	// Next returns next request of the session, false when the workload is over
+	Next(s *Session) (Request, bool)
+	// Observe is called with the response of the request
+	Observe(s *Session, req Request, status int, body []byte)
+}
+
+// Synthetic workload makes random operations with the weights of the mix
+type Synthetic struct {
+	// Mix is weight of the operation by its name
+	Mix map[string]int
+	// BatchSize is number of urls in the batch operation
+	BatchSize int
+
+	ops     []string
+	weights []int
+	total   int
+}
+
+// ParseMix parses mix like "create=40,redirect=50,list=10"
+func ParseMix(s string) (map[string]int, error) {
+	mix := make(map[string]int)
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid mix part: %q", part)
+		}
+		name, value := pair[0], pair[1]
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight of %s: %q", name, value)
+		}
+		switch name {
+		case OpCreate, OpBatch, OpRedirect, OpList, OpDelete:
+			mix[name] = weight
+		default:
+			return nil, fmt.Errorf("unknown operation: %s", name)
+		}
+	}
+	return mix, nil
+}
+
+// NewSynthetic creates workload with the mix of operations
+func NewSynthetic(mix map[string]int, batchSize int) (*Synthetic, error) {
+	w := &Synthetic{Mix: mix, BatchSize: batchSize}
+	if w.BatchSize <= 0 {
+		w.BatchSize = 10
+	}
+	for op := range mix {
+		w.ops = append(w.ops, op)
+	}
+	sort.Strings(w.ops)
+	for _, op := range w.ops {
+		w.total += mix[op]
+		w.weights = append(w.weights, w.total)
+	}
+	if w.total == 0 {
+		return nil, errors.New("mix has no operations")
+	}
+	return w, nil
+}
+
+func (w *Synthetic) Next(s *Session) (Request, bool) {
+	n := s.Rand.Intn(w.total)
+	op := w.ops[sort.SearchInts(w.weights, n+1)]
+	// redirect and delete need a short of the session, it's created first
+	if (op == OpRedirect || op == OpDelete) && len(s.Shorts) == 0 {
+		op = OpCreate
+	}
+
+	switch op {
+	case OpBatch:
+		items := make([]map[string]string, w.BatchSize)
+		for i := range items {
+			items[i] = map[string]string{"correlation_id": strconv.Itoa(i), "original_url": randomURL(s.Rand)}
+		}
+		return jsonRequest(op, http.MethodPost, "/api/shorten/batch", items), true
+	case OpRedirect:
+		return Request{Op: op, Method: http.MethodGet, Path: "/" + s.Shorts[s.Rand.Intn(len(s.Shorts))]}, true
+	case OpList:
+		return Request{Op: op, Method: http.MethodGet, Path: "/api/user/urls"}, true
+	case OpDelete:
+		i := s.Rand.Intn(len(s.Shorts))
+		short := s.Shorts[i]
+		s.Shorts[i] = s.Shorts[len(s.Shorts)-1]
+		s.Shorts = s.Shorts[:len(s.Shorts)-1]
+		return jsonRequest(op, http.MethodDelete, "/api/user/urls", []string{short}), true
+	default:
+		return jsonRequest(OpCreate, http.MethodPost, "/api/shorten", map[string]string{"url": randomURL(s.Rand)}), true
+	}
+}
+
+func (w *Synthetic) Observe(s *Session, req Request, status int, body []byte) {
+	switch req.Op {
+	case OpCreate:
+		response := struct {
+			Result string `json:"result"`
+		}{}
+		if json.Unmarshal(body, &response) == nil && response.Result != "" {
+			s.Shorts = append(s.Shorts, path.Base(response.Result))
+		}
+	case OpBatch:
+		response := make([]struct {
+			ShortURL string `json:"short_url"`
+		}, 0)
+		if json.Unmarshal(body, &response) == nil {
+			for _, item := range response {
+				if item.ShortURL != "" {
+					s.Shorts = append(s.Shorts, path.Base(item.ShortURL))
+				}
+			}
+		}
+	}
+}
+
+func jsonRequest(op, method, path string, body interface{}) Request {
+	data, _ := json.Marshal(body)
+	return Request{Op: op, Method: method, Path: path, ContentType: "application/json", Body: string(data)}
+}
+
+func randomURL(r *rand.Rand) string {
+	return fmt.Sprintf("https://example.com/%d/%d", r.Int63(), r.Int63())
+}
+
+// Replay workload sends requests of the log in order, shared by all sessions
+type Replay struct {
+	// Loop starts the log over when it's over
+	Loop bool
+
+	mu       sync.Mutex
+	requests []Request
+	next     int
+}
+
+// ReadReplay reads replay log, one json Request per line
+func ReadReplay(r io.Reader) (*Replay, error) {
+	w := &Replay{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		req := Request{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if req.Method == "" || !strings.HasPrefix(req.Path, "/") {
+			return nil, fmt.Errorf("line %d: method and absolute path are required", line)
+		}
+		if req.Op == "" {
+			req.Op = opName(req.Method, req.Path)
+		}
+		w.requests = append(w.requests, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(w.requests) == 0 {
+		return nil, errors.New("replay log is empty")
+	}
+	return w, nil
+}
+
+func (w *Replay) Next(_ *Session) (Request, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.next == len(w.requests) {
+		if !w.Loop {
+			return Request{}, false
+		}
+		w.next = 0
+	}
+	req := w.requests[w.next]
+	w.next++
+	return req, true
+}
+
+func (w *Replay) Observe(*Session, Request, int, []byte) {}
+
+// opName groups requests by route, short ids are replaced with {id}
+func opName(method, p string) string {
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		p = p[:i]
+	}
+	if p != "/" && p != "/ping" && !strings.HasPrefix(p, "/api/") {
+		switch {
+		case strings.HasSuffix(p, "/qr"):
+			p = "/{id}/qr"
+		case strings.HasSuffix(p, "+"):
+			p = "/{id}+"
+		default:
+			p = "/{id}"
+		}
+	}
+	if strings.HasPrefix(p, "/api/user/urls/") && p != "/api/user/urls/export" {
+		p = "/api/user/urls/{id}"
+	}
+	return method + " " + p
+}
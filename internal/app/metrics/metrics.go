@@ -0,0 +1,158 @@
+// Package metrics counts http requests of the service and writes them in Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type requestKey struct {
+	method string
+	route  string
+	code   int
+}
+
+type requestStats struct {
+	count    int64
+	duration time.Duration
+}
+
+// Metrics of the http requests
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]*requestStats
+	inFlight int64
+}
+
+func New() *Metrics {
+	return &Metrics{requests: make(map[requestKey]*requestStats)}
+}
+
+// statusWriter remembers status of the response
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes of the streaming handlers through
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Middleware counts requests by method, chi route pattern and status
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&m.inFlight, 1)
+		defer atomic.AddInt64(&m.inFlight, -1)
+
+		started := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		if sw.code == 0 {
+			sw.code = http.StatusOK
+		}
+		m.observe(requestKey{method: r.Method, route: route, code: sw.code}, time.Since(started))
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (m *Metrics) observe(key requestKey, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.requests[key]
+	if !ok {
+		st = &requestStats{}
+		m.requests[key] = st
+	}
+	st.count++
+	st.duration += duration
+}
+
+// WriteTo writes metrics in Prometheus text format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	stats := make(map[requestKey]requestStats, len(m.requests))
+	for key, st := range m.requests {
+		keys = append(keys, key)
+		stats[key] = *st
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	cw := &countingWriter{w: w}
+	fmt.Fprintln(cw, "# HELP shortener_http_requests_total Number of http requests.")
+	fmt.Fprintln(cw, "# TYPE shortener_http_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(cw, "shortener_http_requests_total{%s} %d\n", key.labels(), stats[key].count)
+	}
+	fmt.Fprintln(cw, "# HELP shortener_http_request_duration_seconds_sum Total time of http requests.")
+	fmt.Fprintln(cw, "# TYPE shortener_http_request_duration_seconds_sum counter")
+	for _, key := range keys {
+		fmt.Fprintf(cw, "shortener_http_request_duration_seconds_sum{%s} %g\n", key.labels(), stats[key].duration.Seconds())
+	}
+	fmt.Fprintln(cw, "# HELP shortener_http_requests_in_flight Number of http requests being served.")
+	fmt.Fprintln(cw, "# TYPE shortener_http_requests_in_flight gauge")
+	fmt.Fprintf(cw, "shortener_http_requests_in_flight %d\n", atomic.LoadInt64(&m.inFlight))
+	return cw.n, cw.err
+}
+
+func (k requestKey) labels() string {
+	return fmt.Sprintf("method=%s,route=%s,code=%q", strconv.Quote(k.method), strconv.Quote(k.route), strconv.Itoa(k.code))
+}
+
+// countingWriter counts written bytes and keeps the first error, so writes can be checked once
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://example.com", http.StatusTemporaryRedirect)
+	})
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/abc", nil),
+		httptest.NewRequest(http.MethodGet, "/def", nil),
+		httptest.NewRequest(http.MethodPost, "/", nil),
+		httptest.NewRequest(http.MethodGet, "/a/b", nil),
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := m.WriteTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	out := buf.String()
+	assert.Contains(t, out, `shortener_http_requests_total{method="GET",route="/{id}",code="307"} 2`)
+	assert.Contains(t, out, `shortener_http_requests_total{method="POST",route="/",code="200"} 1`)
+	assert.Contains(t, out, `shortener_http_requests_total{method="GET",route="unmatched",code="404"} 1`)
+	assert.Contains(t, out, "shortener_http_requests_in_flight 0")
+}
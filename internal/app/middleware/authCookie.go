@@ -17,18 +17,25 @@ var UIDKey = AuthKey("UID")
 
 // AuthCookie creates middleware that will create cookie with user authentication.
 // Middleware adds user id to the request context with key middleware.UIDKey. user id is UUID (Version 4)
-// keyString is used to encrypt cookie value.
+// keyString is used to encrypt cookie value. Requests with user id set by previous middleware are passed as is.
 func AuthCookie(cookieName string, keyString string) func(http.Handler) http.Handler {
-	tmp := sha256.Sum256([]byte(keyString))
-	key := tmp[:]
-
 	return func(next http.Handler) http.Handler {
-		handler := authCookieHandler{
-			next:       next,
-			cookieName: cookieName,
-			key:        key,
-		}
-		return handler
+		return newAuthCookieHandler(next, cookieName, keyString)
+	}
+}
+
+// NewAuthCookie creates cookie, which authenticates user with uid in AuthCookie middleware with the same
+// cookieName and keyString. It is used to switch browser to another user
+func NewAuthCookie(cookieName string, keyString string, uid string) (*http.Cookie, error) {
+	return newAuthCookieHandler(nil, cookieName, keyString).newCookie(uid)
+}
+
+func newAuthCookieHandler(next http.Handler, cookieName string, keyString string) authCookieHandler {
+	tmp := sha256.Sum256([]byte(keyString))
+	return authCookieHandler{
+		next:       next,
+		cookieName: cookieName,
+		key:        tmp[:],
 	}
 }
 
@@ -45,6 +52,11 @@ func (h authCookieHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err     error
 	)
 
+	if _, ok := r.Context().Value(UIDKey).(string); ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
 	// if cookie exists, but can't be decoded `http.ErrNoCookie` will be returned too
 	uid, err = h.findUIDInCookies(r) // r.Cookie(cookieName)
 	if err != nil {
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// ClientCertUIDPrefix separates user ids of the client certificates from ids of the cookies
+const ClientCertUIDPrefix = "cert:"
+
+// ClientCertUID creates middleware, which authenticates clients with certificates verified by the TLS server.
+// User id is common name of the certificate subject, or the whole subject if it has no common name,
+// prefixed with ClientCertUIDPrefix. It is added to the request context with key middleware.UIDKey,
+// so AuthCookie doesn't set cookie for such requests
+func ClientCertUID(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		subject := r.TLS.VerifiedChains[0][0].Subject
+		uid := subject.CommonName
+		if uid == "" {
+			uid = subject.String()
+		}
+		ctx := context.WithValue(r.Context(), UIDKey, ClientCertUIDPrefix+uid)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
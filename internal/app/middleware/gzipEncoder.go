@@ -16,6 +16,16 @@ func (w GZipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
+// Flush writes compressed data to the client, used by streaming handlers
+func (w GZipWriter) Flush() {
+	if f, ok := w.Writer.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // GZipEncoder middleware compresses response with gzip, if client accepts gzip encoding with "Accept-Encoding" header
 func GZipEncoder(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
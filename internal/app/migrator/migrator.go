@@ -0,0 +1,253 @@
+// Package migrator copies records between storages in batches, with checkpoints to resume interrupted migration
+// and verification of the copied data
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+// Options of the migration
+type Options struct {
+	// BatchSize is number of records written at once
+	BatchSize int
+	// DryRun only reads source, nothing is written to destination and checkpoint
+	DryRun bool
+	// CheckpointFile stores key of the last migrated record, migration continues after it. Empty disables checkpoints
+	CheckpointFile string
+	// Progress is called after each batch, if set
+	Progress func(stats Stats)
+}
+
+// Stats of the migration
+type Stats struct {
+	// Read is number of records read from source
+	Read int
+	// Migrated is number of records written to destination
+	Migrated int
+	// Existing is number of records with shorts already present in destination, e.g. migrated before checkpoint
+	Existing int
+	// Conflicts are shorts of the records, which original urls are already shortened in destination
+	Conflicts []string
+	// StartedAfter is the checkpoint migration started from
+	StartedAfter string
+}
+
+// Migrate copies records of src to dst in batches of opts.BatchSize, keeping shorts, owners, deleted flags and
+// other fields of the records. Checkpoint is saved after each written batch. Workspaces and their members aren't
+// copied, records keep their workspace ids
+func Migrate(ctx context.Context, src, dst storage.Storager, opts Options) (Stats, error) {
+	if opts.BatchSize <= 0 {
+		return Stats{}, errors.New("batch size must be positive")
+	}
+
+	stats := Stats{}
+	after, err := readCheckpoint(opts.CheckpointFile)
+	if err != nil {
+		return stats, err
+	}
+	stats.StartedAfter = after
+
+	it, err := src.IterateAll(ctx, after)
+	if err != nil {
+		return stats, fmt.Errorf("cannot read source: %w", err)
+	}
+	defer it.Close()
+
+	inserter := storage.NewBatchInserter(dst, opts.BatchSize+1)
+	batch := make([]string, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if !opts.DryRun {
+			if err := inserter.Flush(ctx); err != nil {
+				return fmt.Errorf("cannot write batch: %w", err)
+			}
+			for _, key := range batch {
+				if inserter.Taken(key) {
+					stats.Existing++
+				} else if _, ok := inserter.Conflict(key); ok {
+					stats.Conflicts = append(stats.Conflicts, key)
+				} else {
+					stats.Migrated++
+				}
+			}
+			inserter.Reset()
+			if err := writeCheckpoint(opts.CheckpointFile, batch[len(batch)-1]); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		if opts.Progress != nil {
+			opts.Progress(stats)
+		}
+		return nil
+	}
+
+	for it.Next() {
+		if err = ctx.Err(); err != nil {
+			return stats, err
+		}
+		record := it.Record()
+		stats.Read++
+		if !opts.DryRun {
+			if err = inserter.AddItem(ctx, record); err != nil {
+				return stats, err
+			}
+		}
+		batch = append(batch, record.Key())
+		if len(batch) == opts.BatchSize {
+			if err = flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err = it.Err(); err != nil {
+		return stats, fmt.Errorf("cannot read source: %w", err)
+	}
+	return stats, flush()
+}
+
+// readCheckpoint returns key of the last migrated record, empty if there is no checkpoint
+func readCheckpoint(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read checkpoint: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeCheckpoint atomically replaces checkpoint with the key
+func writeCheckpoint(path, key string) error {
+	if path == "" {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(key + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write checkpoint: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// VerifyResult is result of the comparison of the source and destination
+type VerifyResult struct {
+	SourceCount      int
+	DestinationCount int
+	// Sampled is number of source records compared with destination
+	Sampled int
+	// Mismatches describe differences of the sampled records
+	Mismatches []string
+}
+
+// OK reports whether destination has all records of the source and sampled records are equal
+func (r VerifyResult) OK() bool {
+	return r.DestinationCount >= r.SourceCount && len(r.Mismatches) == 0
+}
+
+// Verify counts records of both storages and compares up to sampleSize random records of the source
+// with the records of destination
+func Verify(ctx context.Context, src, dst storage.Storager, sampleSize int) (VerifyResult, error) {
+	result := VerifyResult{}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sample := make([]storage.Record, 0, sampleSize)
+
+	it, err := src.IterateAll(ctx, "")
+	if err != nil {
+		return result, fmt.Errorf("cannot read source: %w", err)
+	}
+	for it.Next() {
+		result.SourceCount++
+		// reservoir sampling keeps sample uniform without knowing the count in advance
+		if len(sample) < sampleSize {
+			sample = append(sample, it.Record())
+		} else if j := random.Intn(result.SourceCount); j < sampleSize {
+			sample[j] = it.Record()
+		}
+	}
+	err = it.Err()
+	it.Close()
+	if err != nil {
+		return result, fmt.Errorf("cannot read source: %w", err)
+	}
+
+	if result.DestinationCount, err = count(ctx, dst); err != nil {
+		return result, fmt.Errorf("cannot read destination: %w", err)
+	}
+
+	for _, want := range sample {
+		result.Sampled++
+		got, err := dst.Load(ctx, want.Key())
+		var notFound *storage.RecordNotFoundError
+		if errors.As(err, &notFound) {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: not found", want.Key()))
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("cannot read destination: %w", err)
+		}
+		if diff := compare(want, got); diff != "" {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: %s", want.Key(), diff))
+		}
+	}
+	return result, nil
+}
+
+func count(ctx context.Context, s storage.Storager) (int, error) {
+	it, err := s.IterateAll(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	return n, it.Err()
+}
+
+// compare returns names of the fields, which differ in the records
+func compare(want, got storage.Record) string {
+	// times are compared separately, storages may keep different precision and location
+	if !want.CreatedAt.IsZero() && !want.CreatedAt.Truncate(time.Second).Equal(got.CreatedAt.Truncate(time.Second)) {
+		return "created_at differs"
+	}
+	want.CreatedAt, got.CreatedAt = time.Time{}, time.Time{}
+	// canonical url is filled from original url by storages, when it's not set
+	want.Canonical, got.Canonical = want.CanonicalURL(), got.CanonicalURL()
+
+	var diff []string
+	wantValue, gotValue := reflect.ValueOf(want), reflect.ValueOf(got)
+	for i := 0; i < wantValue.NumField(); i++ {
+		if !reflect.DeepEqual(wantValue.Field(i).Interface(), gotValue.Field(i).Interface()) {
+			diff = append(diff, wantValue.Type().Field(i).Name)
+		}
+	}
+	if len(diff) == 0 {
+		return ""
+	}
+	return strings.Join(diff, ", ") + " differ"
+}
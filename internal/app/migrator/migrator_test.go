@@ -0,0 +1,115 @@
+package migrator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+func sourceRecords(n int) storage.RecordMap {
+	records := make(storage.RecordMap, n)
+	for i := 0; i < n; i++ {
+		short := "short-" + strconv.Itoa(100+i)
+		records[short] = storage.Record{
+			Short:     short,
+			Full:      "http://example.com/" + strconv.Itoa(i),
+			UserID:    "user-" + strconv.Itoa(i%3),
+			Deleted:   i%4 == 0,
+			Clicks:    int64(i),
+			CreatedAt: time.Date(2022, 1, 7, 0, 11, 53, 0, time.UTC),
+		}
+	}
+	return records
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("copies all records to file storage", func(t *testing.T) {
+		src := storage.NewMemoryStorage(sourceRecords(25))
+		dst, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "dst.json"))
+		require.NoError(t, err)
+
+		stats, err := Migrate(ctx, src, dst, Options{BatchSize: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 25, stats.Read)
+		assert.Equal(t, 25, stats.Migrated)
+
+		result, err := Verify(ctx, src, dst, 10)
+		require.NoError(t, err)
+		assert.True(t, result.OK(), result.Mismatches)
+		assert.Equal(t, 10, result.Sampled)
+
+		r, err := dst.Load(ctx, "short-100")
+		require.NoError(t, err)
+		assert.True(t, r.Deleted)
+		assert.Equal(t, "user-0", r.UserID)
+	})
+
+	t.Run("dry run writes nothing", func(t *testing.T) {
+		src := storage.NewMemoryStorage(sourceRecords(5))
+		dst := storage.NewMemoryStorage(nil)
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+		stats, err := Migrate(ctx, src, dst, Options{BatchSize: 2, DryRun: true, CheckpointFile: checkpoint})
+		require.NoError(t, err)
+		assert.Equal(t, 5, stats.Read)
+		assert.Equal(t, 0, stats.Migrated)
+		assert.NoFileExists(t, checkpoint)
+
+		result, err := Verify(ctx, src, dst, 5)
+		require.NoError(t, err)
+		assert.False(t, result.OK())
+		assert.Len(t, result.Mismatches, 5)
+	})
+
+	t.Run("resumes from checkpoint", func(t *testing.T) {
+		src := storage.NewMemoryStorage(sourceRecords(10))
+		dst := storage.NewMemoryStorage(nil)
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint")
+
+		// interrupt migration after the first batch
+		ctx, cancel := context.WithCancel(ctx)
+		_, err := Migrate(ctx, src, dst, Options{
+			BatchSize:      4,
+			CheckpointFile: checkpoint,
+			Progress:       func(Stats) { cancel() },
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		data, err := os.ReadFile(checkpoint)
+		require.NoError(t, err)
+		assert.Equal(t, "short-103\n", string(data))
+
+		stats, err := Migrate(context.Background(), src, dst, Options{BatchSize: 4, CheckpointFile: checkpoint})
+		require.NoError(t, err)
+		assert.Equal(t, "short-103", stats.StartedAfter)
+		assert.Equal(t, 6, stats.Read)
+		assert.Equal(t, 6, stats.Migrated)
+
+		result, err := Verify(context.Background(), src, dst, 10)
+		require.NoError(t, err)
+		assert.True(t, result.OK(), result.Mismatches)
+	})
+
+	t.Run("reports conflicts and existing records", func(t *testing.T) {
+		src := storage.NewMemoryStorage(sourceRecords(3))
+		dst := storage.NewMemoryStorage(storage.RecordMap{
+			"short-100": {Short: "short-100", Full: "http://example.com/0", UserID: "user-0"},
+			"other":     {Short: "other", Full: "http://example.com/1", UserID: "user-1"},
+		})
+
+		stats, err := Migrate(ctx, src, dst, Options{BatchSize: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 1, stats.Existing)
+		assert.Equal(t, []string{"short-101"}, stats.Conflicts)
+		assert.Equal(t, 1, stats.Migrated)
+	})
+}
@@ -0,0 +1,196 @@
+// Package profiling writes CPU, heap, mutex and block profiles of the service and serves net/http/pprof endpoints
+package profiling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	rpprof "runtime/pprof"
+	"syscall"
+	"time"
+)
+
+// Config of the profiling, empty file disables the profile
+type Config struct {
+	// CPUFile gets CPU profile of the whole run
+	CPUFile string
+	// HeapFile, MutexFile and BlockFile get profiles on exit
+	HeapFile  string
+	MutexFile string
+	BlockFile string
+	// DumpDir gets heap, mutex, block and goroutine profiles on SIGUSR1
+	DumpDir string
+	// MutexFraction is rate of the sampled mutex contention events, 5 if mutex profile is enabled and rate is not set
+	MutexFraction int
+	// BlockRate is rate of the sampled blocking events in nanoseconds, 10000 if block profile is enabled and rate is not set
+	BlockRate int
+}
+
+// Profiler writes profiles of the Config
+type Profiler struct {
+	cfg     Config
+	cpuFile *os.File
+	stopSig func()
+}
+
+// Start starts CPU profile and sampling of mutex and block events, profiles are written by Stop
+func Start(cfg Config) (*Profiler, error) {
+	p := &Profiler{cfg: cfg}
+
+	if cfg.MutexFile != "" || cfg.DumpDir != "" || cfg.MutexFraction > 0 {
+		if p.cfg.MutexFraction <= 0 {
+			p.cfg.MutexFraction = 5
+		}
+		runtime.SetMutexProfileFraction(p.cfg.MutexFraction)
+	}
+	if cfg.BlockFile != "" || cfg.DumpDir != "" || cfg.BlockRate > 0 {
+		if p.cfg.BlockRate <= 0 {
+			p.cfg.BlockRate = 10000
+		}
+		runtime.SetBlockProfileRate(p.cfg.BlockRate)
+	}
+
+	if cfg.CPUFile != "" {
+		f, err := os.Create(cfg.CPUFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = rpprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		p.cpuFile = f
+	}
+
+	if cfg.DumpDir != "" {
+		p.handleDumpSignal()
+	}
+	return p, nil
+}
+
+// handleDumpSignal dumps profiles to DumpDir on every SIGUSR1
+func (p *Profiler) handleDumpSignal() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, syscall.SIGUSR1)
+	p.stopSig = func() {
+		signal.Stop(signals)
+		close(done)
+	}
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				dir, err := p.Dump()
+				if err != nil {
+					log.Println("ERROR: cannot dump profiles:", err)
+					continue
+				}
+				log.Println("Profiles dumped to", dir)
+			}
+		}
+	}()
+}
+
+// Dump writes heap, mutex, block and goroutine profiles to the new directory in DumpDir, returns the directory
+func (p *Profiler) Dump() (string, error) {
+	if p.cfg.DumpDir == "" {
+		return "", errors.New("dump directory is not set")
+	}
+	dir := filepath.Join(p.cfg.DumpDir, time.Now().Format("20060102-150405.000"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	for _, name := range []string{"heap", "mutex", "block", "goroutine"} {
+		if err := writeProfile(name, filepath.Join(dir, name+".pprof")); err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
+
+// Stop stops CPU profile and writes heap, mutex and block profiles
+func (p *Profiler) Stop() error {
+	if p.stopSig != nil {
+		p.stopSig()
+	}
+
+	var errs []error
+	if p.cpuFile != nil {
+		rpprof.StopCPUProfile()
+		if err := p.cpuFile.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for name, path := range map[string]string{"heap": p.cfg.HeapFile, "mutex": p.cfg.MutexFile, "block": p.cfg.BlockFile} {
+		if path == "" {
+			continue
+		}
+		if err := writeProfile(name, path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot write profiles: %v", errs)
+	}
+	return nil
+}
+
+func writeProfile(name, path string) error {
+	profile := rpprof.Lookup(name)
+	if profile == nil {
+		return fmt.Errorf("unknown profile: %s", name)
+	}
+	if name == "heap" {
+		// profile shows memory in use, not the garbage
+		runtime.GC()
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = profile.WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Handler returns handler of the net/http/pprof endpoints under /debug/pprof/
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Serve serves pprof endpoints on the address until ctx is done
+func Serve(ctx context.Context, address string) error {
+	srv := http.Server{
+		Addr:    address,
+		Handler: Handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
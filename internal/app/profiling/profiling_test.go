@@ -0,0 +1,51 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiler(t *testing.T) {
+	dir := t.TempDir()
+	p, err := Start(Config{
+		CPUFile:   filepath.Join(dir, "cpu.pprof"),
+		HeapFile:  filepath.Join(dir, "heap.pprof"),
+		MutexFile: filepath.Join(dir, "mutex.pprof"),
+		BlockFile: filepath.Join(dir, "block.pprof"),
+		DumpDir:   filepath.Join(dir, "dumps"),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	assert.Eventually(t, func() bool {
+		dumps, _ := os.ReadDir(filepath.Join(dir, "dumps"))
+		if len(dumps) != 1 {
+			return false
+		}
+		files, _ := os.ReadDir(filepath.Join(dir, "dumps", dumps[0].Name()))
+		return len(files) == 4
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, p.Stop())
+	for _, name := range []string{"cpu", "heap", "mutex", "block"} {
+		info, err := os.Stat(filepath.Join(dir, name+".pprof"))
+		require.NoError(t, err, name)
+		assert.NotZero(t, info.Size(), name)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/pprof/heap?debug=1", nil))
+	result := w.Result()
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+}
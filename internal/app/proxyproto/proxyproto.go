@@ -0,0 +1,222 @@
+// Package proxyproto accepts connections with PROXY protocol v1 and v2 headers, which load balancers
+// send to pass address of the client. Remote address of the connection becomes address of the client.
+// Headers are read only from trusted balancers, so clients connecting directly can't set their address
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHeader is returned by Read of the connection without valid PROXY protocol header
+var ErrNoHeader = errors.New("proxyproto: invalid PROXY protocol header")
+
+// v2Signature starts header of PROXY protocol v2
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxV1Length is maximal length of v1 header including CRLF
+const maxV1Length = 107
+
+// Listener requires PROXY protocol header on every connection accepted from the trusted networks
+type Listener struct {
+	net.Listener
+	// HeaderTimeout limits time of reading the header, 10 seconds if zero
+	HeaderTimeout time.Duration
+	// trusted are networks of the balancers. Connections from other addresses are returned as is,
+	// their headers aren't parsed. Unix socket peers are trusted, the socket is reachable only locally
+	trusted []*net.IPNet
+}
+
+// NewListener wraps listener ln, headers are read from connections of the trusted networks
+func NewListener(ln net.Listener, trusted []*net.IPNet) *Listener {
+	return &Listener{Listener: ln, trusted: trusted}
+}
+
+// ParseNetworks parses networks in CIDR notation, single addresses are networks of one address
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if ip := net.ParseIP(cidr); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Accept returns connection, which reads the header on first Read or RemoteAddr call,
+// so slow clients don't block the listener. Connections of untrusted peers are returned as is
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusts(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	timeout := l.HeaderTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// trusts reports whether the peer can pass address of the client
+func (l *Listener) trusts(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	for _, network := range l.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is connection with PROXY protocol header
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	remote  net.Addr
+	err     error
+}
+
+// Read reads data after the header
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns address of the client from the header. Address of the connection is returned
+// for LOCAL and UNKNOWN headers and for the invalid header, which fails Read
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) readHeader() {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		c.err = err
+		return
+	}
+	c.remote, c.err = ReadHeader(c.reader)
+	if err := c.Conn.SetReadDeadline(time.Time{}); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// ReadHeader reads v1 or v2 header and returns address of the client, nil for LOCAL and UNKNOWN headers
+func ReadHeader(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(v2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoHeader, err)
+	}
+	if bytes.Equal(prefix, v2Signature) {
+		return readV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY")) {
+		return readV1(r)
+	}
+	return nil, ErrNoHeader
+}
+
+// readV1 reads header like "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, maxV1Length)
+	for len(line) < maxV1Length {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrNoHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrNoHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[0] == "PROXY" && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || fields[0] != "PROXY" || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrNoHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrNoHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readV2 reads binary header, addresses of families other than TCP over IPv4 and IPv6 are skipped
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoHeader, err)
+	}
+	version, command, family := header[12]>>4, header[12]&0x0f, header[13]
+	if version != 2 || command > 1 {
+		return nil, ErrNoHeader
+	}
+	data := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoHeader, err)
+	}
+	// LOCAL command is sent by the balancer itself, like health checks
+	if command == 0 {
+		return nil, nil
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(data) < 12 {
+			return nil, ErrNoHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:4]), Port: int(binary.BigEndian.Uint16(data[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(data) < 36 {
+			return nil, ErrNoHeader
+		}
+		return &net.TCPAddr{IP: net.IP(data[0:16]), Port: int(binary.BigEndian.Uint16(data[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,113 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func v2Header(command byte, family byte, addresses []byte) string {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(addresses)))
+	return string(append(header, addresses...))
+}
+
+func TestReadHeader(t *testing.T) {
+	tcp4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "v1 tcp4", input: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nGET /", want: "192.0.2.1:56324"},
+		{name: "v1 tcp6", input: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\nGET /", want: "[2001:db8::1]:56324"},
+		{name: "v1 unknown", input: "PROXY UNKNOWN\r\nGET /"},
+		{name: "v1 without crlf", input: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\nGET /", wantErr: true},
+		{name: "v1 invalid ip", input: "PROXY TCP4 192.0.2 198.51.100.1 56324 443\r\nGET /", wantErr: true},
+		{name: "v2 tcp4", input: v2Header(1, 0x11, tcp4) + "GET /", want: "192.0.2.1:56324"},
+		{name: "v2 local", input: v2Header(0, 0x11, tcp4) + "GET /"},
+		{name: "v2 short addresses", input: v2Header(1, 0x11, tcp4[:6]) + "GET /", wantErr: true},
+		{name: "no header", input: "GET / HTTP/1.1\r\n\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			addr, err := ReadHeader(r)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrNoHeader), err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Nil(t, addr)
+			} else {
+				assert.Equal(t, tt.want, addr.String())
+			}
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "GET /", string(rest), "data after the header is kept")
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	accept := func(t *testing.T, trusted []string) (net.Conn, string) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		networks, err := ParseNetworks(trusted)
+		require.NoError(t, err)
+		pln := NewListener(ln, networks)
+		t.Cleanup(func() { pln.Close() })
+
+		go func() {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nping"))
+		}()
+
+		conn, err := pln.Accept()
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		data, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		return conn, string(data)
+	}
+
+	t.Run("reads header of trusted peer", func(t *testing.T) {
+		conn, data := accept(t, []string{"10.0.0.0/8", "127.0.0.1"})
+		assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+		assert.Equal(t, "ping", data)
+	})
+
+	t.Run("ignores header of untrusted peer", func(t *testing.T) {
+		conn, data := accept(t, []string{"10.0.0.0/8"})
+		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", host)
+		assert.True(t, strings.HasPrefix(data, "PROXY TCP4"), "header is passed to the server as data")
+	})
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", " 192.0.2.1", "2001:db8::1"})
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+	assert.Equal(t, "10.0.0.0/8", networks[0].String())
+	assert.Equal(t, "192.0.2.1/32", networks[1].String())
+	assert.Equal(t, "2001:db8::1/128", networks[2].String())
+
+	_, err = ParseNetworks([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,232 @@
+// Package qrgenerator renders QR codes of the short urls in PNG and SVG formats
+package qrgenerator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+
+	"github.com/skip2/go-qrcode"
+)
+
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	FormatSVG Format = "svg"
+)
+
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+var ErrSizeTooSmall = errors.New("size is too small for the QR code")
+
+// Options of the rendered QR code
+type Options struct {
+	Format Format
+	// Size is width and height of the image in pixels
+	Size int
+	// Margin is width of the quiet zone around the code in modules
+	Margin int
+	// Level is error correction level: L, M, Q or H
+	Level string
+}
+
+// DefaultOptions returns options used, when request not specifies them
+func DefaultOptions() Options {
+	return Options{
+		Format: FormatPNG,
+		Size:   256,
+		Margin: 4,
+		Level:  "M",
+	}
+}
+
+// Validate checks options are in the supported ranges
+func (o Options) Validate() error {
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return fmt.Errorf("unsupported format: %s", o.Format)
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return fmt.Errorf("unsupported error correction level: %s", o.Level)
+	}
+	return nil
+}
+
+// ContentType returns mime type of the rendered image
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// maxCacheBytes limits memory of the cached images, images of all option combinations of one short can't fill it up
+const maxCacheBytes = 32 << 20
+
+// cacheKey identifies image of the short rendered with the options
+type cacheKey struct {
+	short string
+	opts  Options
+}
+
+type cacheEntry struct {
+	content string
+	data    []byte
+}
+
+// Generator renders QR codes and caches rendered images by short and options.
+// Cache holds the last cacheSize images, which take up to maxCacheBytes
+type Generator struct {
+	mu        sync.Mutex
+	cacheSize int
+	maxBytes  int
+	bytes     int
+	cache     map[cacheKey]cacheEntry
+	order     []cacheKey
+}
+
+func NewGenerator(cacheSize int) *Generator {
+	return &Generator{
+		cacheSize: cacheSize,
+		maxBytes:  maxCacheBytes,
+		cache:     make(map[cacheKey]cacheEntry),
+		order:     make([]cacheKey, 0, cacheSize),
+	}
+}
+
+// Render returns image of the QR code with content encoded, rendered with opts.
+// short is used as the cache key
+func (g *Generator) Render(short, content string, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	key := cacheKey{short: short, opts: opts}
+	g.mu.Lock()
+	if entry, ok := g.cache[key]; ok && entry.content == content {
+		g.mu.Unlock()
+		return entry.data, nil
+	}
+	g.mu.Unlock()
+
+	data, err := render(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.put(key, content, data)
+
+	return data, nil
+}
+
+// put saves image to the cache, evicting the oldest images, when cache is full
+func (g *Generator) put(key cacheKey, content string, data []byte) {
+	if g.cacheSize <= 0 || len(data) > g.maxBytes {
+		return
+	}
+	if old, ok := g.cache[key]; ok {
+		g.bytes -= len(old.data)
+	} else {
+		g.order = append(g.order, key)
+	}
+	g.cache[key] = cacheEntry{content: content, data: data}
+	g.bytes += len(data)
+
+	for len(g.order) > g.cacheSize || g.bytes > g.maxBytes {
+		oldest := g.order[0]
+		g.order = g.order[1:]
+		g.bytes -= len(g.cache[oldest].data)
+		delete(g.cache, oldest)
+	}
+}
+
+func render(content string, opts Options) ([]byte, error) {
+	q, err := qrcode.New(content, levels[opts.Level])
+	if err != nil {
+		return nil, err
+	}
+	q.DisableBorder = true
+	bitmap := q.Bitmap()
+
+	if opts.Format == FormatSVG {
+		return renderSVG(bitmap, opts), nil
+	}
+	return renderPNG(bitmap, opts)
+}
+
+func renderPNG(bitmap [][]bool, opts Options) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	scale := opts.Size / modules
+	if scale < 1 {
+		return nil, ErrSizeTooSmall
+	}
+	// leftover pixels are spread around the code to keep the requested size
+	offset := (opts.Size-scale*modules)/2 + opts.Margin*scale
+
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), palette)
+	for y, row := range bitmap {
+		for x, set := range row {
+			if !set {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func renderSVG(bitmap [][]bool, opts Options) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#ffffff"/>
+<path fill="#000000" d="%s"/>
+</svg>
+`, opts.Size, opts.Size, modules, modules, path.String())
+	return buf.Bytes()
+}
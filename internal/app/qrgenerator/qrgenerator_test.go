@@ -0,0 +1,112 @@
+package qrgenerator
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(o *Options)
+		wantErr bool
+	}{
+		{name: "default options are valid", modify: func(o *Options) {}, wantErr: false},
+		{name: "svg format is valid", modify: func(o *Options) { o.Format = FormatSVG }, wantErr: false},
+		{name: "unknown format", modify: func(o *Options) { o.Format = "gif" }, wantErr: true},
+		{name: "size too small", modify: func(o *Options) { o.Size = MinSize - 1 }, wantErr: true},
+		{name: "size too big", modify: func(o *Options) { o.Size = MaxSize + 1 }, wantErr: true},
+		{name: "negative margin", modify: func(o *Options) { o.Margin = -1 }, wantErr: true},
+		{name: "unknown level", modify: func(o *Options) { o.Level = "X" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			if err := opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerator_Render(t *testing.T) {
+	g := NewGenerator(1)
+
+	t.Run("renders png of requested size", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Size = 300
+		data, err := g.Render("abc", "http://localhost:8080/abc", opts)
+		require.NoError(t, err)
+
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 300, img.Bounds().Dx())
+		assert.Equal(t, 300, img.Bounds().Dy())
+	})
+
+	t.Run("renders svg", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Format = FormatSVG
+		data, err := g.Render("abc", "http://localhost:8080/abc", opts)
+		require.NoError(t, err)
+		assert.True(t, bytes.Contains(data, []byte("<svg")))
+	})
+
+	t.Run("returns cached image", func(t *testing.T) {
+		opts := DefaultOptions()
+		first, err := g.Render("abc", "http://localhost:8080/abc", opts)
+		require.NoError(t, err)
+		second, err := g.Render("abc", "http://localhost:8080/abc", opts)
+		require.NoError(t, err)
+		assert.Same(t, &first[0], &second[0])
+	})
+
+	t.Run("evicts oldest image", func(t *testing.T) {
+		opts := DefaultOptions()
+		_, err := g.Render("def", "http://localhost:8080/def", opts)
+		require.NoError(t, err)
+		assert.NotContains(t, g.cache, cacheKey{short: "abc", opts: opts})
+		assert.Contains(t, g.cache, cacheKey{short: "def", opts: opts})
+	})
+
+	t.Run("fails when margin doesn't fit size", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Size = MinSize
+		opts.Margin = MaxMargin
+		_, err := g.Render("abc", "http://localhost:8080/"+strings.Repeat("a", 100), opts)
+		assert.ErrorIs(t, err, ErrSizeTooSmall)
+	})
+}
+
+func TestGenerator_CacheLimits(t *testing.T) {
+	g := NewGenerator(1000)
+	g.maxBytes = 8 << 10
+
+	opts := DefaultOptions()
+	for size := MinSize; size <= 1024; size += 16 {
+		opts.Size = size
+		_, err := g.Render("abc", "http://localhost:8080/abc", opts)
+		require.NoError(t, err)
+	}
+	assert.LessOrEqual(t, g.bytes, g.maxBytes, "options of one short can't grow cache beyond the limit")
+	assert.Len(t, g.order, len(g.cache))
+
+	opts.Size = 1024
+	_, ok := g.cache[cacheKey{short: "abc", opts: opts}]
+	assert.True(t, ok, "the latest image is cached")
+	opts.Size = MinSize
+	_, ok = g.cache[cacheKey{short: "abc", opts: opts}]
+	assert.False(t, ok, "the oldest images are evicted")
+
+	total := 0
+	for _, entry := range g.cache {
+		total += len(entry.data)
+	}
+	assert.Equal(t, total, g.bytes)
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/putalexey/go-practicum/cmd/shortener/config"
+	"github.com/putalexey/go-practicum/internal/app/proxyproto"
+)
+
+// newServer creates http server of the handler with timeouts and limits of the config
+func newServer(cfg config.EnvConfig, handler http.Handler) *http.Server {
+	if cfg.Server.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: time.Duration(cfg.Server.IdleTimeout)})
+	}
+	return &http.Server{
+		Addr:              cfg.Server.Address,
+		Handler:           handler,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+		MaxHeaderBytes:    cfg.Limits.MaxHeaderBytes,
+	}
+}
+
+// listen listens unix socket or tcp address of the config. Connections of the trusted networks must start with
+// PROXY protocol header, if it is enabled
+func listen(cfg config.ServerConfig) (net.Listener, error) {
+	var ln net.Listener
+	var err error
+	if cfg.UnixSocket != "" {
+		if err = removeStaleSocket(cfg.UnixSocket); err != nil {
+			return nil, err
+		}
+		ln, err = net.Listen("unix", cfg.UnixSocket)
+	} else {
+		ln, err = net.Listen("tcp", cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ProxyProtocol {
+		trusted, err := proxyproto.ParseNetworks(cfg.ProxyTrustedNetworks)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		pln := proxyproto.NewListener(ln, trusted)
+		pln.HeaderTimeout = time.Duration(cfg.ReadHeaderTimeout)
+		ln = pln
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes socket file left by the killed server. Socket accepting connections is kept
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is used by another server", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/putalexey/go-practicum/internal/app/accountlink"
+	"github.com/putalexey/go-practicum/internal/app/middleware"
+	"github.com/putalexey/go-practicum/internal/app/shortener/requests"
+	"github.com/putalexey/go-practicum/internal/app/shortener/responses"
+)
+
+// CookieIssuer creates auth cookie of the user
+type CookieIssuer func(uid string) (*http.Cookie, error)
+
+var errCertUserLink = errors.New("users of client certificates can't be linked")
+
+// JSONIssueClaimCode godoc
+// @Summary	Issue short-lived code, which moves urls of another browser to the current user
+// @Produce	json
+// @Success	201	{object}	responses.ClaimCodeResponse
+// @Failure	403	{object}	responses.ErrorResponse	"Users of client certificates can't be linked"
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/user/claim-codes	[post]
+func JSONIssueClaimCode(linker *accountlink.Linker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if strings.HasPrefix(userID, middleware.ClientCertUIDPrefix) {
+			jsonError(w, errCertUserLink.Error(), http.StatusForbidden)
+			return
+		}
+
+		code, expiresAt, err := linker.Issue(userID)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, responses.ClaimCodeResponse{Code: code, ExpiresAt: expiresAt.UTC()})
+	}
+}
+
+// JSONClaimAccount godoc
+// @Summary	Redeem claim code issued in another browser
+// @Description	Urls and workspaces of the current user are moved to the user, who issued the code,
+// @Description	and the browser is switched to that user with new auth cookie
+// @Accept	json
+// @Produce	json
+// @Param	claim	body	requests.ClaimRequest	true	"Claim code"
+// @Success	200	{object}	responses.ClaimResponse
+// @Failure	400	{object}	responses.ErrorResponse	"Code is invalid, expired or issued by the current user"
+// @Failure	403	{object}	responses.ErrorResponse	"Users of client certificates can't be linked"
+// @Failure	429	{object}	responses.ErrorResponse	"Too many failed attempts"
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/user/claim	[post]
+func JSONClaimAccount(linker *accountlink.Linker, issueCookie CookieIssuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if strings.HasPrefix(userID, middleware.ClientCertUIDPrefix) {
+			jsonError(w, errCertUserLink.Error(), http.StatusForbidden)
+			return
+		}
+
+		claimRequest := requests.ClaimRequest{}
+		if err = json.Unmarshal(body, &claimRequest); err != nil || claimRequest.Code == "" {
+			jsonError(w, "Request can't be parsed", http.StatusBadRequest)
+			return
+		}
+
+		result, err := linker.Claim(r.Context(), claimRequest.Code, userID, clientAddr(r))
+		if errors.Is(err, accountlink.ErrInvalidCode) || errors.Is(err, accountlink.ErrSameUser) {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if errors.Is(err, accountlink.ErrTooManyAttempts) {
+			jsonError(w, err.Error(), http.StatusTooManyRequests)
+			return
+		} else if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		cookie, err := issueCookie(result.UserID)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, cookie)
+		writeJSON(w, http.StatusOK, responses.ClaimResponse{
+			UserID:  result.UserID,
+			Records: result.Records,
+			Skipped: len(result.Skipped),
+		})
+	}
+}
+
+// clientAddr returns address of the client without port, failed claim attempts are counted by it
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/putalexey/go-practicum/internal/app/domains"
+	"github.com/putalexey/go-practicum/internal/app/shortener/requests"
+	"github.com/putalexey/go-practicum/internal/app/shortener/responses"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+	"github.com/putalexey/go-practicum/internal/app/urlgenerator"
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
+)
+
+// bulkChunkSize is number of lines stored at once, results are written after each chunk
+const bulkChunkSize = 500
+
+// maxBulkLineSize limits length of the NDJSON line
+const maxBulkLineSize = 64 * 1024
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// reservedAliases can't be used as shorts, because they are taken by routes
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"ping":    true,
+	"swagger": true,
+}
+
+// bulkLineError is error in a single line of the import, other lines are still processed
+type bulkLineError struct {
+	line int
+	err  error
+}
+
+func (e *bulkLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.err)
+}
+
+func (e *bulkLineError) Unwrap() error {
+	return e.err
+}
+
+// bulkReader reads import line by line, returns io.EOF at the end of the import
+type bulkReader interface {
+	Read() (item requests.BulkItem, line int, err error)
+}
+
+// ndjsonBulkReader reads BulkItem json objects separated by new line
+type ndjsonBulkReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONBulkReader(r io.Reader) *ndjsonBulkReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxBulkLineSize)
+	return &ndjsonBulkReader{scanner: scanner}
+}
+
+func (r *ndjsonBulkReader) Read() (requests.BulkItem, int, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := r.scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+		item := requests.BulkItem{}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return item, r.line, &bulkLineError{line: r.line, err: errors.New("line can't be parsed")}
+		}
+		return item, r.line, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return requests.BulkItem{}, r.line + 1, err
+	}
+	return requests.BulkItem{}, r.line, io.EOF
+}
+
+// csvBulkReader reads lines of correlation_id,original_url[,alias], header line is skipped
+type csvBulkReader struct {
+	reader *csv.Reader
+	first  bool
+}
+
+func newCSVBulkReader(r io.Reader) *csvBulkReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvBulkReader{reader: reader, first: true}
+}
+
+func (r *csvBulkReader) Read() (requests.BulkItem, int, error) {
+	for {
+		fields, err := r.reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return requests.BulkItem{}, parseErr.Line, &bulkLineError{line: parseErr.Line, err: parseErr.Err}
+			}
+			return requests.BulkItem{}, 0, err
+		}
+		line, _ := r.reader.FieldPos(0)
+		if r.first {
+			r.first = false
+			if fields[0] == "correlation_id" {
+				continue
+			}
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return requests.BulkItem{}, line, &bulkLineError{line: line, err: errors.New("expected correlation_id,original_url[,alias]")}
+		}
+		item := requests.BulkItem{CorrelationID: fields[0], OriginalURL: fields[1]}
+		if len(fields) == 3 {
+			item.Alias = fields[2]
+		}
+		return item, line, nil
+	}
+}
+
+// newBulkReader returns reader of the import by content type of the request
+func newBulkReader(body io.Reader, contentType string) (bulkReader, error) {
+	if contentType == "" {
+		return newNDJSONBulkReader(body), nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	switch mediaType {
+	case "text/csv":
+		return newCSVBulkReader(body), nil
+	case "application/x-ndjson", "application/jsonl", "application/json", "text/plain":
+		return newNDJSONBulkReader(body), nil
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", mediaType)
+	}
+}
+
+// bulkLine is a read line waiting for the chunk to be stored
+type bulkLine struct {
+	line          int
+	correlationID string
+	key           string
+	err           error
+}
+
+// JSONCreateShortBulk godoc
+// @Summary	Import many urls, results are streamed back line by line
+// @Description	Lines are read in NDJSON format or CSV with "correlation_id,original_url[,alias]" columns.
+// @Description	Lines are stored in chunks, so the import is not atomic: results of the stored lines are returned even if
+// @Description	the import is interrupted.
+// @Accept	application/x-ndjson
+// @Accept	text/csv
+// @Produce	application/x-ndjson
+// @Param	lines	body	requests.BulkItem	true	"Lines of the import"
+// @Param	domain	query	string	false	"Domain of the short urls, domain of the request host if empty"
+// @Success	200	{object}	responses.BulkResultItem	"One result per line"
+// @Failure	415	{object}	responses.ErrorResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/shorten/bulk	[post]
+func JSONCreateShortBulk(
+	generator urlgenerator.URLGenerator,
+	store storage.Storager,
+	normalizer urlnormalizer.Canonicalizer,
+	domains domains.Resolver,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		domain, err := requestDomain(r, domains, r.URL.Query().Get("domain"))
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// HTTP/1.x server closes the request body on the first flush of the response, so the import is read
+		// to a temporary file before results are streamed. HTTP/2 streams results while the body is still read
+		var body io.Reader = r.Body
+		if r.ProtoMajor < 2 {
+			spooled, err := spoolBody(r.Body)
+			if err != nil {
+				log.Println("ERROR:", err)
+				jsonError(w, "import can't be read", http.StatusBadRequest)
+				return
+			}
+			defer spooled.Close()
+			body = spooled
+		}
+		reader, err := newBulkReader(body, r.Header.Get("Content-Type"))
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		flusher, _ := w.(http.Flusher)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+
+		ctx := r.Context()
+		batchInserter := storage.NewBatchInserter(store, bulkChunkSize)
+		chunk := make([]bulkLine, 0, bulkChunkSize)
+		// chunkLines maps keys of the chunk to their lines, results are looked up by key,
+		// so the key repeated in the chunk is rejected before it is stored
+		chunkLines := make(map[string]int, bulkChunkSize)
+		writeChunk := func() error {
+			if err := batchInserter.Flush(ctx); err != nil {
+				return err
+			}
+			for _, l := range chunk {
+				if err := encoder.Encode(newBulkResultItem(generator, batchInserter, l)); err != nil {
+					return err
+				}
+			}
+			batchInserter.Reset()
+			chunk = chunk[:0]
+			for key := range chunkLines {
+				delete(chunkLines, key)
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		}
+
+		for {
+			if err = ctx.Err(); err != nil {
+				log.Println("bulk import canceled:", err)
+				return
+			}
+
+			item, line, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			l := bulkLine{line: line, correlationID: item.CorrelationID}
+			var lineErr *bulkLineError
+			switch {
+			case errors.As(err, &lineErr):
+				l.err = lineErr.err
+			case err != nil:
+				// import can't be read further, report results of the read lines and the error
+				if err2 := writeChunk(); err2 == nil {
+					_ = encoder.Encode(responses.BulkResultItem{Line: line, Error: err.Error()})
+				}
+				log.Println("ERROR:", err)
+				return
+			default:
+				record, err := newBulkRecord(item, userID, domain, normalizer)
+				if err != nil {
+					l.err = err
+				} else if first, ok := chunkLines[record.Key()]; ok {
+					l.err = fmt.Errorf("alias %s is already used on line %d", item.Alias, first)
+				} else if err = batchInserter.AddItem(ctx, record); err != nil {
+					log.Println("ERROR:", err)
+					_ = encoder.Encode(responses.BulkResultItem{Error: err.Error()})
+					return
+				} else {
+					l.key = record.Key()
+					chunkLines[l.key] = line
+				}
+			}
+
+			chunk = append(chunk, l)
+			if len(chunk) == bulkChunkSize {
+				if err = writeChunk(); err != nil {
+					log.Println("ERROR:", err)
+					_ = encoder.Encode(responses.BulkResultItem{Error: err.Error()})
+					return
+				}
+			}
+		}
+
+		if err = writeChunk(); err != nil {
+			log.Println("ERROR:", err)
+			_ = encoder.Encode(responses.BulkResultItem{Error: err.Error()})
+		}
+	}
+}
+
+// spooledBody is request body copied to the temporary file, the file is removed on close
+type spooledBody struct {
+	*os.File
+}
+
+func spoolBody(body io.Reader) (*spooledBody, error) {
+	f, err := os.CreateTemp("", "bulk-import-*")
+	if err != nil {
+		return nil, err
+	}
+	spooled := &spooledBody{File: f}
+	if _, err = io.Copy(f, body); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = spooled.Close()
+		return nil, err
+	}
+	return spooled, nil
+}
+
+func (b *spooledBody) Close() error {
+	err := b.File.Close()
+	if err2 := os.Remove(b.Name()); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// newBulkRecord validates line of the import and creates record from it
+func newBulkRecord(item requests.BulkItem, userID, domain string, normalizer urlnormalizer.Canonicalizer) (storage.Record, error) {
+	if !isValidURL(item.OriginalURL) {
+		return storage.Record{}, errors.New(invalidURLError(item.OriginalURL))
+	}
+	if item.Alias != "" && (!aliasPattern.MatchString(item.Alias) || reservedAliases[item.Alias]) {
+		return storage.Record{}, fmt.Errorf("invalid alias: %s", item.Alias)
+	}
+	record, err := storage.NewRecord(item.OriginalURL, userID)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	if item.Alias != "" {
+		record.Short = item.Alias
+	}
+	record.Domain = domain
+	if err = applyCanonical(&record, normalizer); err != nil {
+		return storage.Record{}, err
+	}
+	return record, nil
+}
+
+// newBulkResultItem returns result of the stored line
+func newBulkResultItem(generator urlgenerator.URLGenerator, batchInserter *storage.BatchInserter, l bulkLine) responses.BulkResultItem {
+	result := responses.BulkResultItem{Line: l.line, CorrelationID: l.correlationID}
+	switch {
+	case l.err != nil:
+		result.Error = l.err.Error()
+	case batchInserter.Taken(l.key):
+		result.Error = storage.ErrShortTaken.Error()
+	default:
+		key := l.key
+		if old, ok := batchInserter.Conflict(key); ok {
+			key = old.Key()
+			result.Conflict = true
+		}
+		result.ShortURL = generator.GetURL(key)
+	}
+	return result
+}
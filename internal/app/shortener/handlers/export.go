@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/putalexey/go-practicum/internal/app/shortener/responses"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+	"github.com/putalexey/go-practicum/internal/app/urlgenerator"
+)
+
+// exportFlushSize is number of records written between flushes of the response
+const exportFlushSize = 100
+
+var exportCSVHeader = []string{"short_url", "original_url", "created_at", "deleted", "clicks"}
+
+// exportWriter writes records of the export in one of the formats
+type exportWriter interface {
+	Begin() error
+	Write(item responses.ExportItem) error
+	// Flush writes buffered items to the underlying writer
+	Flush() error
+	End() error
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonExportWriter) Begin() error {
+	return nil
+}
+
+func (e *ndjsonExportWriter) Write(item responses.ExportItem) error {
+	return e.encoder.Encode(item)
+}
+
+func (e *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+func (e *ndjsonExportWriter) End() error {
+	return nil
+}
+
+// jsonExportWriter writes items as json array, one item at a time
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExportWriter) Begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExportWriter) Write(item responses.ExportItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err = io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExportWriter) Flush() error {
+	return nil
+}
+
+func (e *jsonExportWriter) End() error {
+	_, err := io.WriteString(e.w, "]")
+	return err
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (e *csvExportWriter) Begin() error {
+	return e.writer.Write(exportCSVHeader)
+}
+
+func (e *csvExportWriter) Write(item responses.ExportItem) error {
+	return e.writer.Write([]string{
+		item.ShortURL,
+		item.OriginalURL,
+		item.CreatedAt.Format(time.RFC3339),
+		strconv.FormatBool(item.Deleted),
+		strconv.FormatInt(item.Clicks, 10),
+	})
+}
+
+func (e *csvExportWriter) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvExportWriter) End() error {
+	return e.Flush()
+}
+
+// newExportWriter returns writer of the format and content type of the response
+func newExportWriter(w io.Writer, format string) (exportWriter, string, error) {
+	switch format {
+	case "", "json":
+		return &jsonExportWriter{w: w}, "application/json", nil
+	case "ndjson":
+		return &ndjsonExportWriter{encoder: json.NewEncoder(w)}, "application/x-ndjson", nil
+	case "csv":
+		return &csvExportWriter{writer: csv.NewWriter(w)}, "text/csv", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// JSONExportUserShorts godoc
+// @Summary	Export all urls user shortened, including deleted ones
+// @Description	Records are streamed, so the response is truncated if error occurs during the export
+// @Produce	json
+// @Produce	application/x-ndjson
+// @Produce	text/csv
+// @Param	format	query	string	false	"Format of the export, json by default"	Enums(json, ndjson, csv)
+// @Success	200	{array}	responses.ExportItem
+// @Failure	400	{object}	responses.ErrorResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/user/urls/export	[get]
+func JSONExportUserShorts(generator urlgenerator.URLGenerator, store storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		writer, contentType, err := newExportWriter(w, format)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		it, err := store.IterateForUser(r.Context(), userID)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer it.Close()
+
+		if format == "" {
+			format = "json"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="urls.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+
+		// status is already sent, errors are only logged and the response is left truncated
+		if err = writer.Begin(); err != nil {
+			log.Println("ERROR:", err)
+			return
+		}
+		written := 0
+		for it.Next() {
+			record := it.Record()
+			item := responses.ExportItem{
+				ShortURL:    generator.GetURL(record.Key()),
+				OriginalURL: record.Full,
+				CreatedAt:   record.CreatedAt,
+				Deleted:     record.Deleted,
+				Clicks:      record.Clicks,
+			}
+			if err = writer.Write(item); err != nil {
+				log.Println("ERROR:", err)
+				return
+			}
+			written++
+			if written%exportFlushSize == 0 {
+				if err = writer.Flush(); err != nil {
+					log.Println("ERROR:", err)
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+		if err = it.Err(); err != nil {
+			log.Println("ERROR:", err)
+			return
+		}
+		if err = writer.End(); err != nil {
+			log.Println("ERROR:", err)
+		}
+	}
+}
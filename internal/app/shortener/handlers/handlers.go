@@ -9,15 +9,22 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/putalexey/go-practicum/internal/app/domains"
 	"github.com/putalexey/go-practicum/internal/app/middleware"
+	"github.com/putalexey/go-practicum/internal/app/qrgenerator"
+	"github.com/putalexey/go-practicum/internal/app/shortener/pages"
 	"github.com/putalexey/go-practicum/internal/app/shortener/requests"
 	"github.com/putalexey/go-practicum/internal/app/shortener/responses"
 	"github.com/putalexey/go-practicum/internal/app/storage"
 	"github.com/putalexey/go-practicum/internal/app/urlgenerator"
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
 )
 
 // PingHandler godoc
@@ -44,24 +51,52 @@ func PingHandler(storage storage.Storager) http.HandlerFunc {
 
 // GetFullURLHandler godoc
 // @Summary	Redirects to the full url, if found in storage by {id}
+// @Description	Redirect status and passing of the query to the full url are configured per url.
+// @Description	If {id} ends with "+", preview page of the link is shown instead of redirect.
+// @Description	Interstitial page is shown before redirect, if it's enabled for the link or globally.
+// @Description	{id} is looked up in the short domain of the Host header.
 // @Produce	plain
+// @Produce	html
 // @Param	id	path	string	true	"url id"
+// @Success	200	"preview or interstitial page"
+// @Success	301	"redirects to full url"
+// @Success	302	"redirects to full url"
 // @Success	307	"redirects to full url"
+// @Success	308	"redirects to full url"
 // @Failure	400	{string}	string	"Bad request"
 // @Failure	404	{string}	string	"Not found"
 // @Failure	410	{string}	string	"Record has been deleted"
+// @Failure	410	{string}	string	"Clicks limit exhausted"
+// @Failure	410	{string}	string	"Link has been disabled"
 // @Header	307	{string}	Location	"http://example.com/"
 // @Router	/{id}	[get]
-func GetFullURLHandler(storage storage.Storager) http.HandlerFunc {
+func GetFullURLHandler(
+	generator urlgenerator.URLGenerator,
+	store storage.Storager,
+	domains domains.Resolver,
+	alwaysInterstitial bool,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
 		if id == "" {
 			http.Error(w, "Bad request", http.StatusBadRequest)
 			return
 		}
+		if strings.HasSuffix(id, previewSuffix) {
+			showPreview(w, r, generator, store, requestKey(r, domains, strings.TrimSuffix(id, previewSuffix)))
+			return
+		}
 
-		record, err := storage.Load(r.Context(), id)
+		record, err := store.RegisterClick(r.Context(), requestKey(r, domains, id))
 		if err != nil {
+			if errors.Is(err, storage.ErrClicksExhausted) {
+				http.Error(w, "Clicks limit exhausted", http.StatusGone)
+				return
+			}
+			var notFoundError *storage.RecordNotFoundError
+			if !errors.As(err, &notFoundError) {
+				log.Println("ERROR:", err)
+			}
 			http.Error(w, "Not found", http.StatusNotFound)
 			return
 		}
@@ -69,22 +104,174 @@ func GetFullURLHandler(storage storage.Storager) http.HandlerFunc {
 			http.Error(w, "Record has been deleted", http.StatusGone)
 			return
 		}
-		http.Redirect(w, r, record.Full, http.StatusTemporaryRedirect)
+		if record.Disabled {
+			http.Error(w, "Link has been disabled", http.StatusGone)
+			return
+		}
+		target := redirectURL(record, r.URL.Query())
+		if alwaysInterstitial || record.Interstitial {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = pages.RenderInterstitial(w, pages.InterstitialData{
+				ShortURL:    generator.GetURL(record.Key()),
+				Destination: target,
+			})
+			if err != nil {
+				log.Println("ERROR:", err)
+			}
+			return
+		}
+		http.Redirect(w, r, target, redirectStatus(record))
+	}
+}
+
+// previewSuffix appended to the short shows preview page instead of redirect
+const previewSuffix = "+"
+
+// showPreview renders preview page of the short by its key. Clicks are shown only to the owner of the short.
+// Preview doesn't count clicks, so destination of the link with clicks limit is shown only to the owner
+func showPreview(w http.ResponseWriter, r *http.Request, generator urlgenerator.URLGenerator, store storage.Storager, key string) {
+	record, err := store.Load(r.Context(), key)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if record.Deleted {
+		http.Error(w, "Record has been deleted", http.StatusGone)
+		return
+	}
+	if record.Disabled {
+		http.Error(w, "Link has been disabled", http.StatusGone)
+		return
+	}
+	if record.Exhausted() {
+		http.Error(w, "Clicks limit exhausted", http.StatusGone)
+		return
+	}
+
+	userID, _ := getUserIDFromRequest(r)
+	isOwner := userID != "" && userID == record.UserID
+	data := pages.PreviewData{
+		ShortURL:   generator.GetURL(record.Key()),
+		CreatedAt:  record.CreatedAt,
+		ShowClicks: isOwner,
+		Clicks:     record.Clicks,
+		MaxClicks:  record.MaxClicks,
+	}
+	if isOwner || record.MaxClicks == 0 {
+		data.Destination = record.Full
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err = pages.RenderPreview(w, data); err != nil {
+		log.Println("ERROR:", err)
 	}
 }
 
+// GetQRCodeHandler godoc
+// @Summary	Renders QR code of the short url
+// @Produce	png
+// @Produce	image/svg+xml
+// @Param	id	path	string	true	"url id"
+// @Param	format	query	string	false	"Image format: png or svg"	default(png)
+// @Param	size	query	int	false	"Image width and height in pixels"	default(256)
+// @Param	margin	query	int	false	"Quiet zone width in modules"	default(4)
+// @Param	level	query	string	false	"Error correction level: L, M, Q or H"	default(M)
+// @Success	200	"QR code image"
+// @Failure	400	{string}	string	"Bad request"
+// @Failure	404	{string}	string	"Not found"
+// @Failure	410	{string}	string	"Record has been deleted"
+// @Router	/{id}/qr	[get]
+func GetQRCodeHandler(
+	generator urlgenerator.URLGenerator,
+	store storage.Storager,
+	domains domains.Resolver,
+	qr *qrgenerator.Generator,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if id == "" {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		opts, err := parseQROptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		record, err := store.Load(r.Context(), requestKey(r, domains, id))
+		if err != nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if record.Deleted {
+			http.Error(w, "Record has been deleted", http.StatusGone)
+			return
+		}
+
+		data, err := qr.Render(record.Short, generator.GetURL(record.Key()), opts)
+		if err != nil {
+			if errors.Is(err, qrgenerator.ErrSizeTooSmall) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", opts.ContentType())
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		_, err = w.Write(data)
+		if err != nil {
+			log.Println("ERROR:", err)
+			panic(err)
+		}
+	}
+}
+
+// parseQROptions reads QR code options from query, missing values are taken from defaults
+func parseQROptions(query url.Values) (qrgenerator.Options, error) {
+	var err error
+	opts := qrgenerator.DefaultOptions()
+	if format := query.Get("format"); format != "" {
+		opts.Format = qrgenerator.Format(format)
+	}
+	if size := query.Get("size"); size != "" {
+		if opts.Size, err = strconv.Atoi(size); err != nil {
+			return opts, fmt.Errorf("invalid size: %s", size)
+		}
+	}
+	if margin := query.Get("margin"); margin != "" {
+		if opts.Margin, err = strconv.Atoi(margin); err != nil {
+			return opts, fmt.Errorf("invalid margin: %s", margin)
+		}
+	}
+	if level := query.Get("level"); level != "" {
+		opts.Level = level
+	}
+	return opts, opts.Validate()
+}
+
 // CreateFullURLHandler godoc
 // @Summary	Create new short url
 // @Accept	plain
 // @Produce	plain
 // @Param	url	body	string	true	"Full url for shortening"
+// @Param	domain	query	string	false	"Domain of the short url, domain of the request host if empty"
 // @Success	201	{string}	string	"http://shortener.org/123"
 // @Failure	409	{string}	string	"http://shortener.org/123"
 // @Failure	400	{string}	string	"Empty request"
 // @Failure	400	{string}	string	"invalid url: http//example"
+// @Failure	400	{string}	string	"unknown domain: example.com"
 // @Failure	500	{string}	string	"Server error"
 // @Router	/	[post]
-func CreateFullURLHandler(generator urlgenerator.URLGenerator, store storage.Storager) http.HandlerFunc {
+func CreateFullURLHandler(
+	generator urlgenerator.URLGenerator,
+	store storage.Storager,
+	normalizer urlnormalizer.Canonicalizer,
+	domains domains.Resolver,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		responseStatus := http.StatusCreated
 		body, err := io.ReadAll(r.Body)
@@ -109,6 +296,11 @@ func CreateFullURLHandler(generator urlgenerator.URLGenerator, store storage.Sto
 			http.Error(w, invalidURLError(fullURL), http.StatusBadRequest)
 			return
 		}
+		domain, err := requestDomain(r, domains, r.URL.Query().Get("domain"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		//short := generator.GenerateShort(fullURL)
 		short, err := storage.NewRecord(fullURL, userID)
@@ -116,6 +308,11 @@ func CreateFullURLHandler(generator urlgenerator.URLGenerator, store storage.Sto
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		short.Domain = domain
+		if err = applyCanonical(&short, normalizer); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		err = store.Store(r.Context(), short)
 		if err != nil {
@@ -130,7 +327,7 @@ func CreateFullURLHandler(generator urlgenerator.URLGenerator, store storage.Sto
 		}
 
 		w.WriteHeader(responseStatus)
-		_, _ = fmt.Fprint(w, generator.GetURL(short.Short))
+		_, _ = fmt.Fprint(w, generator.GetURL(short.Key()))
 	}
 }
 
@@ -144,7 +341,12 @@ func CreateFullURLHandler(generator urlgenerator.URLGenerator, store storage.Sto
 // @Failure	400	{object}	responses.ErrorResponse
 // @Failure	500	{object}	responses.ErrorResponse
 // @Router	/api/shorten	[post]
-func JSONCreateShort(generator urlgenerator.URLGenerator, store storage.Storager) http.HandlerFunc {
+func JSONCreateShort(
+	generator urlgenerator.URLGenerator,
+	store storage.Storager,
+	normalizer urlnormalizer.Canonicalizer,
+	domains domains.Resolver,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		responseStatus := http.StatusCreated
 		body, err := io.ReadAll(r.Body)
@@ -176,6 +378,11 @@ func JSONCreateShort(generator urlgenerator.URLGenerator, store storage.Storager
 			jsonError(w, invalidURLError(createRequest.URL), http.StatusBadRequest)
 			return
 		}
+		domain, err := requestDomain(r, domains, createRequest.Domain)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		short, err := storage.NewRecord(createRequest.URL, userID)
 		if err != nil {
@@ -183,13 +390,35 @@ func JSONCreateShort(generator urlgenerator.URLGenerator, store storage.Storager
 			jsonError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		short.Domain = domain
+		if createRequest.Workspace != "" {
+			if err = checkRole(r.Context(), store, createRequest.Workspace, userID, storage.RoleEditor); err != nil {
+				writeWorkspaceError(w, err)
+				return
+			}
+			short.WorkspaceID = createRequest.Workspace
+		}
+		if err = applySettings(&short, createRequest.ShortSettings); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = applyUTM(&short, createRequest.UTM); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = applyCanonical(&short, normalizer); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
+		var dedupScope storage.DedupScope
 		err = store.Store(r.Context(), short)
 		if err != nil {
 			var conflictError *storage.RecordConflictError
 			if errors.As(err, &conflictError) {
 				responseStatus = http.StatusConflict
 				short = conflictError.OldRecord
+				dedupScope = conflictError.Scope
 			} else {
 				log.Println("ERROR:", err)
 				jsonError(w, err.Error(), http.StatusInternalServerError)
@@ -197,7 +426,13 @@ func JSONCreateShort(generator urlgenerator.URLGenerator, store storage.Storager
 			}
 		}
 
-		createResponse := responses.CreateShortResponse{Result: generator.GetURL(short.Short)}
+		createResponse := responses.CreateShortResponse{
+			Result:     generator.GetURL(short.Key()),
+			DedupScope: string(dedupScope),
+		}
+		if createRequest.QR {
+			createResponse.QR = generator.GetURL(short.Key()) + "/qr"
+		}
 		data, err := json.Marshal(createResponse)
 		if err != nil {
 			log.Println("ERROR:", err)
@@ -220,11 +455,19 @@ func JSONCreateShort(generator urlgenerator.URLGenerator, store storage.Storager
 // @Accept	json
 // @Produce	json
 // @Param	fullURList	body	requests.CreateShortBatchRequest	true	"List of full urls for shortening"
-// @Success	201	{object}	responses.CreateShortBatchResponse
+// @Success	201	{object}	responses.CreateShortBatchResponse	"All urls saved"
+// @Success	207	{object}	responses.CreateShortBatchResponse	"Some urls saved, others were added earlier or have errors"
+// @Failure	409	{object}	responses.CreateShortBatchResponse	"All urls were added earlier, old short urls are returned"
+// @Failure	400	{object}	responses.CreateShortBatchResponse	"All urls have errors"
 // @Failure	400	{object}	responses.ErrorResponse
 // @Failure	500	{object}	responses.ErrorResponse
 // @Router	/api/shorten/batch	[post]
-func JSONCreateShortBatch(generator urlgenerator.URLGenerator, store storage.Storager) http.HandlerFunc {
+func JSONCreateShortBatch(
+	generator urlgenerator.URLGenerator,
+	store storage.Storager,
+	normalizer urlnormalizer.Canonicalizer,
+	domains domains.Resolver,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
@@ -254,32 +497,42 @@ func JSONCreateShortBatch(generator urlgenerator.URLGenerator, store storage.Sto
 		ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
 		defer cancel()
 
-		response := responses.CreateShortBatchResponse{}
+		response := make(responses.CreateShortBatchResponse, len(batch))
+		// keys of the records by index of the item, empty for invalid items
+		keys := make([]string, len(batch))
 		batchInserter := storage.NewBatchInserter(store, 10)
-		for _, item := range batch {
-			if !isValidURL(item.OriginalURL) {
-				jsonError(w, invalidURLError(item.OriginalURL), http.StatusBadRequest)
-				return
+		// results of role checks by workspace, checked once per request
+		workspaceErrors := make(map[string]error)
+		for i, item := range batch {
+			response[i].CorrelationID = item.CorrelationID
+			domain, err2 := requestDomain(r, domains, item.Domain)
+			if err2 != nil {
+				response[i].Error = err2.Error()
+				continue
 			}
-
-			r, err2 := storage.NewRecord(item.OriginalURL, userID)
+			if item.Workspace != "" {
+				roleErr, checked := workspaceErrors[item.Workspace]
+				if !checked {
+					roleErr = checkRole(ctx, store, item.Workspace, userID, storage.RoleEditor)
+					workspaceErrors[item.Workspace] = roleErr
+				}
+				if roleErr != nil {
+					response[i].Error = roleErr.Error()
+					continue
+				}
+			}
+			record, err2 := newBatchRecord(item, userID, domain, normalizer)
 			if err2 != nil {
-				log.Println("ERROR:", err2)
-				jsonError(w, err2.Error(), http.StatusInternalServerError)
-				return
+				response[i].Error = err2.Error()
+				continue
 			}
 
-			if err2 = batchInserter.AddItem(ctx, r); err2 != nil {
+			if err2 = batchInserter.AddItem(ctx, record); err2 != nil {
 				log.Println("ERROR:", err2)
 				jsonError(w, err2.Error(), http.StatusInternalServerError)
 				return
 			}
-
-			responseItem := responses.CreateShortBatchResponseItem{
-				CorrelationID: item.CorrelationID,
-				ShortURL:      generator.GetURL(r.Short),
-			}
-			response = append(response, responseItem)
+			keys[i] = record.Key()
 		}
 
 		if err = batchInserter.Flush(ctx); err != nil {
@@ -288,6 +541,25 @@ func JSONCreateShortBatch(generator urlgenerator.URLGenerator, store storage.Sto
 			return
 		}
 
+		var created, conflicts int
+		for i, key := range keys {
+			if key == "" {
+				continue
+			}
+			if batchInserter.Taken(key) {
+				response[i].Error = storage.ErrShortTaken.Error()
+				continue
+			}
+			if old, ok := batchInserter.Conflict(key); ok {
+				key = old.Key()
+				response[i].Conflict = true
+				conflicts++
+			} else {
+				created++
+			}
+			response[i].ShortURL = generator.GetURL(key)
+		}
+
 		data, err := json.Marshal(response)
 		if err != nil {
 			log.Println("ERROR:", err)
@@ -296,7 +568,7 @@ func JSONCreateShortBatch(generator urlgenerator.URLGenerator, store storage.Sto
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(batchStatus(len(batch), created, conflicts))
 		_, err = w.Write(data)
 		if err != nil {
 			log.Println("ERROR:", err)
@@ -304,6 +576,45 @@ func JSONCreateShortBatch(generator urlgenerator.URLGenerator, store storage.Sto
 		}
 	}
 }
+
+// newBatchRecord validates item of the batch and creates record from it
+func newBatchRecord(item requests.CreateShortBatchItem, userID, domain string, normalizer urlnormalizer.Canonicalizer) (storage.Record, error) {
+	if !isValidURL(item.OriginalURL) {
+		return storage.Record{}, errors.New(invalidURLError(item.OriginalURL))
+	}
+	record, err := storage.NewRecord(item.OriginalURL, userID)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	record.Domain = domain
+	record.WorkspaceID = item.Workspace
+	if err = applySettings(&record, item.ShortSettings); err != nil {
+		return storage.Record{}, err
+	}
+	if err = applyUTM(&record, item.UTM); err != nil {
+		return storage.Record{}, err
+	}
+	if err = applyCanonical(&record, normalizer); err != nil {
+		return storage.Record{}, err
+	}
+	return record, nil
+}
+
+// batchStatus returns status of the batch response: 201 if all items are created, 409 if all items
+// were added earlier, 400 if all items have errors and 207 for mixed results
+func batchStatus(total, created, conflicts int) int {
+	switch {
+	case created == total:
+		return http.StatusCreated
+	case conflicts == total:
+		return http.StatusConflict
+	case created == 0 && conflicts == 0:
+		return http.StatusBadRequest
+	default:
+		return http.StatusMultiStatus
+	}
+}
+
 func isValidURL(uri string) bool {
 	_, err := url.ParseRequestURI(uri)
 	return err == nil
@@ -338,15 +649,69 @@ func JSONGetShortsForCurrentUser(generator urlgenerator.URLGenerator, storage st
 		}
 
 		listResponse := make(responses.ListShortsResponse, len(recordsList))
-		i := 0
+		for i, record := range recordsList {
+			listResponse[i] = newListShortItem(generator, record)
+		}
+		data, err := json.Marshal(listResponse)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(data)
+		if err != nil {
+			log.Println("ERROR:", err)
+			panic(err)
+		}
+	}
+}
+
+// JSONGetCampaignsForCurrentUser godoc
+// @Summary	Get urls user shortened with UTM tags, grouped by campaign
+// @Produce	json
+// @Success	200	{object}	responses.CampaignsResponse	"List of campaigns with urls"
+// @Success	204	"No Content. User not added any tagged urls yet"
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/user/campaigns	[get]
+func JSONGetCampaignsForCurrentUser(generator urlgenerator.URLGenerator, storage storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		recordsList, err := storage.LoadForUser(r.Context(), userID)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		campaigns := make(map[string]responses.ListShortsResponse)
 		for _, record := range recordsList {
-			listResponse[i] = responses.ListShortItem{
-				ShortURL:    generator.GetURL(record.Short),
-				OriginalURL: record.Full,
+			if record.UTM.Campaign == "" {
+				continue
 			}
-			i++
+			campaigns[record.UTM.Campaign] = append(campaigns[record.UTM.Campaign], newListShortItem(generator, record))
 		}
-		data, err := json.Marshal(listResponse)
+		if len(campaigns) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		campaignsResponse := make(responses.CampaignsResponse, 0, len(campaigns))
+		for campaign, urls := range campaigns {
+			campaignsResponse = append(campaignsResponse, responses.CampaignItem{Campaign: campaign, URLs: urls})
+		}
+		sort.Slice(campaignsResponse, func(i, j int) bool {
+			return campaignsResponse[i].Campaign < campaignsResponse[j].Campaign
+		})
+
+		data, err := json.Marshal(campaignsResponse)
 		if err != nil {
 			log.Println("ERROR:", err)
 			jsonError(w, err.Error(), http.StatusInternalServerError)
@@ -362,16 +727,30 @@ func JSONGetShortsForCurrentUser(generator urlgenerator.URLGenerator, storage st
 	}
 }
 
+func newListShortItem(generator urlgenerator.URLGenerator, record storage.Record) responses.ListShortItem {
+	item := responses.ListShortItem{
+		ShortURL:    generator.GetURL(record.Key()),
+		OriginalURL: record.Full,
+		BaseURL:     record.BaseURL,
+		WorkspaceID: record.WorkspaceID,
+	}
+	if !record.UTM.IsEmpty() {
+		tags := record.UTM
+		item.UTM = &tags
+	}
+	return item
+}
+
 // JSONDeleteUserShorts godoc
 // @Summary	Delete urls user shortened earlier
 // @Accept	json
 // @Produce	json
-// @Param	deleteURLs	body	requests.DeleteShortBatchRequest	true	"List of urls to delete"
+// @Param	deleteURLs	body	requests.DeleteShortBatchRequest	true	"List of shorts to delete from the domain of the request host"
 // @Success	202	"Delete request accepted and put on queue, urls will be deleted eventually"
 // @Failure	400	{object}	responses.ErrorResponse
 // @Failure	500	{object}	responses.ErrorResponse
 // @Router	/api/user/urls	[delete]
-func JSONDeleteUserShorts(_ storage.Storager, batchDeleter *storage.BatchDeleter) http.HandlerFunc {
+func JSONDeleteUserShorts(domains domains.Resolver, batchDeleter *storage.BatchDeleter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
@@ -401,7 +780,11 @@ func JSONDeleteUserShorts(_ storage.Storager, batchDeleter *storage.BatchDeleter
 		//ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 		//defer cancel()
 
-		batchDeleter.QueueItems(shorts, userID)
+		keys := make([]string, len(shorts))
+		for i, short := range shorts {
+			keys[i] = requestKey(r, domains, short)
+		}
+		batchDeleter.QueueItems(keys, userID)
 
 		//// check does all shorts exists and belongs to current user
 		//records, err := store.LoadBatch(ctx, shorts)
@@ -426,6 +809,95 @@ func JSONDeleteUserShorts(_ storage.Storager, batchDeleter *storage.BatchDeleter
 	}
 }
 
+// JSONUpdateUserShort godoc
+// @Summary	Change settings of the url user shortened earlier
+// @Accept	json
+// @Produce	json
+// @Param	id	path	string	true	"url id"
+// @Param	settings	body	requests.UpdateShortRequest	true	"Changed settings"
+// @Success	200	{object}	responses.ShortInfoResponse	"Updated url"
+// @Failure	400	{object}	responses.ErrorResponse
+// @Failure	403	{object}	responses.ErrorResponse
+// @Failure	404	{object}	responses.ErrorResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Description	Urls of the workspace can be changed by its editors and admins
+// @Router	/api/user/urls/{id}	[patch]
+func JSONUpdateUserShort(generator urlgenerator.URLGenerator, store storage.Storager, domains domains.Resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(body) == 0 {
+			jsonError(w, "Empty request", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		update := requests.UpdateShortRequest{}
+		if err = json.Unmarshal(body, &update); err != nil {
+			jsonError(w, "Request can't be parsed", http.StatusBadRequest)
+			return
+		}
+
+		record, err := store.Load(r.Context(), requestKey(r, domains, id))
+		if err != nil || record.Deleted {
+			jsonError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if err = checkCanEdit(r.Context(), store, record, userID); err != nil {
+			writeWorkspaceError(w, err)
+			return
+		}
+
+		if err = applyUpdate(&record, update); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err = store.Update(r.Context(), record); err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(newShortInfoResponse(generator, record))
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(data)
+		if err != nil {
+			log.Println("ERROR:", err)
+			panic(err)
+		}
+	}
+}
+
+func newShortInfoResponse(generator urlgenerator.URLGenerator, record storage.Record) responses.ShortInfoResponse {
+	return responses.ShortInfoResponse{
+		ShortURL:       generator.GetURL(record.Key()),
+		OriginalURL:    record.Full,
+		MaxClicks:      record.MaxClicks,
+		Clicks:         record.Clicks,
+		Interstitial:   record.Interstitial,
+		RedirectStatus: redirectStatus(record),
+		Passthrough:    string(record.Passthrough),
+	}
+}
+
 // BadRequestHandler handles requests to route with method not supported by route
 func BadRequestHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
@@ -457,6 +929,19 @@ func getUserIDFromRequest(r *http.Request) (string, error) {
 	return userID, nil
 }
 
+// requestKey returns storage key of the short in the domain of the request host
+func requestKey(r *http.Request, domains domains.Resolver, short string) string {
+	return storage.Key(domains.FromHost(r.Host), short)
+}
+
+// requestDomain returns domain chosen in the request or domain of the request host, if name is empty
+func requestDomain(r *http.Request, domains domains.Resolver, name string) (string, error) {
+	if name == "" {
+		return domains.FromHost(r.Host), nil
+	}
+	return domains.Lookup(name)
+}
+
 func invalidURLError(uri string) string {
 	return fmt.Sprintf("invalid url: %s", uri)
 }
@@ -2,17 +2,21 @@ package handlers_test
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/putalexey/go-practicum/internal/app/domains"
 	"github.com/putalexey/go-practicum/internal/app/shortener/handlers"
 	"github.com/putalexey/go-practicum/internal/app/storage"
+	"github.com/putalexey/go-practicum/internal/app/urlgenerator"
 	"net/http"
 )
 
 func Example() {
 	mux := chi.NewMux()
 	store := storage.NewMemoryStorage(nil)
+	generator := &urlgenerator.SequenceGenerator{BaseURL: "http://localhost:8080"}
+	registry := domains.NewRegistry(generator.BaseURL, []string{"go.example.com"})
 
 	mux.Get("/ping", handlers.PingHandler(store))
-	mux.Get("/{id}", handlers.GetFullURLHandler(store))
+	mux.Get("/{id}", handlers.GetFullURLHandler(generator, store, registry, false))
 
 	srv := http.Server{
 		Addr:    ":8080",
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/putalexey/go-practicum/internal/app/shortener/requests"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
+	"github.com/putalexey/go-practicum/internal/app/utm"
+)
+
+// allowedRedirectStatuses lists http statuses, user can choose for redirect
+var allowedRedirectStatuses = map[int]bool{
+	301: true,
+	302: true,
+	307: true,
+	308: true,
+}
+
+var errNegativeMaxClicks = errors.New("max_clicks can't be negative")
+
+// applySettings validates settings from request and sets them to the record
+func applySettings(record *storage.Record, settings requests.ShortSettings) error {
+	if settings.MaxClicks < 0 {
+		return errNegativeMaxClicks
+	}
+	if err := validateRedirectStatus(settings.RedirectStatus); err != nil {
+		return err
+	}
+	passthrough, err := parsePassthrough(settings.Passthrough)
+	if err != nil {
+		return err
+	}
+
+	record.MaxClicks = settings.MaxClicks
+	record.Interstitial = settings.Interstitial
+	record.RedirectStatus = settings.RedirectStatus
+	record.Passthrough = passthrough
+	return nil
+}
+
+// applyUTM adds UTM tags to the full url of the record, keeping untagged url and tags in the record
+func applyUTM(record *storage.Record, tags *utm.Tags) error {
+	if tags == nil || tags.IsEmpty() {
+		return nil
+	}
+	tagged, untagged, normalized, err := utm.Build(record.Full, *tags)
+	if err != nil {
+		return err
+	}
+	record.Full = tagged
+	record.BaseURL = untagged
+	record.UTM = normalized
+	return nil
+}
+
+// applyCanonical sets canonical form of the full url to the record, used by storage to detect conflicts
+func applyCanonical(record *storage.Record, normalizer urlnormalizer.Canonicalizer) error {
+	canonical, err := record.Canonicalize(normalizer)
+	if err != nil {
+		return fmt.Errorf("url can't be normalized: %w", err)
+	}
+	record.Canonical = canonical
+	return nil
+}
+
+// applyUpdate validates changed settings from request and sets them to the record
+func applyUpdate(record *storage.Record, update requests.UpdateShortRequest) error {
+	if update.MaxClicks != nil {
+		if *update.MaxClicks < 0 {
+			return errNegativeMaxClicks
+		}
+		record.MaxClicks = *update.MaxClicks
+	}
+	if update.Interstitial != nil {
+		record.Interstitial = *update.Interstitial
+	}
+	if update.RedirectStatus != nil {
+		if err := validateRedirectStatus(*update.RedirectStatus); err != nil {
+			return err
+		}
+		record.RedirectStatus = *update.RedirectStatus
+	}
+	if update.Passthrough != nil {
+		passthrough, err := parsePassthrough(*update.Passthrough)
+		if err != nil {
+			return err
+		}
+		record.Passthrough = passthrough
+	}
+	return nil
+}
+
+func validateRedirectStatus(status int) error {
+	if status != 0 && !allowedRedirectStatuses[status] {
+		return fmt.Errorf("unsupported redirect_status: %d", status)
+	}
+	return nil
+}
+
+func parsePassthrough(value string) (storage.Passthrough, error) {
+	switch p := storage.Passthrough(value); p {
+	case storage.PassthroughNone, storage.PassthroughMerge, storage.PassthroughOverride:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unsupported passthrough: %s", value)
+	}
+}
+
+// redirectStatus returns http status of the redirect for the record
+func redirectStatus(record storage.Record) int {
+	if record.RedirectStatus == 0 {
+		return 307
+	}
+	return record.RedirectStatus
+}
+
+// redirectURL returns url to redirect to, combining full url of the record with the query of the request
+// according to record's passthrough mode
+func redirectURL(record storage.Record, query url.Values) string {
+	if record.Passthrough == storage.PassthroughNone || len(query) == 0 {
+		return record.Full
+	}
+	target, err := url.Parse(record.Full)
+	if err != nil {
+		return record.Full
+	}
+
+	targetQuery := target.Query()
+	for key, values := range query {
+		if _, exists := targetQuery[key]; exists && record.Passthrough == storage.PassthroughMerge {
+			continue
+		}
+		targetQuery[key] = values
+	}
+	target.RawQuery = targetQuery.Encode()
+	return target.String()
+}
@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/putalexey/go-practicum/internal/app/domains"
+	"github.com/putalexey/go-practicum/internal/app/shortener/requests"
+	"github.com/putalexey/go-practicum/internal/app/shortener/responses"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+	"github.com/putalexey/go-practicum/internal/app/urlgenerator"
+)
+
+// maxWorkspaceNameLength is limited by the column of the workspaces table
+const maxWorkspaceNameLength = 255
+
+var errLastAdmin = errors.New("workspace must keep at least one admin")
+
+// JSONGetCurrentUser godoc
+// @Summary	Get id of the current user, which is used to invite the user to workspaces
+// @Produce	json
+// @Success	200	{object}	responses.UserResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/user	[get]
+func JSONGetCurrentUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, responses.UserResponse{UserID: userID})
+	}
+}
+
+// JSONCreateWorkspace godoc
+// @Summary	Create workspace, current user becomes its admin
+// @Accept	json
+// @Produce	json
+// @Param	workspace	body	requests.CreateWorkspaceRequest	true	"Workspace"
+// @Success	201	{object}	responses.WorkspaceItem	"Created workspace"
+// @Failure	400	{object}	responses.ErrorResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/workspaces	[post]
+func JSONCreateWorkspace(store storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		createRequest := requests.CreateWorkspaceRequest{}
+		if err = json.Unmarshal(body, &createRequest); err != nil {
+			jsonError(w, "Request can't be parsed", http.StatusBadRequest)
+			return
+		}
+		if createRequest.Name == "" || len(createRequest.Name) > maxWorkspaceNameLength {
+			jsonError(w, "name of the workspace is required and must be up to 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		workspace, err := storage.NewWorkspace(createRequest.Name)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err = store.CreateWorkspace(r.Context(), workspace, userID); err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, newWorkspaceItem(storage.Membership{Workspace: workspace, Role: storage.RoleAdmin}))
+	}
+}
+
+// JSONGetWorkspaces godoc
+// @Summary	Get workspaces of the current user
+// @Produce	json
+// @Success	200	{object}	responses.WorkspacesResponse	"Workspaces with roles of the user"
+// @Success	204	"No Content. User isn't member of any workspace"
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/workspaces	[get]
+func JSONGetWorkspaces(store storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := getUserIDFromRequest(r)
+		if err != nil {
+			log.Println("ERROR:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		memberships, err := store.LoadWorkspacesForUser(r.Context(), userID)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(memberships) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		workspaces := make(responses.WorkspacesResponse, len(memberships))
+		for i, m := range memberships {
+			workspaces[i] = newWorkspaceItem(m)
+		}
+		writeJSON(w, http.StatusOK, workspaces)
+	}
+}
+
+// JSONGetWorkspaceMembers godoc
+// @Summary	Get members of the workspace, viewer role is required
+// @Produce	json
+// @Param	workspace	path	string	true	"workspace id"
+// @Success	200	{object}	responses.MembersResponse	"Members with their roles"
+// @Failure	403	{object}	responses.ErrorResponse
+// @Failure	404	{object}	responses.ErrorResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/workspaces/{workspace}/members	[get]
+func JSONGetWorkspaceMembers(store storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceID := chi.URLParam(r, "workspace")
+		if !authorizeWorkspace(w, r, store, workspaceID, storage.RoleViewer) {
+			return
+		}
+
+		members, err := store.LoadMembers(r.Context(), workspaceID)
+		if err != nil {
+			writeWorkspaceError(w, err)
+			return
+		}
+		membersResponse := make(responses.MembersResponse, len(members))
+		for i, m := range members {
+			membersResponse[i] = responses.MemberItem{UserID: m.UserID, Role: string(m.Role)}
+		}
+		writeJSON(w, http.StatusOK, membersResponse)
+	}
+}
+
+// JSONSetWorkspaceMember godoc
+// @Summary	Invite user to the workspace or change role of the member, admin role is required
+// @Accept	json
+// @Produce	json
+// @Param	workspace	path	string	true	"workspace id"
+// @Param	user	path	string	true	"user id"
+// @Param	role	body	requests.SetMemberRequest	true	"Role of the member"
+// @Success	200	{object}	responses.MemberItem	"Member with the new role"
+// @Failure	400	{object}	responses.ErrorResponse
+// @Failure	403	{object}	responses.ErrorResponse
+// @Failure	404	{object}	responses.ErrorResponse
+// @Failure	409	{object}	responses.ErrorResponse	"The last admin can't be demoted"
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/workspaces/{workspace}/members/{user}	[put]
+func JSONSetWorkspaceMember(store storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceID := chi.URLParam(r, "workspace")
+		memberID := chi.URLParam(r, "user")
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !authorizeWorkspace(w, r, store, workspaceID, storage.RoleAdmin) {
+			return
+		}
+
+		setRequest := requests.SetMemberRequest{}
+		if err = json.Unmarshal(body, &setRequest); err != nil {
+			jsonError(w, "Request can't be parsed", http.StatusBadRequest)
+			return
+		}
+		role, err := storage.ParseRole(setRequest.Role)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if role != storage.RoleAdmin {
+			if err = checkNotLastAdmin(r.Context(), store, workspaceID, memberID); err != nil {
+				writeWorkspaceError(w, err)
+				return
+			}
+		}
+
+		member := storage.Member{WorkspaceID: workspaceID, UserID: memberID, Role: role}
+		if err = store.SetMember(r.Context(), member); err != nil {
+			writeWorkspaceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, responses.MemberItem{UserID: member.UserID, Role: string(member.Role)})
+	}
+}
+
+// JSONRemoveWorkspaceMember godoc
+// @Summary	Remove user from the workspace, admin role is required
+// @Produce	json
+// @Param	workspace	path	string	true	"workspace id"
+// @Param	user	path	string	true	"user id"
+// @Success	204	"Member removed"
+// @Failure	403	{object}	responses.ErrorResponse
+// @Failure	404	{object}	responses.ErrorResponse
+// @Failure	409	{object}	responses.ErrorResponse	"The last admin can't be removed"
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/workspaces/{workspace}/members/{user}	[delete]
+func JSONRemoveWorkspaceMember(store storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceID := chi.URLParam(r, "workspace")
+		memberID := chi.URLParam(r, "user")
+		if !authorizeWorkspace(w, r, store, workspaceID, storage.RoleAdmin) {
+			return
+		}
+		if err := checkNotLastAdmin(r.Context(), store, workspaceID, memberID); err != nil {
+			writeWorkspaceError(w, err)
+			return
+		}
+		if err := store.RemoveMember(r.Context(), workspaceID, memberID); err != nil {
+			writeWorkspaceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// JSONGetWorkspaceShorts godoc
+// @Summary	Get urls of the workspace, viewer role is required
+// @Produce	json
+// @Param	workspace	path	string	true	"workspace id"
+// @Success	200	{object}	responses.ListShortsResponse	"List of urls of the workspace"
+// @Success	204	"No Content. Workspace has no urls yet"
+// @Failure	403	{object}	responses.ErrorResponse
+// @Failure	404	{object}	responses.ErrorResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/workspaces/{workspace}/urls	[get]
+func JSONGetWorkspaceShorts(generator urlgenerator.URLGenerator, store storage.Storager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceID := chi.URLParam(r, "workspace")
+		if !authorizeWorkspace(w, r, store, workspaceID, storage.RoleViewer) {
+			return
+		}
+
+		recordsList, err := store.LoadForWorkspace(r.Context(), workspaceID)
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(recordsList) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		listResponse := make(responses.ListShortsResponse, len(recordsList))
+		for i, record := range recordsList {
+			listResponse[i] = newListShortItem(generator, record)
+		}
+		writeJSON(w, http.StatusOK, listResponse)
+	}
+}
+
+// JSONDeleteWorkspaceShorts godoc
+// @Summary	Delete urls of the workspace, editor role is required
+// @Accept	json
+// @Produce	json
+// @Param	workspace	path	string	true	"workspace id"
+// @Param	deleteURLs	body	requests.DeleteShortBatchRequest	true	"List of shorts to delete from the domain of the request host"
+// @Success	204	"Urls deleted"
+// @Failure	400	{object}	responses.ErrorResponse
+// @Failure	403	{object}	responses.ErrorResponse	"Url doesn't belong to the workspace"
+// @Failure	404	{object}	responses.ErrorResponse
+// @Failure	500	{object}	responses.ErrorResponse
+// @Router	/api/workspaces/{workspace}/urls	[delete]
+func JSONDeleteWorkspaceShorts(store storage.Storager, domains domains.Resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceID := chi.URLParam(r, "workspace")
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !authorizeWorkspace(w, r, store, workspaceID, storage.RoleEditor) {
+			return
+		}
+
+		shorts := requests.DeleteShortBatchRequest{}
+		if err = json.Unmarshal(body, &shorts); err != nil || len(shorts) == 0 {
+			jsonError(w, "Request can't be parsed", http.StatusBadRequest)
+			return
+		}
+
+		keys := make([]string, len(shorts))
+		for i, short := range shorts {
+			keys[i] = requestKey(r, domains, short)
+		}
+		records, err := store.LoadBatch(r.Context(), keys)
+		var notFoundErr *storage.RecordNotFoundError
+		if errors.As(err, &notFoundErr) {
+			jsonError(w, "Not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, record := range records {
+			if record.WorkspaceID != workspaceID {
+				jsonError(w, "url doesn't belong to the workspace: "+record.Short, http.StatusForbidden)
+				return
+			}
+		}
+
+		if err = store.DeleteBatch(r.Context(), keys); err != nil {
+			log.Println("ERROR:", err)
+			jsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// checkRole returns ErrAccessDenied, if role of the user in the workspace doesn't allow the required role
+func checkRole(ctx context.Context, store storage.Storager, workspaceID, userID string, required storage.Role) error {
+	role, err := store.MemberRole(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if !role.Allows(required) {
+		return storage.ErrAccessDenied
+	}
+	return nil
+}
+
+// checkCanEdit returns ErrAccessDenied, if the user neither owns the record nor is editor of its workspace
+func checkCanEdit(ctx context.Context, store storage.Storager, record storage.Record, userID string) error {
+	if record.UserID == userID {
+		return nil
+	}
+	if record.WorkspaceID == "" {
+		return storage.ErrAccessDenied
+	}
+	return checkRole(ctx, store, record.WorkspaceID, userID, storage.RoleEditor)
+}
+
+// checkNotLastAdmin returns errLastAdmin, if the user is the only admin of the workspace
+func checkNotLastAdmin(ctx context.Context, store storage.Storager, workspaceID, userID string) error {
+	members, err := store.LoadMembers(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	admins := 0
+	isAdmin := false
+	for _, m := range members {
+		if m.Role == storage.RoleAdmin {
+			admins++
+			isAdmin = isAdmin || m.UserID == userID
+		}
+	}
+	if isAdmin && admins == 1 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// authorizeWorkspace checks role of the current user in the workspace, writes error response if it's not enough
+func authorizeWorkspace(w http.ResponseWriter, r *http.Request, store storage.Storager, workspaceID string, required storage.Role) bool {
+	userID, err := getUserIDFromRequest(r)
+	if err != nil {
+		log.Println("ERROR:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if err = checkRole(r.Context(), store, workspaceID, userID, required); err != nil {
+		writeWorkspaceError(w, err)
+		return false
+	}
+	return true
+}
+
+// workspaceErrorStatus returns http status of the error returned by workspace operations
+func workspaceErrorStatus(err error) int {
+	var notFoundErr *storage.RecordNotFoundError
+	switch {
+	case errors.Is(err, storage.ErrWorkspaceNotFound), errors.As(err, &notFoundErr):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, errLastAdmin):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeWorkspaceError(w http.ResponseWriter, err error) {
+	status := workspaceErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Println("ERROR:", err)
+	}
+	jsonError(w, err.Error(), status)
+}
+
+func newWorkspaceItem(m storage.Membership) responses.WorkspaceItem {
+	return responses.WorkspaceItem{ID: m.ID, Name: m.Name, Role: string(m.Role), CreatedAt: m.CreatedAt}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println("ERROR:", err)
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	if err != nil {
+		log.Println("ERROR:", err)
+		panic(err)
+	}
+}
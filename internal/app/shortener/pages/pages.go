@@ -0,0 +1,51 @@
+// Package pages renders html pages of the shortener from templates embedded in the binary
+package pages
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"time"
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"formatTime": formatTime,
+}).ParseFS(templatesFS, "templates/*.html"))
+
+// PreviewData is data shown on the link preview page
+type PreviewData struct {
+	ShortURL string
+	// Destination is empty, when it's hidden from the viewer
+	Destination string
+	CreatedAt   time.Time
+	// ShowClicks is true when page is viewed by the owner of the link
+	ShowClicks bool
+	Clicks     int64
+	MaxClicks  int64
+}
+
+// InterstitialData is data shown on the "you are leaving" page
+type InterstitialData struct {
+	ShortURL    string
+	Destination string
+}
+
+// RenderPreview writes preview page of the short link
+func RenderPreview(w io.Writer, data PreviewData) error {
+	return templates.ExecuteTemplate(w, "preview.html", data)
+}
+
+// RenderInterstitial writes page warning user about leaving the service before redirect
+func RenderInterstitial(w io.Writer, data InterstitialData) error {
+	return templates.ExecuteTemplate(w, "interstitial.html", data)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
@@ -1,14 +1,75 @@
 package requests
 
+import "github.com/putalexey/go-practicum/internal/app/utm"
+
+// ShortSettings are optional settings of the short url, which can be set on create
+type ShortSettings struct {
+	// MaxClicks makes link self-destruct after number of redirects, 0 - unlimited
+	MaxClicks int64 `json:"max_clicks,omitempty" example:"1"`
+	// Interstitial shows "you are leaving" page before redirect
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectStatus is http status of redirect: 301, 302, 307 or 308. Default is 307
+	RedirectStatus int `json:"redirect_status,omitempty" example:"301"`
+	// Passthrough passes query of the short url to the full url: "merge" - params of the full url take precedence,
+	// "override" - params of the short url take precedence. Empty - query is ignored
+	Passthrough string `json:"passthrough,omitempty" enums:"merge,override" example:"merge"`
+}
+
 type CreateShortRequest struct {
 	URL string `json:"url" example:"http://example.com/asd"`
+	// QR requests link to the QR code image of the short url in response
+	QR bool `json:"qr,omitempty"`
+	// UTM tags are added to the url, source is required
+	UTM *utm.Tags `json:"utm,omitempty"`
+	// Domain of the short url from the allowed domains, domain of the request host if empty
+	Domain string `json:"domain,omitempty" example:"go.example.com"`
+	// Workspace shares the url with members of the workspace, editor role is required
+	Workspace string `json:"workspace,omitempty" example:"5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"`
+	ShortSettings
 }
 
 type CreateShortBatchRequest []CreateShortBatchItem
 
 type CreateShortBatchItem struct {
+	CorrelationID string    `json:"correlation_id"`
+	OriginalURL   string    `json:"original_url"`
+	UTM           *utm.Tags `json:"utm,omitempty"`
+	// Domain of the short url from the allowed domains, domain of the request host if empty
+	Domain string `json:"domain,omitempty" example:"go.example.com"`
+	// Workspace shares the url with members of the workspace, editor role is required
+	Workspace string `json:"workspace,omitempty" example:"5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"`
+	ShortSettings
+}
+
+// BulkItem is a line of the bulk import in NDJSON format,
+// CSV lines have the same fields: correlation_id,original_url[,alias]
+type BulkItem struct {
 	CorrelationID string `json:"correlation_id"`
 	OriginalURL   string `json:"original_url"`
+	// Alias is the short of the url, generated if empty
+	Alias string `json:"alias,omitempty" example:"my-link"`
 }
 
 type DeleteShortBatchRequest []string
+
+// UpdateShortRequest changes settings of the short url, only not null fields are changed
+type UpdateShortRequest struct {
+	MaxClicks      *int64  `json:"max_clicks,omitempty" example:"10"`
+	Interstitial   *bool   `json:"interstitial,omitempty"`
+	RedirectStatus *int    `json:"redirect_status,omitempty" example:"308"`
+	Passthrough    *string `json:"passthrough,omitempty" enums:",merge,override" example:"override"`
+}
+
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" example:"Marketing"`
+}
+
+// SetMemberRequest invites user to the workspace or changes role of the member
+type SetMemberRequest struct {
+	Role string `json:"role" enums:"viewer,editor,admin" example:"editor"`
+}
+
+// ClaimRequest redeems claim code issued in another browser
+type ClaimRequest struct {
+	Code string `json:"code" example:"K7QX-M2PA-9HTR"`
+}
@@ -1,23 +1,118 @@
 package responses
 
+import (
+	"time"
+
+	"github.com/putalexey/go-practicum/internal/app/utm"
+)
+
 type CreateShortResponse struct {
 	Result string `json:"result" example:"http://shortener.org/123"`
+	QR     string `json:"qr,omitempty" example:"http://shortener.org/123/qr"`
+	// DedupScope is set on conflict: "global" - url was shortened by any user, "user" - by the current user
+	DedupScope string `json:"dedup_scope,omitempty" enums:"global,user" example:"user"`
 }
 
 type ListShortItem struct {
 	ShortURL    string `json:"short_url" example:"http://shortener.org/123"`
 	OriginalURL string `json:"original_url" example:"http://example.com/"`
+	// BaseURL is original url without UTM tags
+	BaseURL string    `json:"base_url,omitempty" example:"http://example.com/"`
+	UTM     *utm.Tags `json:"utm,omitempty"`
+	// WorkspaceID is workspace sharing the url, empty for personal urls
+	WorkspaceID string `json:"workspace_id,omitempty" example:"5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"`
 }
 
 type ListShortsResponse []ListShortItem
 
+// CampaignItem is list of urls tagged with the campaign
+type CampaignItem struct {
+	Campaign string             `json:"campaign" example:"spring_sale"`
+	URLs     ListShortsResponse `json:"urls"`
+}
+
+type CampaignsResponse []CampaignItem
+
 type CreateShortBatchResponse []CreateShortBatchResponseItem
 
 type CreateShortBatchResponseItem struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+	ShortURL      string `json:"short_url,omitempty"`
+	// Conflict is true, when url was added earlier, old short url is returned
+	Conflict bool `json:"conflict,omitempty"`
+	// Error describes why url of the item was not saved
+	Error string `json:"error,omitempty" example:"invalid url: http//example"`
+}
+
+// ExportItem is a record of the user urls export
+type ExportItem struct {
+	ShortURL    string    `json:"short_url" example:"http://shortener.org/123"`
+	OriginalURL string    `json:"original_url" example:"http://example.com/"`
+	CreatedAt   time.Time `json:"created_at" example:"2022-01-07T00:11:53Z"`
+	Deleted     bool      `json:"deleted"`
+	Clicks      int64     `json:"clicks" example:"10"`
+}
+
+// BulkResultItem is a line of the bulk import response
+type BulkResultItem struct {
+	// Line is number of the line in the import, 0 if error is not related to a line
+	Line          int    `json:"line"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	ShortURL      string `json:"short_url,omitempty"`
+	// Conflict is true, when url was added earlier, old short url is returned
+	Conflict bool `json:"conflict,omitempty"`
+	// Error describes why url of the line was not saved
+	Error string `json:"error,omitempty" example:"invalid url: http//example"`
+}
+
+// ShortInfoResponse is short url with its settings
+type ShortInfoResponse struct {
+	ShortURL       string `json:"short_url" example:"http://shortener.org/123"`
+	OriginalURL    string `json:"original_url" example:"http://example.com/"`
+	MaxClicks      int64  `json:"max_clicks" example:"10"`
+	Clicks         int64  `json:"clicks" example:"2"`
+	Interstitial   bool   `json:"interstitial"`
+	RedirectStatus int    `json:"redirect_status" example:"307"`
+	Passthrough    string `json:"passthrough" example:"merge"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error" example:"Not found"`
 }
+
+// UserResponse identifies the current user, user id is shared to be invited to workspaces
+type UserResponse struct {
+	UserID string `json:"user_id" example:"0d2d0c2e-8c7a-4f43-9d1c-7c2f7f3a0b4e"`
+}
+
+// WorkspaceItem is workspace with role of the current user in it
+type WorkspaceItem struct {
+	ID        string    `json:"id" example:"5f0c6c1e-8b4a-4d7e-9a55-3f1b2a9c7d10"`
+	Name      string    `json:"name" example:"Marketing"`
+	Role      string    `json:"role" enums:"viewer,editor,admin" example:"admin"`
+	CreatedAt time.Time `json:"created_at" example:"2022-01-07T00:11:53Z"`
+}
+
+type WorkspacesResponse []WorkspaceItem
+
+type MemberItem struct {
+	UserID string `json:"user_id" example:"0d2d0c2e-8c7a-4f43-9d1c-7c2f7f3a0b4e"`
+	Role   string `json:"role" enums:"viewer,editor,admin" example:"editor"`
+}
+
+type MembersResponse []MemberItem
+
+type ClaimCodeResponse struct {
+	// Code is redeemed in another browser to move its urls to the current user
+	Code      string    `json:"code" example:"K7QXM2PA9HTR"`
+	ExpiresAt time.Time `json:"expires_at" example:"2022-01-07T00:21:53Z"`
+}
+
+type ClaimResponse struct {
+	// UserID is user, the browser is switched to
+	UserID string `json:"user_id" example:"0d2d0c2e-8c7a-4f43-9d1c-7c2f7f3a0b4e"`
+	// Records is number of moved urls
+	Records int `json:"records" example:"3"`
+	// Skipped is number of urls, which the user has shortened already, they aren't moved
+	Skipped int `json:"skipped" example:"1"`
+}
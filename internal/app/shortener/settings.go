@@ -0,0 +1,76 @@
+package shortener
+
+import (
+	"sync/atomic"
+
+	"github.com/putalexey/go-practicum/internal/app/domains"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+	"github.com/putalexey/go-practicum/internal/app/urlgenerator"
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
+)
+
+// settings of the router, which can be changed by Reload while the router serves requests
+type settings struct {
+	baseURL      string
+	interstitial bool
+	requestLog   bool
+	normalizer   urlnormalizer.Normalizer
+	domains      *domains.Registry
+}
+
+// runtimeSettings holds current settings. It is URLGenerator, Canonicalizer and domains Resolver
+// of the handlers, so they see new base url, normalizer and domains right after Reload
+type runtimeSettings struct {
+	value     atomic.Value
+	generator urlgenerator.SequenceGenerator
+}
+
+func (s *runtimeSettings) load() settings {
+	return s.value.Load().(settings)
+}
+
+func (s *runtimeSettings) store(v settings) {
+	s.value.Store(v)
+}
+
+// GenerateShort get next id for the short url
+func (s *runtimeSettings) GenerateShort(fullURL string) string {
+	return s.generator.GenerateShort(fullURL)
+}
+
+// GetURL returns absolute url of the record by its key, combining base url of the record's domain with short
+func (s *runtimeSettings) GetURL(key string) string {
+	return s.load().domains.URL(storage.SplitKey(key))
+}
+
+// FromHost returns domain served on the host of the request
+func (s *runtimeSettings) FromHost(host string) string {
+	return s.load().domains.FromHost(host)
+}
+
+// Lookup returns domain chosen by the user from the current domains
+func (s *runtimeSettings) Lookup(name string) (string, error) {
+	return s.load().domains.Lookup(name)
+}
+
+// Canonical converts url to canonical form by current normalizer
+func (s *runtimeSettings) Canonical(rawURL string) (string, error) {
+	return s.load().normalizer.Canonical(rawURL)
+}
+
+// Reload atomically replaces base url and options, which are safe to change at runtime:
+// WithInterstitial, WithRequestLog, WithStripTrackingParams and WithDomains. Options not passed are reset
+// to defaults, others are ignored
+func (h *Shortener) Reload(baseURL string, opts ...Option) {
+	s := &Shortener{requestLog: true}
+	for _, opt := range opts {
+		opt(s)
+	}
+	h.settings.store(settings{
+		baseURL:      baseURL,
+		interstitial: s.interstitial,
+		requestLog:   s.requestLog,
+		normalizer:   s.normalizer,
+		domains:      domains.NewRegistry(baseURL, s.domains),
+	})
+}
@@ -2,15 +2,20 @@ package shortener
 
 import (
 	"context"
+	"log"
+	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	httpSwagger "github.com/swaggo/http-swagger"
 
+	"github.com/putalexey/go-practicum/internal/app/accountlink"
+	"github.com/putalexey/go-practicum/internal/app/metrics"
 	appMiddleware "github.com/putalexey/go-practicum/internal/app/middleware"
+	"github.com/putalexey/go-practicum/internal/app/qrgenerator"
 	"github.com/putalexey/go-practicum/internal/app/shortener/handlers"
 	"github.com/putalexey/go-practicum/internal/app/storage"
-	"github.com/putalexey/go-practicum/internal/app/urlgenerator"
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
 )
 
 type Shortener struct {
@@ -19,6 +24,69 @@ type Shortener struct {
 	counter      int64
 	storage      storage.Storager
 	BatchDeleter *storage.BatchDeleter
+	interstitial bool
+	normalizer   urlnormalizer.Normalizer
+	requestLog   bool
+	metrics      *metrics.Metrics
+	settings     *runtimeSettings
+	deleteBatch  int
+	domains      []string
+	linker       *accountlink.Linker
+}
+
+const (
+	authCookieName = "auth"
+	authCookieKey  = "NYiB6/ekacuT53BtdFB2ael09T8vyrnUGbi3NTeedL3tMQy4NpixN9mUzXNod9PH9EVEshAcnSFjgi+QiykVHT0j"
+)
+
+// issueAuthCookie creates cookie, which is accepted by the AuthCookie middleware of the router
+func issueAuthCookie(uid string) (*http.Cookie, error) {
+	return appMiddleware.NewAuthCookie(authCookieName, authCookieKey, uid)
+}
+
+// Option configures optional features of the Shortener
+type Option func(s *Shortener)
+
+// WithInterstitial enables "you are leaving" page before every redirect
+func WithInterstitial(enabled bool) Option {
+	return func(s *Shortener) {
+		s.interstitial = enabled
+	}
+}
+
+// WithStripTrackingParams ignores utm_* and click id params, when detecting already shortened urls
+func WithStripTrackingParams(enabled bool) Option {
+	return func(s *Shortener) {
+		s.normalizer.StripTrackingParams = enabled
+	}
+}
+
+// WithDomains serves short urls on the domains besides the domain of the base url
+func WithDomains(names []string) Option {
+	return func(s *Shortener) {
+		s.domains = names
+	}
+}
+
+// WithRequestLog enables logging of every request, enabled by default
+func WithRequestLog(enabled bool) Option {
+	return func(s *Shortener) {
+		s.requestLog = enabled
+	}
+}
+
+// WithDeleteBatchSize sets number of queued urls, which are deleted at once, 5 by default
+func WithDeleteBatchSize(size int) Option {
+	return func(s *Shortener) {
+		s.deleteBatch = size
+	}
+}
+
+// WithMetrics counts requests of the router in m
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Shortener) {
+		s.metrics = m
+	}
 }
 
 // NewRouter creates shortener router.
@@ -26,38 +94,86 @@ type Shortener struct {
 // List of routes:
 // * {POST} / - shortens url
 // * {GET} /ping - server status check
-// * {GET} /{id} - get full url
+// * {GET} /{id} - get full url, the short is looked up in the domain of the Host header
+// * {GET} /{id}+ - get preview page of the short url
+// * {GET} /{id}/qr - get QR code of the short url
 // * {POST} /api/shorten - shortens url
 // * {POST} /api/shorten/batch - shortens batch of urls
+// * {POST} /api/shorten/bulk - imports urls in NDJSON or CSV, streaming results back
+// * {GET} /api/user - get id of the user, which is shared to be invited to workspaces
+// * {POST} /api/user/claim-codes - issue short-lived code to move urls of another browser to the user
+// * {POST} /api/user/claim - redeem claim code, urls of the user are moved to the user of the code
 // * {GET} /api/user/urls - get all shorten urls of the user
+// * {GET} /api/user/urls/export - export all urls of the user in json, ndjson or csv
+// * {GET} /api/user/campaigns - get shorten urls of the user with UTM tags grouped by campaign
 // * {DELETE} /api/user/urls - delete some of the user's shortened urls
-func NewRouter(ctx context.Context, baseURL string, store storage.Storager) *Shortener {
+// * {PATCH} /api/user/urls/{id} - change settings of the user's shortened url, editors of its workspace can change it too
+// * {POST} /api/workspaces - create workspace, the user becomes its admin
+// * {GET} /api/workspaces - get workspaces of the user with the user's roles
+// * {GET} /api/workspaces/{workspace}/members - get members of the workspace
+// * {PUT} /api/workspaces/{workspace}/members/{user} - invite user to the workspace or change role of the member
+// * {DELETE} /api/workspaces/{workspace}/members/{user} - remove member from the workspace
+// * {GET} /api/workspaces/{workspace}/urls - get urls of the workspace
+// * {DELETE} /api/workspaces/{workspace}/urls - delete urls of the workspace
+func NewRouter(ctx context.Context, baseURL string, store storage.Storager, opts ...Option) *Shortener {
 	if store == nil {
 		store = &storage.MemoryStorage{}
 	}
 	h := &Shortener{
-		Mux:          chi.NewMux(),
-		storage:      store,
-		BatchDeleter: storage.NewBatchDeleterWithContext(ctx, store, 5),
+		Mux:         chi.NewMux(),
+		storage:     store,
+		requestLog:  true,
+		deleteBatch: 5,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
-	urlGenerator := &urlgenerator.SequenceGenerator{BaseURL: baseURL}
+	h.BatchDeleter = storage.NewBatchDeleterWithContext(ctx, store, h.deleteBatch)
+	h.linker = accountlink.NewLinker(store, accountlink.DefaultTTL, log.Default())
+	h.settings = &runtimeSettings{}
+	h.Reload(baseURL,
+		WithInterstitial(h.interstitial),
+		WithRequestLog(h.requestLog),
+		WithStripTrackingParams(h.normalizer.StripTrackingParams),
+		WithDomains(h.domains),
+	)
+	urlGenerator := h.settings
 
-	h.Use(middleware.Logger)
+	h.Use(h.requestLogger)
 	h.Use(middleware.Recoverer)
+	if h.metrics != nil {
+		h.Use(h.metrics.Middleware)
+	}
 	h.Use(appMiddleware.GZipDecoder)
 	h.Use(appMiddleware.GZipEncoder)
-	h.Use(appMiddleware.AuthCookie(
-		"auth",
-		"NYiB6/ekacuT53BtdFB2ael09T8vyrnUGbi3NTeedL3tMQy4NpixN9mUzXNod9PH9EVEshAcnSFjgi+QiykVHT0j",
-	))
+	h.Use(appMiddleware.ClientCertUID)
+	h.Use(appMiddleware.AuthCookie(authCookieName, authCookieKey))
 
-	h.Post("/", handlers.CreateFullURLHandler(urlGenerator, store))
+	h.Post("/", handlers.CreateFullURLHandler(urlGenerator, store, h.settings, h.settings))
 	h.Get("/ping", handlers.PingHandler(store))
-	h.Get("/{id}", handlers.GetFullURLHandler(store))
-	h.Post("/api/shorten", handlers.JSONCreateShort(urlGenerator, store))
-	h.Post("/api/shorten/batch", handlers.JSONCreateShortBatch(urlGenerator, store))
+	h.Get("/{id}", h.redirectHandler(
+		handlers.GetFullURLHandler(urlGenerator, store, h.settings, false),
+		handlers.GetFullURLHandler(urlGenerator, store, h.settings, true),
+	))
+	h.Get("/{id}/qr", handlers.GetQRCodeHandler(urlGenerator, store, h.settings, qrgenerator.NewGenerator(1000)))
+	h.Post("/api/shorten", handlers.JSONCreateShort(urlGenerator, store, h.settings, h.settings))
+	h.Post("/api/shorten/batch", handlers.JSONCreateShortBatch(urlGenerator, store, h.settings, h.settings))
+	h.Post("/api/shorten/bulk", handlers.JSONCreateShortBulk(urlGenerator, store, h.settings, h.settings))
+	h.Get("/api/user", handlers.JSONGetCurrentUser())
+	h.Post("/api/user/claim-codes", handlers.JSONIssueClaimCode(h.linker))
+	h.Post("/api/user/claim", handlers.JSONClaimAccount(h.linker, issueAuthCookie))
 	h.Get("/api/user/urls", handlers.JSONGetShortsForCurrentUser(urlGenerator, store))
-	h.Delete("/api/user/urls", handlers.JSONDeleteUserShorts(store, h.BatchDeleter))
+	h.Get("/api/user/urls/export", handlers.JSONExportUserShorts(urlGenerator, store))
+	h.Get("/api/user/campaigns", handlers.JSONGetCampaignsForCurrentUser(urlGenerator, store))
+	h.Delete("/api/user/urls", handlers.JSONDeleteUserShorts(h.settings, h.BatchDeleter))
+	h.Patch("/api/user/urls/{id}", handlers.JSONUpdateUserShort(urlGenerator, store, h.settings))
+	h.Post("/api/workspaces", handlers.JSONCreateWorkspace(store))
+	h.Get("/api/workspaces", handlers.JSONGetWorkspaces(store))
+	h.Get("/api/workspaces/{workspace}/members", handlers.JSONGetWorkspaceMembers(store))
+	h.Put("/api/workspaces/{workspace}/members/{user}", handlers.JSONSetWorkspaceMember(store))
+	h.Delete("/api/workspaces/{workspace}/members/{user}", handlers.JSONRemoveWorkspaceMember(store))
+	h.Get("/api/workspaces/{workspace}/urls", handlers.JSONGetWorkspaceShorts(urlGenerator, store))
+	h.Delete("/api/workspaces/{workspace}/urls", handlers.JSONDeleteWorkspaceShorts(store, h.settings))
 
 	h.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL(baseURL+"/swagger/doc.json"),
@@ -66,3 +182,26 @@ func NewRouter(ctx context.Context, baseURL string, store storage.Storager) *Sho
 
 	return h
 }
+
+// requestLogger logs requests, while request log is enabled by current settings
+func (h *Shortener) requestLogger(next http.Handler) http.Handler {
+	logged := middleware.Logger(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.settings.load().requestLog {
+			logged.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectHandler chooses handler by current interstitial setting
+func (h *Shortener) redirectHandler(direct, interstitial http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.settings.load().interstitial {
+			interstitial(w, r)
+			return
+		}
+		direct(w, r)
+	}
+}
@@ -3,19 +3,25 @@ package shortener
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/putalexey/go-practicum/internal/app/shortener/requests"
+	"github.com/putalexey/go-practicum/internal/app/shortener/responses"
 	"github.com/putalexey/go-practicum/internal/app/storage"
 )
 
@@ -257,6 +263,851 @@ func TestShortener_JSONCreates(t *testing.T) {
 	})
 }
 
+func TestShortener_MaxClicks(t *testing.T) {
+	s := NewRouter(context.Background(), "http://localhost:8080", nil)
+
+	body, err := json.Marshal(requests.CreateShortRequest{URL: "http://test.example.com", ShortSettings: requests.ShortSettings{MaxClicks: 1}})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewReader(body)))
+	result := w.Result()
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	response := struct {
+		Result string `json:"result"`
+	}{}
+	err = json.NewDecoder(result.Body).Decode(&response)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	target := strings.TrimPrefix(response.Result, "http://localhost:8080")
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	result = w.Result()
+	assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+	assert.Equal(t, "http://test.example.com", result.Header.Get("Location"))
+	require.NoError(t, result.Body.Close())
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	result = w.Result()
+	assert.Equal(t, http.StatusGone, result.StatusCode)
+	require.NoError(t, result.Body.Close())
+
+	t.Run("negative max_clicks fails", func(t *testing.T) {
+		body, err := json.Marshal(requests.CreateShortRequest{URL: "http://test.example.com/2", ShortSettings: requests.ShortSettings{MaxClicks: -1}})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewReader(body)))
+		result := w.Result()
+		assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+		require.NoError(t, result.Body.Close())
+	})
+}
+
+func TestShortener_QRCode(t *testing.T) {
+	shorts := storage.RecordMap{
+		"some":    {Short: "some", Full: "http://test.example.com", UserID: "test"},
+		"deleted": {Short: "deleted", Full: "http://test.example.com/2", UserID: "test", Deleted: true},
+	}
+	tests := []struct {
+		name        string
+		target      string
+		code        int
+		contentType string
+	}{
+		{name: "renders png by default", target: "/some/qr", code: http.StatusOK, contentType: "image/png"},
+		{name: "renders svg", target: "/some/qr?format=svg&size=128&margin=0&level=H", code: http.StatusOK, contentType: "image/svg+xml"},
+		{name: "fails on wrong size", target: "/some/qr?size=abc", code: http.StatusBadRequest},
+		{name: "fails on wrong level", target: "/some/qr?level=Z", code: http.StatusBadRequest},
+		{name: "returns 404 status", target: "/other/qr", code: http.StatusNotFound},
+		{name: "returns 410 status for deleted", target: "/deleted/qr", code: http.StatusGone},
+	}
+	s := NewRouter(context.Background(), "http://localhost:8080", storage.NewMemoryStorage(shorts))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.code, result.StatusCode)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, result.Header.Get("Content-Type"))
+			}
+		})
+	}
+
+	t.Run("returns qr link on create", func(t *testing.T) {
+		body, err := json.Marshal(requests.CreateShortRequest{URL: "http://test.example.com/qr", QR: true})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewReader(body)))
+		result := w.Result()
+		defer result.Body.Close()
+
+		response := responses.CreateShortResponse{}
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&response))
+		assert.Equal(t, response.Result+"/qr", response.QR)
+	})
+}
+
+func TestShortener_PreviewAndInterstitial(t *testing.T) {
+	shorts := func() storage.RecordMap {
+		return storage.RecordMap{
+			"some":     {Short: "some", Full: "http://test.example.com", UserID: "test", Clicks: 42},
+			"warn":     {Short: "warn", Full: "http://test.example.com/warn", UserID: "test", Interstitial: true},
+			"deleted":  {Short: "deleted", Full: "http://test.example.com/2", UserID: "test", Deleted: true},
+			"disabled": {Short: "disabled", Full: "http://test.example.com/3", UserID: "test", Disabled: true},
+			"once":     {Short: "once", Full: "http://test.example.com/once", UserID: "test", MaxClicks: 1},
+			"used":     {Short: "used", Full: "http://test.example.com/used", UserID: "test", MaxClicks: 1, Clicks: 1},
+		}
+	}
+
+	t.Run("shows preview instead of redirect", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", storage.NewMemoryStorage(shorts()))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/some+", nil))
+		result := w.Result()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.NoError(t, result.Body.Close())
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Contains(t, result.Header.Get("Content-Type"), "text/html")
+		assert.Contains(t, string(body), "http://test.example.com")
+		assert.NotContains(t, string(body), "42", "clicks are visible only to the owner")
+
+		record, err := s.storage.Load(context.Background(), "some")
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), record.Clicks, "preview must not count clicks")
+	})
+
+	t.Run("hides destination of limited link from preview", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", storage.NewMemoryStorage(shorts()))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/once+", nil))
+		result := w.Result()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.NoError(t, result.Body.Close())
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.NotContains(t, string(body), "http://test.example.com/once")
+	})
+
+	t.Run("preview of unknown, deleted, disabled or exhausted short fails", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", storage.NewMemoryStorage(shorts()))
+		targets := map[string]int{
+			"/other+":    http.StatusNotFound,
+			"/used+":     http.StatusGone,
+			"/deleted+":  http.StatusGone,
+			"/disabled+": http.StatusGone,
+			"/disabled":  http.StatusGone,
+		}
+		for target, code := range targets {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+			assert.Equal(t, code, result.StatusCode, target)
+		}
+	})
+
+	t.Run("shows interstitial page for the link", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", storage.NewMemoryStorage(shorts()))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/warn", nil))
+		result := w.Result()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.NoError(t, result.Body.Close())
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Contains(t, string(body), "http://test.example.com/warn")
+
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/some", nil))
+		result = w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+	})
+
+	t.Run("shows interstitial page for all links when enabled globally", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", storage.NewMemoryStorage(shorts()), WithInterstitial(true))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/some", nil))
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+	})
+}
+
+func TestShortener_RedirectSettings(t *testing.T) {
+	shorts := storage.RecordMap{
+		"default":  {Short: "default", Full: "http://test.example.com/?a=1", UserID: "test"},
+		"moved":    {Short: "moved", Full: "http://test.example.com/", UserID: "test", RedirectStatus: http.StatusMovedPermanently},
+		"merge":    {Short: "merge", Full: "http://test.example.com/?a=1", UserID: "test", Passthrough: storage.PassthroughMerge},
+		"override": {Short: "override", Full: "http://test.example.com/?a=1", UserID: "test", Passthrough: storage.PassthroughOverride},
+	}
+	tests := []struct {
+		name     string
+		target   string
+		code     int
+		location string
+	}{
+		{name: "temporary redirect by default", target: "/default?a=2", code: http.StatusTemporaryRedirect, location: "http://test.example.com/?a=1"},
+		{name: "uses status of the record", target: "/moved", code: http.StatusMovedPermanently, location: "http://test.example.com/"},
+		{name: "merge keeps params of full url", target: "/merge?a=2&utm_source=x", code: http.StatusTemporaryRedirect, location: "http://test.example.com/?a=1&utm_source=x"},
+		{name: "override replaces params of full url", target: "/override?a=2&utm_source=x", code: http.StatusTemporaryRedirect, location: "http://test.example.com/?a=2&utm_source=x"},
+	}
+	s := NewRouter(context.Background(), "http://localhost:8080", storage.NewMemoryStorage(shorts))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+
+			assert.Equal(t, tt.code, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestShortener_UpdateUserShort(t *testing.T) {
+	s := NewRouter(context.Background(), "http://localhost:8080", nil)
+
+	body, err := json.Marshal(requests.CreateShortRequest{
+		URL:           "http://test.example.com",
+		ShortSettings: requests.ShortSettings{RedirectStatus: http.StatusFound},
+	})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewReader(body)))
+	result := w.Result()
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+	cookies := result.Cookies()
+	response := responses.CreateShortResponse{}
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&response))
+	require.NoError(t, result.Body.Close())
+	target := "/api/user/urls" + strings.TrimPrefix(response.Result, "http://localhost:8080")
+
+	t.Run("owner changes settings", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(`{"redirect_status":308,"passthrough":"merge"}`))
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+
+		info := responses.ShortInfoResponse{}
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&info))
+		assert.Equal(t, http.StatusPermanentRedirect, info.RedirectStatus)
+		assert.Equal(t, "merge", info.Passthrough)
+	})
+
+	t.Run("invalid settings fail", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(`{"redirect_status":200}`))
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+	})
+
+	t.Run("other user can't change settings", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(`{"redirect_status":301}`))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusForbidden, result.StatusCode)
+	})
+}
+
+func TestShortener_UTMCampaigns(t *testing.T) {
+	s := NewRouter(context.Background(), "http://localhost:8080", nil)
+
+	var cookies []*http.Cookie
+	post := func(body string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		if len(cookies) == 0 {
+			cookies = result.Cookies()
+		}
+		return result
+	}
+
+	result := post(`{"url":"http://example.com/a?utm_source=old","utm":{"source":"Mail","campaign":"Spring"}}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+	result = post(`{"url":"http://example.com/b","utm":{"source":"ads","campaign":"spring"}}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+	result = post(`{"url":"http://example.com/c"}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	t.Run("fails without source", func(t *testing.T) {
+		result := post(`{"url":"http://example.com/d","utm":{"campaign":"spring"}}`)
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+	})
+
+	t.Run("groups urls by campaign", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/api/user/campaigns", nil)
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+
+		campaigns := responses.CampaignsResponse{}
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&campaigns))
+		require.Len(t, campaigns, 1)
+		assert.Equal(t, "spring", campaigns[0].Campaign)
+		require.Len(t, campaigns[0].URLs, 2)
+		for _, item := range campaigns[0].URLs {
+			assert.NotContains(t, item.BaseURL, "utm_")
+			assert.Contains(t, item.OriginalURL, "utm_campaign=spring")
+		}
+	})
+}
+
+func TestShortener_CanonicalConflict(t *testing.T) {
+	post := func(s *Shortener, body string) (int, string) {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		data, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		return result.StatusCode, string(data)
+	}
+
+	t.Run("same url written differently conflicts", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", nil)
+		status, short := post(s, "HTTP://Example.COM:80/%7euser")
+		require.Equal(t, http.StatusCreated, status)
+		status, conflictShort := post(s, "http://example.com/~user")
+		assert.Equal(t, http.StatusConflict, status)
+		assert.Equal(t, short, conflictShort)
+
+		request := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(short, "http://localhost:8080"), nil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, "HTTP://Example.COM:80/%7euser", result.Header.Get("Location"), "redirects to submitted url")
+	})
+
+	t.Run("tracking params are stripped only when enabled", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", nil)
+		status, _ := post(s, "http://example.com/page")
+		require.Equal(t, http.StatusCreated, status)
+		status, _ = post(s, "http://example.com/page?utm_source=mail")
+		assert.Equal(t, http.StatusCreated, status)
+
+		s = NewRouter(context.Background(), "http://localhost:8080", nil, WithStripTrackingParams(true))
+		status, _ = post(s, "http://example.com/page")
+		require.Equal(t, http.StatusCreated, status)
+		status, _ = post(s, "http://example.com/page?utm_source=mail&fbclid=123")
+		assert.Equal(t, http.StatusConflict, status)
+	})
+
+	t.Run("links of different campaigns don't conflict, when tracking params are stripped", func(t *testing.T) {
+		s := NewRouter(context.Background(), "http://localhost:8080", nil, WithStripTrackingParams(true))
+		shorten := func(body string) int {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+			result := w.Result()
+			require.NoError(t, result.Body.Close())
+			return result.StatusCode
+		}
+		assert.Equal(t, http.StatusCreated, shorten(`{"url":"http://example.com/page","utm":{"source":"mail","campaign":"a"}}`))
+		assert.Equal(t, http.StatusCreated, shorten(`{"url":"http://example.com/page","utm":{"source":"mail","campaign":"b"}}`))
+		assert.Equal(t, http.StatusCreated, shorten(`{"url":"http://example.com/page"}`))
+		assert.Equal(t, http.StatusConflict, shorten(`{"url":"HTTP://example.com/page?fbclid=1","utm":{"source":"Mail","campaign":"A"}}`))
+	})
+}
+
+func TestShortener_Reload(t *testing.T) {
+	post := func(s *Shortener, body string) (int, string) {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		data, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		return result.StatusCode, string(data)
+	}
+	get := func(s *Shortener, target string) int {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		return result.StatusCode
+	}
+
+	s := NewRouter(context.Background(), "http://localhost:8080", nil)
+	status, short := post(s, "http://example.com/page")
+	require.Equal(t, http.StatusCreated, status)
+	assert.True(t, strings.HasPrefix(short, "http://localhost:8080/"))
+	id := strings.TrimPrefix(short, "http://localhost:8080")
+	assert.Equal(t, http.StatusTemporaryRedirect, get(s, id))
+
+	s.Reload("https://sho.rt", WithInterstitial(true), WithStripTrackingParams(true))
+
+	status, conflictShort := post(s, "http://example.com/page?utm_source=mail")
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "https://sho.rt"+id, conflictShort)
+	assert.Equal(t, http.StatusOK, get(s, id), "shows interstitial page")
+
+	s.Reload("https://sho.rt")
+	assert.Equal(t, http.StatusTemporaryRedirect, get(s, id))
+}
+
+func TestShortener_ReloadRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := middleware.DefaultLogger
+	middleware.DefaultLogger = middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.New(&buf, "", 0), NoColor: true})
+	defer func() { middleware.DefaultLogger = defaultLogger }()
+	ping := func(s *Shortener) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		require.NoError(t, w.Result().Body.Close())
+	}
+
+	s := NewRouter(context.Background(), "http://localhost:8080", nil, WithRequestLog(false))
+	ping(s)
+	assert.Empty(t, buf.String())
+
+	s.Reload("http://localhost:8080", WithRequestLog(true))
+	ping(s)
+	assert.Contains(t, buf.String(), "GET http://example.com/ping")
+
+	buf.Reset()
+	s.Reload("http://localhost:8080", WithRequestLog(false))
+	ping(s)
+	assert.Empty(t, buf.String())
+}
+
+func TestShortener_ClientCertUser(t *testing.T) {
+	store := storage.NewMemoryStorage(nil)
+	s := NewRouter(context.Background(), "http://localhost:8080", store)
+	withCert := func(r *http.Request) *http.Request {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing-service"}}
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, withCert(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://example.com"))))
+	result := w.Result()
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusCreated, result.StatusCode)
+	assert.Empty(t, result.Cookies(), "client with certificate gets no cookie")
+
+	it, err := store.IterateForUser(context.Background(), "cert:billing-service")
+	require.NoError(t, err)
+	defer it.Close()
+	require.True(t, it.Next())
+	assert.Equal(t, "http://example.com", it.Record().Full)
+}
+
+func TestShortener_Domains(t *testing.T) {
+	store := storage.NewMemoryStorage(storage.RecordMap{
+		"promo":                {Short: "promo", Full: "http://example.com/1", UserID: "user"},
+		"go.example.com/promo": {Short: "promo", Full: "http://example.com/2", UserID: "user", Domain: "go.example.com"},
+	})
+	s := NewRouter(context.Background(), "http://localhost:8080", store, WithDomains([]string{"go.example.com"}))
+	do := func(method, host, target, body string) (int, string, string) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Host = host
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		data, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		return result.StatusCode, result.Header.Get("Location"), string(data)
+	}
+
+	for host, want := range map[string]string{
+		"localhost:8080":      "http://example.com/1",
+		"go.example.com":      "http://example.com/2",
+		"go.example.com:8080": "http://example.com/2",
+		"unknown.example.com": "http://example.com/1",
+	} {
+		status, location, _ := do(http.MethodGet, host, "/promo", "")
+		assert.Equal(t, http.StatusTemporaryRedirect, status, host)
+		assert.Equal(t, want, location, host)
+	}
+
+	status, _, body := do(http.MethodPost, "localhost:8080", "/api/shorten", `{"url":"http://example.com/3","domain":"go.example.com"}`)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Contains(t, body, `"result":"http://go.example.com/`)
+
+	status, _, body = do(http.MethodPost, "go.example.com", "/", "http://example.com/4")
+	require.Equal(t, http.StatusCreated, status)
+	assert.True(t, strings.HasPrefix(body, "http://go.example.com/"), "domain of the host is used by default")
+	status, location, _ := do(http.MethodGet, "go.example.com", strings.TrimPrefix(body, "http://go.example.com"), "")
+	assert.Equal(t, http.StatusTemporaryRedirect, status)
+	assert.Equal(t, "http://example.com/4", location)
+
+	status, _, body = do(http.MethodPost, "localhost:8080", "/?domain=localhost:8080", "http://example.com/4")
+	assert.Equal(t, http.StatusCreated, status, "the same url is shortened once per domain")
+	assert.True(t, strings.HasPrefix(body, "http://localhost:8080/"))
+
+	status, _, body = do(http.MethodPost, "localhost:8080", "/api/shorten", `{"url":"http://example.com/5","domain":"evil.example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "unknown domain")
+}
+
+func TestShortener_DedupScope(t *testing.T) {
+	store := storage.NewMemoryStorage(nil)
+	store.SetDedupScope(storage.DedupUser)
+	s := NewRouter(context.Background(), "http://localhost:8080", store)
+
+	post := func(cookies []*http.Cookie) (*http.Response, responses.CreateShortResponse) {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"http://example.com/"}`))
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		response := responses.CreateShortResponse{}
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&response))
+		return result, response
+	}
+
+	resultA, responseA := post(nil)
+	require.Equal(t, http.StatusCreated, resultA.StatusCode)
+	resultB, responseB := post(nil)
+	require.Equal(t, http.StatusCreated, resultB.StatusCode, "other user gets own short")
+	assert.NotEqual(t, responseA.Result, responseB.Result)
+
+	result, response := post(resultA.Cookies())
+	assert.Equal(t, http.StatusConflict, result.StatusCode)
+	assert.Equal(t, responseA.Result, response.Result)
+	assert.Equal(t, "user", response.DedupScope)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	for _, c := range resultB.Cookies() {
+		request.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	list := w.Result()
+	defer list.Body.Close()
+	require.Equal(t, http.StatusOK, list.StatusCode)
+	items := responses.ListShortsResponse{}
+	require.NoError(t, json.NewDecoder(list.Body).Decode(&items))
+	require.Len(t, items, 1)
+	assert.Equal(t, responseB.Result, items[0].ShortURL)
+}
+
+func TestShortener_CreateShortBatch(t *testing.T) {
+	store := storage.NewMemoryStorage(storage.RecordMap{
+		"asd": {Short: "asd", Full: "https://ya.ru/", UserID: "test"},
+	})
+	s := NewRouter(context.Background(), "http://localhost:8080", store)
+	post := func(body string) (int, responses.CreateShortBatchResponse) {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		response := responses.CreateShortBatchResponse{}
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&response))
+		return result.StatusCode, response
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		check      func(t *testing.T, response responses.CreateShortBatchResponse)
+	}{
+		{
+			name:       "all urls are created",
+			body:       `[{"correlation_id":"1","original_url":"http://example.com/batch1"},{"correlation_id":"2","original_url":"http://example.com/batch2"}]`,
+			wantStatus: http.StatusCreated,
+			check: func(t *testing.T, response responses.CreateShortBatchResponse) {
+				require.Len(t, response, 2)
+				assert.NotEmpty(t, response[0].ShortURL)
+				assert.False(t, response[0].Conflict)
+			},
+		},
+		{
+			name:       "all urls exist",
+			body:       `[{"correlation_id":"1","original_url":"https://ya.ru"}]`,
+			wantStatus: http.StatusConflict,
+			check: func(t *testing.T, response responses.CreateShortBatchResponse) {
+				require.Len(t, response, 1)
+				assert.True(t, response[0].Conflict)
+				assert.Equal(t, "http://localhost:8080/asd", response[0].ShortURL)
+			},
+		},
+		{
+			name:       "all urls are invalid",
+			body:       `[{"correlation_id":"1","original_url":"http//example"}]`,
+			wantStatus: http.StatusBadRequest,
+			check: func(t *testing.T, response responses.CreateShortBatchResponse) {
+				require.Len(t, response, 1)
+				assert.Equal(t, "1", response[0].CorrelationID)
+				assert.NotEmpty(t, response[0].Error)
+				assert.Empty(t, response[0].ShortURL)
+			},
+		},
+		{
+			name: "partial success",
+			body: `[{"correlation_id":"1","original_url":"http://example.com/batch3"},` +
+				`{"correlation_id":"2","original_url":"https://ya.ru"},` +
+				`{"correlation_id":"3","original_url":"http//example"},` +
+				`{"correlation_id":"4","original_url":"HTTP://example.com:80/batch3"}]`,
+			wantStatus: http.StatusMultiStatus,
+			check: func(t *testing.T, response responses.CreateShortBatchResponse) {
+				require.Len(t, response, 4)
+				assert.False(t, response[0].Conflict)
+				assert.True(t, response[1].Conflict)
+				assert.NotEmpty(t, response[2].Error)
+				assert.True(t, response[3].Conflict, "duplicate inside batch returns short of the first item")
+				assert.Equal(t, response[0].ShortURL, response[3].ShortURL)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := post(tt.body)
+			assert.Equal(t, tt.wantStatus, status)
+			tt.check(t, response)
+		})
+	}
+}
+
+func TestShortener_CreateShortBulk(t *testing.T) {
+	newRouter := func() *Shortener {
+		store := storage.NewMemoryStorage(storage.RecordMap{
+			"asd": {Short: "asd", Full: "https://ya.ru/", UserID: "test"},
+		})
+		return NewRouter(context.Background(), "http://localhost:8080", store)
+	}
+	post := func(s *Shortener, ctx context.Context, contentType, body string) (int, []responses.BulkResultItem) {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten/bulk", strings.NewReader(body)).WithContext(ctx)
+		request.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		var items []responses.BulkResultItem
+		decoder := json.NewDecoder(result.Body)
+		for decoder.More() {
+			item := responses.BulkResultItem{}
+			require.NoError(t, decoder.Decode(&item))
+			items = append(items, item)
+		}
+		return result.StatusCode, items
+	}
+
+	t.Run("imports NDJSON", func(t *testing.T) {
+		body := `{"correlation_id":"1","original_url":"http://example.com/1"}` + "\n" +
+			"\n" +
+			`{"correlation_id":"2","original_url":"https://ya.ru"}` + "\n" +
+			`{"correlation_id":"3","original_url":"http://example.com/3","alias":"my-link"}` + "\n" +
+			`{"correlation_id":"4",` + "\n" +
+			`{"correlation_id":"5","original_url":"http://example.com/5","alias":"asd"}` + "\n" +
+			`{"correlation_id":"6","original_url":"http://example.com/6","alias":"api"}`
+		status, items := post(newRouter(), context.Background(), "application/x-ndjson", body)
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, items, 6)
+
+		assert.Equal(t, 1, items[0].Line)
+		assert.NotEmpty(t, items[0].ShortURL)
+		assert.Equal(t, 3, items[1].Line)
+		assert.True(t, items[1].Conflict)
+		assert.Equal(t, "http://localhost:8080/asd", items[1].ShortURL)
+		assert.Equal(t, "http://localhost:8080/my-link", items[2].ShortURL)
+		assert.Equal(t, 5, items[3].Line)
+		assert.NotEmpty(t, items[3].Error)
+		assert.Equal(t, storage.ErrShortTaken.Error(), items[4].Error)
+		assert.Equal(t, "5", items[4].CorrelationID)
+		assert.NotEmpty(t, items[5].Error, "reserved alias")
+	})
+
+	t.Run("rejects alias repeated in the chunk", func(t *testing.T) {
+		body := `{"correlation_id":"1","original_url":"http://example.com/1","alias":"twice"}` + "\n" +
+			`{"correlation_id":"2","original_url":"http://example.com/2","alias":"twice"}`
+		status, items := post(newRouter(), context.Background(), "application/x-ndjson", body)
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, items, 2)
+		assert.Empty(t, items[0].Error)
+		assert.Equal(t, "http://localhost:8080/twice", items[0].ShortURL)
+		assert.Equal(t, "alias twice is already used on line 1", items[1].Error)
+		assert.Empty(t, items[1].ShortURL)
+	})
+
+	t.Run("streams results of several chunks on real server", func(t *testing.T) {
+		server := httptest.NewServer(newRouter())
+		defer server.Close()
+
+		const lines = 1200
+		body, writer := io.Pipe()
+		go func() {
+			for i := 1; i <= lines; i++ {
+				_, _ = fmt.Fprintf(writer, `{"correlation_id":"%d","original_url":"http://example.com/%d"}`+"\n", i, i)
+			}
+			_ = writer.Close()
+		}()
+		result, err := http.Post(server.URL+"/api/shorten/bulk", "application/x-ndjson", body)
+		require.NoError(t, err)
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode)
+
+		decoder := json.NewDecoder(result.Body)
+		count := 0
+		for decoder.More() {
+			item := responses.BulkResultItem{}
+			require.NoError(t, decoder.Decode(&item))
+			require.Empty(t, item.Error, "line %d", item.Line)
+			count++
+		}
+		assert.Equal(t, lines, count, "whole import is read before results are flushed")
+	})
+
+	t.Run("imports CSV with header", func(t *testing.T) {
+		body := "correlation_id,original_url,alias\n" +
+			"1,http://example.com/1,\n" +
+			"2,http//example\n" +
+			"3,http://example.com/3,csv-link\n" +
+			"4\n"
+		status, items := post(newRouter(), context.Background(), "text/csv", body)
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, items, 4)
+		assert.Equal(t, 2, items[0].Line)
+		assert.NotEmpty(t, items[0].ShortURL)
+		assert.NotEmpty(t, items[1].Error)
+		assert.Equal(t, "http://localhost:8080/csv-link", items[2].ShortURL)
+		assert.Equal(t, 5, items[3].Line)
+		assert.NotEmpty(t, items[3].Error)
+	})
+
+	t.Run("stores lines in chunks", func(t *testing.T) {
+		var body strings.Builder
+		for i := 0; i < 1200; i++ {
+			fmt.Fprintf(&body, "%d,http://example.com/%d\n", i, i%1000)
+		}
+		status, items := post(newRouter(), context.Background(), "text/csv", body.String())
+		require.Equal(t, http.StatusOK, status)
+		require.Len(t, items, 1200)
+		for i := 1000; i < 1200; i++ {
+			assert.True(t, items[i].Conflict)
+			assert.Equal(t, items[i-1000].ShortURL, items[i].ShortURL)
+		}
+	})
+
+	t.Run("stops on canceled request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		status, items := post(newRouter(), ctx, "text/csv", "1,http://example.com/1\n")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, items)
+	})
+
+	t.Run("rejects unsupported content type", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten/bulk", strings.NewReader("<xml/>"))
+		request.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		newRouter().ServeHTTP(w, request)
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusUnsupportedMediaType, result.StatusCode)
+	})
+}
+
+func TestShortener_ExportUserShorts(t *testing.T) {
+	s := NewRouter(context.Background(), "http://localhost:8080", nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://example.com/1"))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, request)
+	created := w.Result()
+	require.NoError(t, created.Body.Close())
+	require.Equal(t, http.StatusCreated, created.StatusCode)
+	cookies := created.Cookies()
+	for _, u := range []string{"http://example.com/2", "http://example.com/3"} {
+		request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(u))
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		s.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	export := func(format string) (*http.Response, string) {
+		request := httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format="+format, nil)
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		data, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		return result, string(data)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		result, body := export("json")
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "application/json", result.Header.Get("Content-Type"))
+		var items []responses.ExportItem
+		require.NoError(t, json.Unmarshal([]byte(body), &items))
+		require.Len(t, items, 3)
+		assert.False(t, items[0].CreatedAt.IsZero())
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		result, body := export("ndjson")
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Len(t, strings.Split(strings.TrimSpace(body), "\n"), 3)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		result, body := export("csv")
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "text/csv", result.Header.Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		require.Len(t, lines, 4)
+		assert.Equal(t, "short_url,original_url,created_at,deleted,clicks", lines[0])
+		assert.Contains(t, body, "http://example.com/2")
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		result, _ := export("xml")
+		assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+	})
+}
+
 func TestShortener_NewRouter(t *testing.T) {
 	t.Run("default router storage is MemoryStorage ", func(t *testing.T) {
 		s := NewRouter(context.Background(), "localhost:8080", nil)
@@ -307,3 +1158,127 @@ func randomURL() string {
 	}
 	return "http://test.example.com/" + string(url)
 }
+
+func TestShortener_Workspaces(t *testing.T) {
+	store := storage.NewMemoryStorage(nil)
+	s := NewRouter(context.Background(), "http://localhost:8080", store)
+	do := func(user, method, target, body string) (int, string) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: user}}
+		request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		data, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		return result.StatusCode, string(data)
+	}
+
+	status, body := do("owner", http.MethodGet, "/api/user", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"user_id":"cert:owner"}`, body)
+
+	status, body = do("owner", http.MethodPost, "/api/workspaces", `{"name":"team"}`)
+	require.Equal(t, http.StatusCreated, status)
+	workspace := responses.WorkspaceItem{}
+	require.NoError(t, json.Unmarshal([]byte(body), &workspace))
+	assert.Equal(t, "admin", workspace.Role)
+	base := "/api/workspaces/" + workspace.ID
+
+	status, _ = do("owner", http.MethodPut, base+"/members/cert:viewer", `{"role":"viewer"}`)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = do("owner", http.MethodPut, base+"/members/cert:editor", `{"role":"editor"}`)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = do("editor", http.MethodPut, base+"/members/cert:stranger", `{"role":"viewer"}`)
+	assert.Equal(t, http.StatusForbidden, status, "only admins manage members")
+	status, _ = do("owner", http.MethodPut, base+"/members/cert:owner", `{"role":"editor"}`)
+	assert.Equal(t, http.StatusConflict, status, "the last admin can't be demoted")
+
+	status, body = do("editor", http.MethodPost, "/api/shorten", `{"url":"http://example.com/shared","workspace":"`+workspace.ID+`"}`)
+	require.Equal(t, http.StatusCreated, status)
+	response := responses.CreateShortResponse{}
+	require.NoError(t, json.Unmarshal([]byte(body), &response))
+	short := strings.TrimPrefix(response.Result, "http://localhost:8080/")
+	status, _ = do("viewer", http.MethodPost, "/api/shorten", `{"url":"http://example.com/other","workspace":"`+workspace.ID+`"}`)
+	assert.Equal(t, http.StatusForbidden, status, "viewers can't create urls")
+	status, _ = do("viewer", http.MethodPost, "/api/shorten", `{"url":"http://example.com/other","workspace":"missing"}`)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, body = do("viewer", http.MethodGet, base+"/urls", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"original_url":"http://example.com/shared"`)
+	status, _ = do("stranger", http.MethodGet, base+"/urls", "")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, _ = do("viewer", http.MethodPatch, "/api/user/urls/"+short, `{"max_clicks":5}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("owner", http.MethodPatch, "/api/user/urls/"+short, `{"max_clicks":5}`)
+	assert.Equal(t, http.StatusOK, status, "admins of the workspace edit urls of other members")
+
+	status, _ = do("viewer", http.MethodDelete, base+"/urls", `["`+short+`"]`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("owner", http.MethodDelete, base+"/urls", `["`+short+`"]`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do("viewer", http.MethodGet, base+"/urls", "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, _ = do("owner", http.MethodDelete, base+"/members/cert:viewer", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do("viewer", http.MethodGet, "/api/workspaces", "")
+	assert.Equal(t, http.StatusNoContent, status)
+}
+
+func TestShortener_ClaimAccount(t *testing.T) {
+	store := storage.NewMemoryStorage(nil)
+	s := NewRouter(context.Background(), "http://localhost:8080", store)
+	do := func(cookies []*http.Cookie, method, target, body string) (*http.Response, string) {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, request)
+		result := w.Result()
+		defer result.Body.Close()
+		data, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		return result, string(data)
+	}
+
+	original, _ := do(nil, http.MethodPost, "/", "http://example.com/original")
+	require.Equal(t, http.StatusCreated, original.StatusCode)
+	browser, _ := do(nil, http.MethodPost, "/", "http://example.com/browser")
+	require.Equal(t, http.StatusCreated, browser.StatusCode)
+
+	result, body := do(original.Cookies(), http.MethodPost, "/api/user/claim-codes", "")
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+	codeResponse := responses.ClaimCodeResponse{}
+	require.NoError(t, json.Unmarshal([]byte(body), &codeResponse))
+
+	result, _ = do(browser.Cookies(), http.MethodPost, "/api/user/claim", `{"code":"WRONG"}`)
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+
+	result, body = do(browser.Cookies(), http.MethodPost, "/api/user/claim", `{"code":"`+codeResponse.Code+`"}`)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	claimResponse := responses.ClaimResponse{}
+	require.NoError(t, json.Unmarshal([]byte(body), &claimResponse))
+	assert.Equal(t, 1, claimResponse.Records)
+	require.NotEmpty(t, result.Cookies(), "browser is switched to the original user")
+
+	for _, cookies := range [][]*http.Cookie{original.Cookies(), result.Cookies()} {
+		listResult, body := do(cookies, http.MethodGet, "/api/user/urls", "")
+		require.Equal(t, http.StatusOK, listResult.StatusCode)
+		assert.Contains(t, body, "http://example.com/original")
+		assert.Contains(t, body, "http://example.com/browser")
+	}
+	listResult, _ := do(browser.Cookies(), http.MethodGet, "/api/user/urls", "")
+	assert.Equal(t, http.StatusNoContent, listResult.StatusCode, "old cookie has no urls anymore")
+
+	statuses := make([]int, 0)
+	for i := 0; i < 5; i++ {
+		result, _ = do(nil, http.MethodPost, "/api/user/claim", `{"code":"WRONG"}`)
+		statuses = append(statuses, result.StatusCode)
+	}
+	assert.Equal(t, []int{400, 400, 400, 400, 429}, statuses, "guessing client is locked out after failed attempts")
+}
@@ -59,6 +59,11 @@ func (b *BatchDeleter) QueueItems(shorts []string, userID string) {
 	}()
 }
 
+// Flush triggers deletion of the queued items without waiting for the timer
+func (b *BatchDeleter) Flush() {
+	b.cond.Signal()
+}
+
 func (b *BatchDeleter) flushWorker() {
 	for {
 		tasksQueue := b.doWork()
@@ -71,14 +76,20 @@ func (b *BatchDeleter) flushWorker() {
 					log.Println("WARNING: ", err)
 					continue
 				}
+				// records of other users are skipped, the rest are deleted
+				owned := make([]string, 0, len(records))
 				for _, r := range records {
 					if r.UserID != userID {
-						log.Println("WARNING: ", userID, " can't delete item ", r.Short, err)
+						log.Println("WARNING: ", userID, " can't delete item ", r.Key())
 						continue
 					}
+					owned = append(owned, r.Key())
+				}
+				if len(owned) == 0 {
+					continue
 				}
 
-				if err := b.store.DeleteBatch(ctx, t.shorts); err != nil {
+				if err := b.store.DeleteBatch(ctx, owned); err != nil {
 					log.Println("WARNING: ", err)
 					continue
 				}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchDeleter_SkipsRecordsOfOtherUsers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewMemoryStorage(RecordMap{
+		"own":     {Short: "own", Full: "http://example.com/1", UserID: "user"},
+		"foreign": {Short: "foreign", Full: "http://example.com/2", UserID: "other"},
+	})
+	deleter := NewBatchDeleterWithContext(ctx, store, 5)
+	go deleter.Start()
+
+	deleter.QueueItems([]string{"own", "foreign"}, "user")
+	require.Eventually(t, func() bool {
+		deleter.Flush()
+		_, err := store.Load(ctx, "own")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	r, err := store.Load(ctx, "foreign")
+	require.NoError(t, err)
+	assert.Equal(t, "other", r.UserID)
+}
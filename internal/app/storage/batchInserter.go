@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 )
 
@@ -10,6 +11,8 @@ func NewBatchInserter(store Storager, bufferSize int) *BatchInserter {
 		store:      store,
 		bufferSize: bufferSize,
 		buffer:     make([]Record, 0, bufferSize),
+		conflicts:  make(map[string]Record),
+		taken:      make(map[string]bool),
 	}
 
 	return &inserter
@@ -20,6 +23,8 @@ type BatchInserter struct {
 	store      Storager
 	bufferSize int
 	buffer     []Record
+	conflicts  map[string]Record
+	taken      map[string]bool
 }
 
 // AddItem to the insert queue. If buffer is full, records flushes to storage
@@ -41,9 +46,37 @@ func (b *BatchInserter) Flush(ctx context.Context) error {
 	}
 
 	if err := b.store.StoreBatch(ctx, b.buffer); err != nil {
-		return err
+		var conflictErr *BatchConflictError
+		if !errors.As(err, &conflictErr) {
+			return err
+		}
+		for short, old := range conflictErr.Conflicts {
+			b.conflicts[short] = old
+		}
+		for _, short := range conflictErr.Taken {
+			b.taken[short] = true
+		}
 	}
 
 	b.buffer = b.buffer[:0]
 	return nil
 }
+
+// Conflict returns already stored record, if the record with key was not inserted because of conflict.
+// Result is known after the record is flushed
+func (b *BatchInserter) Conflict(key string) (Record, bool) {
+	old, ok := b.conflicts[key]
+	return old, ok
+}
+
+// Taken reports whether the record with key was not inserted, because the short is used by another record.
+// Result is known after the record is flushed
+func (b *BatchInserter) Taken(key string) bool {
+	return b.taken[key]
+}
+
+// Reset forgets results of the flushed records, used to keep memory bounded on long imports
+func (b *BatchInserter) Reset() {
+	b.conflicts = make(map[string]Record)
+	b.taken = make(map[string]bool)
+}
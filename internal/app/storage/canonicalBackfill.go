@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pressly/goose/v3"
+
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
+)
+
+// Go migrations are registered by the storage, so every binary, which migrates the database, runs them
+func init() {
+	goose.AddNamedMigration("20261019140000_backfill_canonical_urls.go", upBackfillCanonical, nil)
+}
+
+// upBackfillCanonical normalizes canonical urls of the records, stored before urls were normalized.
+// Tracking params are kept, because stripping them is enabled by config. Dedup keys are recomputed from the new
+// canonical urls by DBStorage.SyncDedupScope on start: the oldest of the records, which normalize to the same url,
+// keeps its dedup key
+func upBackfillCanonical(tx *sql.Tx) error {
+	updates, err := canonicalUpdates(tx, urlnormalizer.Normalizer{})
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("UPDATE %s SET canonical = $3 WHERE short = $1 AND domain = $2", recordsTableName))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range updates {
+		if _, err = stmt.Exec(r.Short, r.Domain, r.Canonical); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE name = $1", settingsTableName), dedupScopeSetting)
+	return err
+}
+
+// canonicalUpdates returns records, which canonical url changes after normalization, with the new canonical url.
+// Urls, which can't be normalized, keep their canonical url
+func canonicalUpdates(tx *sql.Tx, normalizer urlnormalizer.Canonicalizer) ([]Record, error) {
+	selectSQL := fmt.Sprintf(`SELECT short, domain, original, canonical, base_url,
+		utm_source, utm_medium, utm_campaign, utm_term, utm_content FROM %s`, recordsTableName)
+	rows, err := tx.Query(selectSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []Record
+	for rows.Next() {
+		var r Record
+		err = rows.Scan(&r.Short, &r.Domain, &r.Full, &r.Canonical, &r.BaseURL,
+			&r.UTM.Source, &r.UTM.Medium, &r.UTM.Campaign, &r.UTM.Term, &r.UTM.Content)
+		if err != nil {
+			return nil, err
+		}
+		canonical, err := r.Canonicalize(normalizer)
+		if err != nil || canonical == r.Canonical {
+			continue
+		}
+		r.Canonical = canonical
+		updates = append(updates, r)
+	}
+	return updates, rows.Err()
+}
@@ -17,11 +17,36 @@ import (
 var _ Storager = &DBStorage{}
 
 var recordsTableName = "shorts"
+var workspacesTableName = "workspaces"
+var membersTableName = "workspace_members"
+var settingsTableName = "storage_settings"
+
+// dedupScopeSetting is name of the setting, which keeps scope the stored dedup keys were computed for
+const dedupScopeSetting = "dedup_scope"
+
+var recordColumns = "short, original, user_id, deleted, canonical, max_clicks, clicks, interstitial, redirect_status, passthrough, " +
+	"base_url, utm_source, utm_medium, utm_campaign, utm_term, utm_content, created_at, disabled, domain, workspace_id"
+
+// insertColumns are columns set on insert, values are returned by insertArgs
+var insertColumns = []string{
+	"short", "original", "user_id", "canonical", "dedup_key", "max_clicks", "interstitial", "redirect_status", "passthrough",
+	"base_url", "utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "created_at",
+	"deleted", "clicks", "disabled", "domain", "workspace_id",
+}
 var queryTimeout = 5 * time.Second
 var batchQueryTimeout = 30 * time.Second
 
+// cursorFetchSize is number of records fetched from the cursor at once
+var cursorFetchSize = 500
+
+const (
+	userRecordsCursor = "user_records_cursor"
+	allRecordsCursor  = "all_records_cursor"
+)
+
 type DBStorage struct {
-	db *sql.DB
+	db    *sql.DB
+	dedup DedupScope
 }
 
 func NewDBStorage(databaseDSN, migrationsDir string) (*DBStorage, error) {
@@ -35,7 +60,7 @@ func NewDBStorage(databaseDSN, migrationsDir string) (*DBStorage, error) {
 	db.SetConnMaxIdleTime(30 * time.Second)
 	db.SetConnMaxLifetime(2 * time.Minute)
 
-	storage := &DBStorage{db}
+	storage := &DBStorage{db: db}
 
 	//migrate
 	if migrationsDir != "" {
@@ -49,6 +74,106 @@ func NewDBStorage(databaseDSN, migrationsDir string) (*DBStorage, error) {
 	return storage, db.Ping()
 }
 
+// SetDedupScope changes which records are considered duplicates, global by default.
+// Scope is applied to newly stored records, SyncDedupScope applies it to the stored records
+func (s *DBStorage) SetDedupScope(scope DedupScope) {
+	s.dedup = scope
+}
+
+// SyncDedupScope recomputes dedup keys of all records, when they were computed for another scope or
+// canonical urls of the records changed. When records become duplicates of each other, the first created record
+// keeps its dedup key and the others never conflict. Inserts are blocked until keys are recomputed
+func (s *DBStorage) SyncDedupScope(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", recordsTableName)); err != nil {
+		return err
+	}
+	var stored string
+	selectSQL := fmt.Sprintf("SELECT value FROM %s WHERE name = $1", settingsTableName)
+	err = tx.QueryRowContext(ctx, selectSQL, dedupScopeSetting).Scan(&stored)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	scope := s.scope()
+	if DedupScope(stored) == scope {
+		return nil
+	}
+
+	keys, duplicates, err := dedupKeysOf(ctx, tx, scope)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET dedup_key = NULL", recordsTableName)); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("UPDATE %s SET dedup_key = $3 WHERE short = $1 AND domain = $2", recordsTableName))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, k := range keys {
+		if _, err = stmt.ExecContext(ctx, append(keyArgs(k.short), k.key)...); err != nil {
+			return err
+		}
+	}
+
+	upsertSQL := fmt.Sprintf(`INSERT INTO %s (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value`, settingsTableName)
+	if _, err = tx.ExecContext(ctx, upsertSQL, dedupScopeSetting, string(scope)); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		log.Printf("WARNING: %d records duplicate older records in %s dedup scope, they won't be returned as conflicts", duplicates, scope)
+	}
+	return nil
+}
+
+// recordDedupKey is dedup key of the record with the storage key short
+type recordDedupKey struct {
+	short string
+	key   string
+}
+
+// dedupKeysOf returns dedup keys of the stored records in order of creation and number of records, which duplicate
+// older records. Records without dedup key are skipped
+func dedupKeysOf(ctx context.Context, tx *sql.Tx, scope DedupScope) ([]recordDedupKey, int, error) {
+	selectSQL := fmt.Sprintf("SELECT short, domain, user_id, original, canonical FROM %s ORDER BY created_at, short", recordsTableName)
+	rows, err := tx.QueryContext(ctx, selectSQL)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var keys []recordDedupKey
+	seen := make(map[string]bool)
+	duplicates := 0
+	for rows.Next() {
+		var r Record
+		if err = rows.Scan(&r.Short, &r.Domain, &r.UserID, &r.Full, &r.Canonical); err != nil {
+			return nil, 0, err
+		}
+		key := scope.key(r)
+		if key == "" {
+			continue
+		}
+		if seen[key] {
+			duplicates++
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, recordDedupKey{short: r.Key(), key: key})
+	}
+	return keys, duplicates, rows.Err()
+}
+
 func (s *DBStorage) Close() error {
 	return s.db.Close()
 }
@@ -57,10 +182,8 @@ func (s *DBStorage) Store(ctx context.Context, record Record) error {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	insertSQL := fmt.Sprintf(`INSERT INTO
-		%s ("short", "original", "user_id") VALUES ($1, $2, $3)
-		ON CONFLICT DO NOTHING`, recordsTableName)
-	res, err := s.db.ExecContext(ctx, insertSQL, record.Short, record.Full, record.UserID)
+	insertSQL := fmt.Sprintf(`INSERT INTO %s %s ON CONFLICT DO NOTHING`, recordsTableName, insertValuesSQL())
+	res, err := s.db.ExecContext(ctx, insertSQL, s.insertArgs(record)...)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -72,17 +195,15 @@ func (s *DBStorage) Store(ctx context.Context, record Record) error {
 		return err
 	}
 	if insertedRows == 0 {
-		var oldRecord Record
 		// nothing inserted get conflicted row
-		selectSQL := fmt.Sprintf(`SELECT "short", "original", "user_id"
-		FROM %s WHERE "original" = $1`, recordsTableName)
-		row := s.db.QueryRowContext(ctx, selectSQL, record.Full)
-		err := row.Scan(&oldRecord.Short, &oldRecord.Full, &oldRecord.UserID)
+		oldRecord, err := s.loadConflicting(ctx, s.db, record)
 		if err != nil {
-			log.Println(err)
+			if !errors.Is(err, ErrShortTaken) {
+				log.Println(err)
+			}
 			return err
 		}
-		return NewRecordConflictError(oldRecord)
+		return &RecordConflictError{OldRecord: oldRecord, Scope: s.scope()}
 	}
 	return nil
 }
@@ -97,7 +218,7 @@ func (s *DBStorage) StoreBatch(ctx context.Context, records []Record) error {
 	}
 	defer tx.Rollback()
 
-	insertSQL := fmt.Sprintf(`INSERT INTO %s ("short", "original", "user_id") VALUES ($1, $2, $3)`, recordsTableName)
+	insertSQL := fmt.Sprintf(`INSERT INTO %s %s ON CONFLICT DO NOTHING`, recordsTableName, insertValuesSQL())
 	insertStmt, err := tx.Prepare(insertSQL)
 	if err != nil {
 		return err
@@ -106,24 +227,89 @@ func (s *DBStorage) StoreBatch(ctx context.Context, records []Record) error {
 	ctx, cancel := context.WithTimeout(ctx, batchQueryTimeout)
 	defer cancel()
 
+	conflicts := make(map[string]Record)
+	var taken []string
 	for _, record := range records {
-		_, err := insertStmt.ExecContext(ctx, record.Short, record.Full, record.UserID)
+		res, err := insertStmt.ExecContext(ctx, s.insertArgs(record)...)
 		if err != nil {
 			return err
 		}
+		insertedRows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if insertedRows == 0 {
+			oldRecord, err := s.loadConflicting(ctx, tx, record)
+			if errors.Is(err, ErrShortTaken) {
+				taken = append(taken, record.Key())
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			conflicts[record.Key()] = oldRecord
+		}
 	}
 
-	return tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 || len(taken) > 0 {
+		return &BatchConflictError{Conflicts: conflicts, Taken: taken, Scope: s.scope()}
+	}
+	return nil
+}
+
+// queryRower is implemented by sql.DB and sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// loadConflicting returns stored record with the same dedup key, as the record, which was not inserted.
+// Returns ErrShortTaken, if there is no such record
+func (s *DBStorage) loadConflicting(ctx context.Context, q queryRower, record Record) (Record, error) {
+	key := s.dedup.key(record)
+	if key == "" {
+		return Record{}, ErrShortTaken
+	}
+	selectSQL := fmt.Sprintf(`SELECT %s FROM %s WHERE "dedup_key" = $1`, recordColumns, recordsTableName)
+	oldRecord, err := scanRecord(q.QueryRowContext(ctx, selectSQL, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		// record was not inserted because of the primary key
+		return Record{}, ErrShortTaken
+	}
+	return oldRecord, err
+}
+
+func (s *DBStorage) Update(ctx context.Context, record Record) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	updateSQL := fmt.Sprintf(`UPDATE %s SET max_clicks = $3, interstitial = $4, redirect_status = $5, passthrough = $6
+		WHERE short = $1 AND domain = $2`, recordsTableName)
+	res, err := s.db.ExecContext(ctx, updateSQL, record.Short, record.Domain, record.MaxClicks, record.Interstitial,
+		record.RedirectStatus, string(record.Passthrough))
+	if err != nil {
+		return err
+	}
+
+	updatedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updatedRows == 0 {
+		return NewRecordNotFoundError(record.Key())
+	}
+	return nil
 }
 
 func (s *DBStorage) Load(ctx context.Context, short string) (Record, error) {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	r := Record{}
-	selectSQL := fmt.Sprintf("SELECT short, original, user_id, deleted FROM %s WHERE short = $1 LIMIT 1", recordsTableName)
-	row := s.db.QueryRowContext(ctx, selectSQL, short)
-	err := row.Scan(&r.Short, &r.Full, &r.UserID, &r.Deleted)
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s WHERE short = $1 AND domain = $2 LIMIT 1", recordColumns, recordsTableName)
+	row := s.db.QueryRowContext(ctx, selectSQL, keyArgs(short)...)
+	r, err := scanRecord(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Record{}, NewRecordNotFoundError(short)
@@ -142,18 +328,15 @@ func (s *DBStorage) LoadBatch(ctx context.Context, shorts []string) ([]Record, e
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	shortsPlaceholderList, args := prepareSQLPlaceholders(1, shorts)
-	shortsPlaceholderCommaList := strings.Join(shortsPlaceholderList, ",")
-
-	selectSQL := fmt.Sprintf("SELECT short, original, user_id, deleted FROM %s WHERE short in (%s) and deleted = FALSE", recordsTableName, shortsPlaceholderCommaList)
+	keysPlaceholderCommaList, args := prepareKeyPlaceholders(shorts)
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s WHERE (short, domain) in (%s) and deleted = FALSE", recordColumns, recordsTableName, keysPlaceholderCommaList)
 	rows, err := s.db.QueryContext(ctx, selectSQL, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	for rows.Next() {
-		var r Record
-		err = rows.Scan(&r.Short, &r.Full, &r.UserID, &r.Deleted)
+		r, err := scanRecord(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -172,15 +355,14 @@ func (s *DBStorage) LoadForUser(ctx context.Context, userID string) ([]Record, e
 	defer cancel()
 
 	recordList := make([]Record, 0)
-	selectSQL := fmt.Sprintf("SELECT short, original, user_id, deleted FROM %s WHERE user_id = $1 and deleted = FALSE", recordsTableName)
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s WHERE user_id = $1 and deleted = FALSE", recordColumns, recordsTableName)
 	rows, err := s.db.QueryContext(ctx, selectSQL, userID)
 	if err != nil {
 		return nil, err
 	}
 
 	for rows.Next() {
-		var r Record
-		err = rows.Scan(&r.Short, &r.Full, &r.UserID, &r.Deleted)
+		r, err := scanRecord(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -194,12 +376,39 @@ func (s *DBStorage) LoadForUser(ctx context.Context, userID string) ([]Record, e
 	return recordList, nil
 }
 
+// IterateForUser reads records of the user with server-side cursor, fetching cursorFetchSize records at once
+func (s *DBStorage) IterateForUser(ctx context.Context, userID string) (RecordIterator, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE user_id = $1 ORDER BY created_at, domain, short", recordColumns, recordsTableName)
+	return s.openCursor(ctx, userRecordsCursor, query, userID)
+}
+
+// IterateAll reads records with server-side cursor, fetching cursorFetchSize records at once
+func (s *DBStorage) IterateAll(ctx context.Context, after string) (RecordIterator, error) {
+	domain, short := SplitKey(after)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE (domain, short) > ($1, $2) ORDER BY domain, short", recordColumns, recordsTableName)
+	return s.openCursor(ctx, allRecordsCursor, query, domain, short)
+}
+
+// openCursor declares cursor for the query in the read only transaction, transaction is closed with the iterator
+func (s *DBStorage) openCursor(ctx context.Context, cursor, query string, args ...interface{}) (RecordIterator, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	declareSQL := fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", cursor, query)
+	if _, err = tx.ExecContext(ctx, declareSQL, args...); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return &cursorIterator{ctx: ctx, tx: tx, cursor: cursor}, nil
+}
+
 func (s *DBStorage) Delete(ctx context.Context, short string) error {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	deleteSQL := fmt.Sprintf("UPDATE %s SET deleted = TRUE WHERE short = $1", recordsTableName)
-	_, err := s.db.ExecContext(ctx, deleteSQL, short)
+	deleteSQL := fmt.Sprintf("UPDATE %s SET deleted = TRUE WHERE short = $1 AND domain = $2", recordsTableName)
+	_, err := s.db.ExecContext(ctx, deleteSQL, keyArgs(short)...)
 	return err
 }
 
@@ -211,19 +420,392 @@ func (s *DBStorage) DeleteBatch(ctx context.Context, shorts []string) error {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
-	shortsPlaceholderList, args := prepareSQLPlaceholders(1, shorts)
-	shortsPlaceholderCommaList := strings.Join(shortsPlaceholderList, ",")
-	updateSQL := fmt.Sprintf("UPDATE %s SET deleted = TRUE WHERE short IN (%s)", recordsTableName, shortsPlaceholderCommaList)
+	keysPlaceholderCommaList, args := prepareKeyPlaceholders(shorts)
+	updateSQL := fmt.Sprintf("UPDATE %s SET deleted = TRUE WHERE (short, domain) IN (%s)", recordsTableName, keysPlaceholderCommaList)
 	_, err := s.db.ExecContext(ctx, updateSQL, args...)
 	return err
 }
 
+func (s *DBStorage) RegisterClick(ctx context.Context, short string) (Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// counter is incremented in the same query with the limit check, so concurrent redirects can't overshoot
+	updateSQL := fmt.Sprintf(`UPDATE %s SET clicks = clicks + 1
+		WHERE short = $1 AND domain = $2 AND deleted = FALSE AND disabled = FALSE AND (max_clicks = 0 OR clicks < max_clicks)
+		RETURNING %s`, recordsTableName, recordColumns)
+	row := s.db.QueryRowContext(ctx, updateSQL, keyArgs(short)...)
+	r, err := scanRecord(row)
+	if err == nil {
+		return r, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Record{}, err
+	}
+
+	// nothing updated: record is missing, deleted, disabled or exhausted
+	r, err = s.Load(ctx, short)
+	if err != nil {
+		return Record{}, err
+	}
+	if r.Deleted || r.Disabled {
+		return r, nil
+	}
+	return r, ErrClicksExhausted
+}
+
+func (s *DBStorage) Restore(ctx context.Context, short string) error {
+	updateSQL := fmt.Sprintf("UPDATE %s SET deleted = FALSE WHERE short = $1 AND domain = $2", recordsTableName)
+	return s.updateOne(ctx, short, updateSQL, keyArgs(short)...)
+}
+
+func (s *DBStorage) SetDisabled(ctx context.Context, short string, disabled bool) error {
+	updateSQL := fmt.Sprintf("UPDATE %s SET disabled = $3 WHERE short = $1 AND domain = $2", recordsTableName)
+	return s.updateOne(ctx, short, updateSQL, append(keyArgs(short), disabled)...)
+}
+
+func (s *DBStorage) Reassign(ctx context.Context, short, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	r, err := s.Load(ctx, short)
+	if err != nil {
+		return err
+	}
+	r.UserID = userID
+	key := s.dedup.key(r)
+	if key != "" {
+		old, err := s.loadConflicting(ctx, s.db, r)
+		if err == nil && old.Key() != short {
+			return &RecordConflictError{OldRecord: old, Scope: s.scope()}
+		}
+		if err != nil && !errors.Is(err, ErrShortTaken) {
+			return err
+		}
+	}
+	dedupKey := sql.NullString{String: key, Valid: key != ""}
+	updateSQL := fmt.Sprintf("UPDATE %s SET user_id = $3, dedup_key = $4 WHERE short = $1 AND domain = $2", recordsTableName)
+	return s.updateOne(ctx, short, updateSQL, append(keyArgs(short), userID, dedupKey)...)
+}
+
+// updateOne executes update query of the record, returns RecordNotFoundError if nothing is updated
+func (s *DBStorage) updateOne(ctx context.Context, short, updateSQL string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, updateSQL, args...)
+	if err != nil {
+		return err
+	}
+	updatedRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updatedRows == 0 {
+		return NewRecordNotFoundError(short)
+	}
+	return nil
+}
+
+func (s *DBStorage) Stats(ctx context.Context) (Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, batchQueryTimeout)
+	defer cancel()
+
+	selectSQL := fmt.Sprintf(`SELECT count(*), count(*) FILTER (WHERE deleted), count(*) FILTER (WHERE disabled),
+		count(DISTINCT user_id), coalesce(sum(clicks), 0) FROM %s`, recordsTableName)
+	st := Stats{}
+	err := s.db.QueryRowContext(ctx, selectSQL).Scan(&st.Records, &st.Deleted, &st.Disabled, &st.Users, &st.Clicks)
+	return st, err
+}
+
+func (s *DBStorage) PurgeDeleted(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, batchQueryTimeout)
+	defer cancel()
+
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE deleted = TRUE", recordsTableName)
+	res, err := s.db.ExecContext(ctx, deleteSQL)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (s *DBStorage) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	return s.db.PingContext(ctx)
 }
 
+func (s *DBStorage) CreateWorkspace(ctx context.Context, w Workspace, ownerID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertSQL := fmt.Sprintf("INSERT INTO %s (id, name, created_at) VALUES ($1, $2, $3)", workspacesTableName)
+	if _, err = tx.ExecContext(ctx, insertSQL, w.ID, w.Name, w.CreatedAt); err != nil {
+		return err
+	}
+	insertSQL = fmt.Sprintf("INSERT INTO %s (workspace_id, user_id, role) VALUES ($1, $2, $3)", membersTableName)
+	if _, err = tx.ExecContext(ctx, insertSQL, w.ID, ownerID, string(RoleAdmin)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *DBStorage) LoadWorkspacesForUser(ctx context.Context, userID string) ([]Membership, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	selectSQL := fmt.Sprintf(`SELECT w.id, w.name, w.created_at, m.role FROM %s w JOIN %s m ON m.workspace_id = w.id
+		WHERE m.user_id = $1 ORDER BY w.created_at, w.id`, workspacesTableName, membersTableName)
+	rows, err := s.db.QueryContext(ctx, selectSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := make([]Membership, 0)
+	for rows.Next() {
+		var m Membership
+		if err = rows.Scan(&m.ID, &m.Name, &m.CreatedAt, &m.Role); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+func (s *DBStorage) LoadMembers(ctx context.Context, workspaceID string) ([]Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if err := s.checkWorkspace(ctx, workspaceID); err != nil {
+		return nil, err
+	}
+	selectSQL := fmt.Sprintf("SELECT workspace_id, user_id, role FROM %s WHERE workspace_id = $1 ORDER BY user_id", membersTableName)
+	rows, err := s.db.QueryContext(ctx, selectSQL, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]Member, 0)
+	for rows.Next() {
+		var m Member
+		if err = rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *DBStorage) MemberRole(ctx context.Context, workspaceID, userID string) (Role, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	selectSQL := fmt.Sprintf(`SELECT coalesce(m.role, '') FROM %s w LEFT JOIN %s m ON m.workspace_id = w.id AND m.user_id = $2
+		WHERE w.id = $1`, workspacesTableName, membersTableName)
+	var role Role
+	err := s.db.QueryRowContext(ctx, selectSQL, workspaceID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrWorkspaceNotFound
+	}
+	return role, err
+}
+
+func (s *DBStorage) SetMember(ctx context.Context, m Member) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if err := s.checkWorkspace(ctx, m.WorkspaceID); err != nil {
+		return err
+	}
+	upsertSQL := fmt.Sprintf(`INSERT INTO %s (workspace_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role`, membersTableName)
+	_, err := s.db.ExecContext(ctx, upsertSQL, m.WorkspaceID, m.UserID, string(m.Role))
+	return err
+}
+
+func (s *DBStorage) RemoveMember(ctx context.Context, workspaceID, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if err := s.checkWorkspace(ctx, workspaceID); err != nil {
+		return err
+	}
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE workspace_id = $1 AND user_id = $2", membersTableName)
+	return s.updateOne(ctx, userID, deleteSQL, workspaceID, userID)
+}
+
+func (s *DBStorage) LoadForWorkspace(ctx context.Context, workspaceID string) ([]Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	selectSQL := fmt.Sprintf("SELECT %s FROM %s WHERE workspace_id = $1 and deleted = FALSE ORDER BY created_at, domain, short",
+		recordColumns, recordsTableName)
+	rows, err := s.db.QueryContext(ctx, selectSQL, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordList := make([]Record, 0)
+	for rows.Next() {
+		r, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		recordList = append(recordList, r)
+	}
+	return recordList, rows.Err()
+}
+
+// checkWorkspace returns ErrWorkspaceNotFound, if the workspace doesn't exist
+func (s *DBStorage) checkWorkspace(ctx context.Context, workspaceID string) error {
+	selectSQL := fmt.Sprintf("SELECT 1 FROM %s WHERE id = $1", workspacesTableName)
+	var found int
+	err := s.db.QueryRowContext(ctx, selectSQL, workspaceID).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWorkspaceNotFound
+	}
+	return err
+}
+
+// cursorIterator fetches records from the server-side cursor declared in the transaction
+type cursorIterator struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	cursor  string
+	buffer  []Record
+	current Record
+	done    bool
+	err     error
+}
+
+func (it *cursorIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.buffer) == 0 {
+		if it.done {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil || len(it.buffer) == 0 {
+			return false
+		}
+	}
+	it.current = it.buffer[0]
+	it.buffer = it.buffer[1:]
+	return true
+}
+
+// fetch reads next portion of the records from the cursor
+func (it *cursorIterator) fetch() error {
+	rows, err := it.tx.QueryContext(it.ctx, fmt.Sprintf("FETCH %d FROM %s", cursorFetchSize, it.cursor))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	it.buffer = it.buffer[:0]
+	for rows.Next() {
+		r, err := scanRecord(rows)
+		if err != nil {
+			return err
+		}
+		it.buffer = append(it.buffer, r)
+	}
+	if len(it.buffer) < cursorFetchSize {
+		it.done = true
+	}
+	return rows.Err()
+}
+
+func (it *cursorIterator) Record() Record {
+	return it.current
+}
+
+func (it *cursorIterator) Err() error {
+	return it.err
+}
+
+// Close closes the cursor with the transaction
+func (it *cursorIterator) Close() error {
+	return it.tx.Rollback()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRecord reads record from the row, selected with recordColumns
+func scanRecord(row rowScanner) (Record, error) {
+	var r Record
+	err := row.Scan(&r.Short, &r.Full, &r.UserID, &r.Deleted, &r.Canonical, &r.MaxClicks, &r.Clicks, &r.Interstitial, &r.RedirectStatus, &r.Passthrough,
+		&r.BaseURL, &r.UTM.Source, &r.UTM.Medium, &r.UTM.Campaign, &r.UTM.Term, &r.UTM.Content, &r.CreatedAt, &r.Disabled, &r.Domain, &r.WorkspaceID)
+	return r, err
+}
+
+// insertValuesSQL returns columns and values placeholders part of the insert query
+func insertValuesSQL() string {
+	quoted := make([]string, 0, len(insertColumns))
+	for _, c := range insertColumns {
+		quoted = append(quoted, `"`+c+`"`)
+	}
+	placeholders, _ := prepareSQLPlaceholders(1, insertColumns)
+	return fmt.Sprintf("(%s) VALUES (%s)", strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+}
+
+// scope returns dedup scope of the storage, global if not set
+func (s *DBStorage) scope() DedupScope {
+	if s.dedup == "" {
+		return DedupGlobal
+	}
+	return s.dedup
+}
+
+// insertArgs returns values of the record for insertColumns
+func (s *DBStorage) insertArgs(r Record) []interface{} {
+	key := s.dedup.key(r)
+	dedupKey := sql.NullString{String: key, Valid: key != ""}
+	return []interface{}{
+		r.Short, r.Full, r.UserID, r.CanonicalURL(), dedupKey, r.MaxClicks, r.Interstitial, r.RedirectStatus, string(r.Passthrough),
+		r.BaseURL, r.UTM.Source, r.UTM.Medium, r.UTM.Campaign, r.UTM.Term, r.UTM.Content, createdAt(r),
+		r.Deleted, r.Clicks, r.Disabled, r.Domain, r.WorkspaceID,
+	}
+}
+
+// keyArgs returns short and domain of the key, as they are compared in queries
+func keyArgs(key string) []interface{} {
+	domain, short := SplitKey(key)
+	return []interface{}{short, domain}
+}
+
+// prepareKeyPlaceholders returns list of (short, domain) placeholders for the keys and values for them
+func prepareKeyPlaceholders(keys []string) (string, []interface{}) {
+	placeholders := make([]string, 0, len(keys))
+	args := make([]interface{}, 0, 2*len(keys))
+	for i, key := range keys {
+		placeholders = append(placeholders, fmt.Sprintf("($%d,$%d)", 2*i+1, 2*i+2))
+		args = append(args, keyArgs(key)...)
+	}
+	return strings.Join(placeholders, ","), args
+}
+
+// createdAt returns creation time of the record, records created without NewRecord get current time
+func createdAt(r Record) time.Time {
+	if r.CreatedAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return r.CreatedAt
+}
+
 // prepareSQLPlaceholders create 2 arrays:
 // 1 - with placeholders with indexes starting from `startIndex`
 // 2 - with values for that placeholders
@@ -0,0 +1,152 @@
+package storage
+
+import "fmt"
+
+// DedupScope defines which records are considered duplicates of each other
+type DedupScope string
+
+const (
+	// DedupGlobal - the same url can be shortened only once across all users
+	DedupGlobal DedupScope = "global"
+	// DedupUser - the same url can be shortened once per user
+	DedupUser DedupScope = "user"
+	// DedupNone - the same url can be shortened any number of times
+	DedupNone DedupScope = "none"
+)
+
+// ParseDedupScope returns scope by its name, empty name means DedupGlobal
+func ParseDedupScope(name string) (DedupScope, error) {
+	switch scope := DedupScope(name); scope {
+	case "":
+		return DedupGlobal, nil
+	case DedupGlobal, DedupUser, DedupNone:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown dedup scope: %s", name)
+	}
+}
+
+// key returns key of the record, records with the same key are duplicates.
+// Records of different domains never conflict. Empty key means record never conflicts
+func (s DedupScope) key(r Record) string {
+	var key string
+	switch s {
+	case DedupNone:
+		return ""
+	case DedupUser:
+		key = r.UserID + " " + r.CanonicalURL()
+	default:
+		key = r.CanonicalURL()
+	}
+	if r.Domain != "" {
+		key = r.Domain + " " + key
+	}
+	return key
+}
+
+// dedupIndex maps dedup keys to storage keys of the records, used by in-memory storages to detect conflicts
+type dedupIndex struct {
+	scope  DedupScope
+	shorts map[string]string
+}
+
+func newDedupIndex(scope DedupScope, records RecordMap) *dedupIndex {
+	if scope == "" {
+		scope = DedupGlobal
+	}
+	idx := &dedupIndex{scope: scope, shorts: make(map[string]string, len(records))}
+	// the oldest of duplicate records keeps the key, the others don't conflict
+	sorted := make([]Record, 0, len(records))
+	for _, r := range records {
+		sorted = append(sorted, r)
+	}
+	sortByCreation(sorted)
+	for _, r := range sorted {
+		if key := scope.key(r); key != "" {
+			if _, ok := idx.shorts[key]; !ok {
+				idx.shorts[key] = r.Key()
+			}
+		}
+	}
+	return idx
+}
+
+// findConflict returns RecordConflictError, if the record conflicts with stored records,
+// or ErrShortTaken, if short of the record is used by another record
+func (idx *dedupIndex) findConflict(stored RecordMap, r Record) error {
+	_, conflictErr := idx.split(stored, []Record{r})
+	if conflictErr == nil {
+		return nil
+	}
+	if old, ok := conflictErr.Conflicts[r.Key()]; ok {
+		return &RecordConflictError{OldRecord: old, Scope: idx.scope}
+	}
+	return ErrShortTaken
+}
+
+// split divides records into fresh ones and the ones conflicting with stored records or
+// with a previous record of the list. Returns nil error, if there are no conflicts
+func (idx *dedupIndex) split(stored RecordMap, records []Record) ([]Record, *BatchConflictError) {
+	fresh := make([]Record, 0, len(records))
+	conflicts := make(map[string]Record)
+	var taken []string
+	pending := make(map[string]Record, len(records))
+	pendingShorts := make(map[string]bool, len(records))
+	for _, r := range records {
+		if _, ok := stored[r.Key()]; ok || pendingShorts[r.Key()] {
+			taken = append(taken, r.Key())
+			continue
+		}
+		if key := idx.scope.key(r); key != "" {
+			if short, ok := idx.shorts[key]; ok {
+				if old, ok := stored[short]; ok {
+					conflicts[r.Key()] = old
+					continue
+				}
+			}
+			if old, ok := pending[key]; ok {
+				conflicts[r.Key()] = old
+				continue
+			}
+			pending[key] = r
+		}
+		pendingShorts[r.Key()] = true
+		fresh = append(fresh, r)
+	}
+	if len(conflicts) == 0 && len(taken) == 0 {
+		return fresh, nil
+	}
+	return fresh, &BatchConflictError{Conflicts: conflicts, Taken: taken, Scope: idx.scope}
+}
+
+func (idx *dedupIndex) add(r Record) {
+	if key := idx.scope.key(r); key != "" {
+		idx.shorts[key] = r.Key()
+	}
+}
+
+func (idx *dedupIndex) remove(r Record) {
+	key := idx.scope.key(r)
+	if key != "" && idx.shorts[key] == r.Key() {
+		delete(idx.shorts, key)
+	}
+}
+
+// reassign changes owner of the stored record, keeping the index up to date
+func (idx *dedupIndex) reassign(stored RecordMap, short, userID string) error {
+	r, ok := stored[short]
+	if !ok {
+		return NewRecordNotFoundError(short)
+	}
+	updated := r
+	updated.UserID = userID
+	if key := idx.scope.key(updated); key != "" {
+		if other, ok := idx.shorts[key]; ok && other != short {
+			return &RecordConflictError{OldRecord: stored[other], Scope: idx.scope}
+		}
+	}
+	idx.remove(r)
+	stored[short] = updated
+	idx.add(updated)
+	return nil
+}
@@ -19,6 +19,8 @@ func NewRecordNotFoundError(value string) *RecordNotFoundError {
 
 type RecordConflictError struct {
 	OldRecord Record
+	// Scope in which the record was found
+	Scope DedupScope
 }
 
 func (re *RecordConflictError) Error() string {
@@ -26,7 +28,22 @@ func (re *RecordConflictError) Error() string {
 }
 
 func NewRecordConflictError(record Record) *RecordConflictError {
-	return &RecordConflictError{record}
+	return &RecordConflictError{OldRecord: record, Scope: DedupGlobal}
+}
+
+// BatchConflictError is returned by StoreBatch, when some of the records conflict with already stored ones
+type BatchConflictError struct {
+	// Conflicts maps key of the conflicting record to the already stored record
+	Conflicts map[string]Record
+	// Taken are keys of the records, which shorts are used by other records of the domain
+	Taken []string
+	Scope DedupScope
+}
+
+func (be *BatchConflictError) Error() string {
+	return fmt.Sprintf("%d records already exist, %d shorts are taken", len(be.Conflicts), len(be.Taken))
 }
 
 var ErrAccessDenied = errors.New("access denied")
+var ErrShortTaken = errors.New("short is already taken")
+var ErrClicksExhausted = errors.New("clicks limit exhausted")
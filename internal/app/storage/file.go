@@ -6,19 +6,34 @@ import (
 	"errors"
 	"io"
 	"os"
+	"sync"
+
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
 )
 
 var _ Storager = &FileStorage{}
 
+// clickSaveBatch is number of clicks of records without clicks limit, which are kept in memory before the file
+// is written. Clicks of limited records are written at once, so the limit survives restarts
+var clickSaveBatch = 100
+
 type FileStorage struct {
+	mu       sync.Mutex
 	records  RecordMap
+	index    *dedupIndex
+	dedup    DedupScope
 	filepath string
+	// workspaces are kept next to the records file, see workspacesPath
+	workspaces *workspaceSet
+	// unsavedClicks is number of clicks, which aren't written to the file yet
+	unsavedClicks int
 }
 
 func NewFileStorage(filepath string) (*FileStorage, error) {
 	storage := &FileStorage{
-		records:  make(RecordMap),
-		filepath: filepath,
+		records:    make(RecordMap),
+		filepath:   filepath,
+		workspaces: newWorkspaceSet(),
 	}
 	if err := storage.restore(); err != nil {
 		return nil, err
@@ -44,34 +59,116 @@ func (s *FileStorage) restore() error {
 		} else if err != nil {
 			return err
 		}
-		s.records[record.Short] = record
+		if record.Canonical == "" {
+			// records stored before urls were normalized, tracking params are stripped only by config
+			if canonical, err := record.Canonicalize(urlnormalizer.Normalizer{}); err == nil {
+				record.Canonical = canonical
+			}
+		}
+		s.records[record.Key()] = record
 	}
-	return nil
+	s.index = newDedupIndex(s.dedup, s.records)
+	return s.restoreWorkspaces()
+}
+
+// workspacesPath returns path of the file with workspaces and their members
+func (s *FileStorage) workspacesPath() string {
+	return s.filepath + ".workspaces"
+}
+
+func (s *FileStorage) restoreWorkspaces() error {
+	s.workspaces = newWorkspaceSet()
+	data, err := os.ReadFile(s.workspacesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, s.workspaces)
+}
+
+func (s *FileStorage) saveWorkspaces() error {
+	data, err := json.Marshal(s.workspaces)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.workspacesPath(), data, 0666)
+}
+
+// SetDedupScope changes which records are considered duplicates, global by default
+func (s *FileStorage) SetDedupScope(scope DedupScope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dedup = scope
+	s.index = newDedupIndex(scope, s.records)
 }
 
 func (s *FileStorage) Store(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.records == nil {
 		if err := s.restore(); err != nil {
 			return err
 		}
 	}
-	s.records[record.Short] = record
+	if err := s.index.findConflict(s.records, record); err != nil {
+		return err
+	}
+	s.records[record.Key()] = record
+	s.index.add(record)
 	return s.saveToFile()
 }
 
 func (s *FileStorage) StoreBatch(_ context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return err
+		}
+	}
+	fresh, conflictErr := s.index.split(s.records, records)
+	if len(fresh) > 0 {
+		for _, record := range fresh {
+			s.records[record.Key()] = record
+			s.index.add(record)
+		}
+		if err := s.saveToFile(); err != nil {
+			return err
+		}
+	}
+	if conflictErr != nil {
+		return conflictErr
+	}
+	return nil
+}
+
+func (s *FileStorage) Update(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.records == nil {
 		if err := s.restore(); err != nil {
 			return err
 		}
 	}
-	for _, record := range records {
-		s.records[record.Short] = record
+
+	r, ok := s.records[record.Key()]
+	if !ok {
+		return NewRecordNotFoundError(record.Key())
 	}
+	applySettings(&r, record)
+	s.records[record.Key()] = r
 	return s.saveToFile()
 }
 
 func (s *FileStorage) Load(_ context.Context, short string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.records == nil {
 		if err := s.restore(); err != nil {
 			return Record{}, err
@@ -85,6 +182,9 @@ func (s *FileStorage) Load(_ context.Context, short string) (Record, error) {
 }
 
 func (s *FileStorage) LoadBatch(_ context.Context, shorts []string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.records == nil {
 		if err := s.restore(); err != nil {
 			return nil, err
@@ -103,6 +203,9 @@ func (s *FileStorage) LoadBatch(_ context.Context, shorts []string) ([]Record, e
 }
 
 func (s *FileStorage) LoadForUser(_ context.Context, userID string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.records == nil {
 		if err := s.restore(); err != nil {
 			return nil, err
@@ -119,29 +222,173 @@ func (s *FileStorage) LoadForUser(_ context.Context, userID string) ([]Record, e
 	return recordList, nil
 }
 
+func (s *FileStorage) IterateForUser(ctx context.Context, userID string) (RecordIterator, error) {
+	records, err := s.LoadForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sortByCreation(records)
+	return newSliceIterator(records), nil
+}
+
+func (s *FileStorage) IterateAll(_ context.Context, after string) (RecordIterator, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return nil, err
+		}
+	}
+
+	return newSliceIterator(recordsAfter(s.records, after)), nil
+}
+
 func (s *FileStorage) Delete(_ context.Context, short string) error {
-	if _, ok := s.records[short]; !ok {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[short]
+	if !ok {
 		return NewRecordNotFoundError(short)
 	}
 	delete(s.records, short)
+	s.index.remove(r)
 	return s.saveToFile()
 }
 
 func (s *FileStorage) DeleteBatch(ctx context.Context, shorts []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// check all shorts exists
-	filteredShorts := make([]string, 0, len(shorts))
 	for _, short := range shorts {
 		if _, ok := s.records[short]; !ok {
 			return NewRecordNotFoundError(short)
 		}
 	}
 	// delete them
-	for _, short := range filteredShorts {
+	for _, short := range shorts {
+		s.index.remove(s.records[short])
 		delete(s.records, short)
 	}
 	return s.saveToFile()
 }
 
+func (s *FileStorage) RegisterClick(_ context.Context, short string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return Record{}, err
+		}
+	}
+
+	r, ok := s.records[short]
+	if !ok {
+		return Record{}, NewRecordNotFoundError(short)
+	}
+	if r.Deleted || r.Disabled {
+		return r, nil
+	}
+	if r.Exhausted() {
+		return r, ErrClicksExhausted
+	}
+	r.Clicks++
+	s.records[short] = r
+	s.unsavedClicks++
+	if r.MaxClicks == 0 && s.unsavedClicks < clickSaveBatch {
+		return r, nil
+	}
+	return r, s.saveToFile()
+}
+
+// Flush writes clicks, which are kept in memory, to the file
+func (s *FileStorage) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unsavedClicks == 0 {
+		return nil
+	}
+	return s.saveToFile()
+}
+
+func (s *FileStorage) Restore(_ context.Context, short string) error {
+	return s.modify(short, func(r *Record) {
+		r.Deleted = false
+	})
+}
+
+func (s *FileStorage) SetDisabled(_ context.Context, short string, disabled bool) error {
+	return s.modify(short, func(r *Record) {
+		r.Disabled = disabled
+	})
+}
+
+// modify changes stored record with fn and saves records to the file
+func (s *FileStorage) modify(short string, fn func(r *Record)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return err
+		}
+	}
+	r, ok := s.records[short]
+	if !ok {
+		return NewRecordNotFoundError(short)
+	}
+	fn(&r)
+	s.records[short] = r
+	return s.saveToFile()
+}
+
+func (s *FileStorage) Reassign(_ context.Context, short, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return err
+		}
+	}
+	if err := s.index.reassign(s.records, short, userID); err != nil {
+		return err
+	}
+	return s.saveToFile()
+}
+
+func (s *FileStorage) Stats(_ context.Context) (Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return Stats{}, err
+		}
+	}
+	return recordsStats(s.records), nil
+}
+
+func (s *FileStorage) PurgeDeleted(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return 0, err
+		}
+	}
+	purged := purgeDeleted(s.records, s.index)
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, s.saveToFile()
+}
+
 func (s *FileStorage) Ping(_ context.Context) error {
 	return nil
 }
@@ -159,5 +406,67 @@ func (s *FileStorage) saveToFile() error {
 			return err
 		}
 	}
+	s.unsavedClicks = 0
 	return nil
 }
+
+func (s *FileStorage) CreateWorkspace(_ context.Context, w Workspace, ownerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workspaces.create(w, ownerID)
+	return s.saveWorkspaces()
+}
+
+func (s *FileStorage) LoadWorkspacesForUser(_ context.Context, userID string) ([]Membership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaces.forUser(userID), nil
+}
+
+func (s *FileStorage) LoadMembers(_ context.Context, workspaceID string) ([]Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaces.members(workspaceID)
+}
+
+func (s *FileStorage) MemberRole(_ context.Context, workspaceID, userID string) (Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaces.role(workspaceID, userID)
+}
+
+func (s *FileStorage) SetMember(_ context.Context, m Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.workspaces.setMember(m); err != nil {
+		return err
+	}
+	return s.saveWorkspaces()
+}
+
+func (s *FileStorage) RemoveMember(_ context.Context, workspaceID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.workspaces.removeMember(workspaceID, userID); err != nil {
+		return err
+	}
+	return s.saveWorkspaces()
+}
+
+func (s *FileStorage) LoadForWorkspace(_ context.Context, workspaceID string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records == nil {
+		if err := s.restore(); err != nil {
+			return nil, err
+		}
+	}
+	return recordsOfWorkspace(s.records, workspaceID), nil
+}
@@ -56,6 +56,27 @@ func TestFileStorage(t *testing.T) {
 		assert.NotEqual(t, testData, fileData)
 	})
 
+	t.Run("workspaces save across instances", func(t *testing.T) {
+		resetFileContents(t, tempfilepath)
+		defer os.Remove(tempfilepath + ".workspaces")
+		store, err := NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+
+		w, err := NewWorkspace("team")
+		require.NoError(t, err)
+		require.NoError(t, store.CreateWorkspace(ctx, w, "testUser"))
+		require.NoError(t, store.SetMember(ctx, Member{WorkspaceID: w.ID, UserID: "otherUser", Role: RoleEditor}))
+
+		store, err = NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+		role, err := store.MemberRole(ctx, w.ID, "otherUser")
+		require.NoError(t, err)
+		assert.Equal(t, RoleEditor, role)
+		memberships, err := store.LoadWorkspacesForUser(ctx, "testUser")
+		require.NoError(t, err)
+		assert.Equal(t, []Membership{{Workspace: w, Role: RoleAdmin}}, memberships)
+	})
+
 	t.Run("data saves across instances", func(t *testing.T) {
 		resetFileContents(t, tempfilepath)
 		store, err := NewFileStorage(tempfilepath)
@@ -112,6 +133,19 @@ func TestFileStorage(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("deletes batch across instances", func(t *testing.T) {
+		resetFileContents(t, tempfilepath)
+		store, err := NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+
+		require.NoError(t, store.DeleteBatch(ctx, []string{"test"}))
+
+		store, err = NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+		_, err = store.Load(ctx, "test")
+		assert.Error(t, err)
+	})
+
 	t.Run("return error on when deleting key not exists", func(t *testing.T) {
 		resetFileContents(t, tempfilepath)
 		store, err := NewFileStorage(tempfilepath)
@@ -178,6 +212,85 @@ func TestFileStorage(t *testing.T) {
 		assert.Len(t, records, 0)
 	})
 
+	t.Run("normalizes urls of records stored before normalization", func(t *testing.T) {
+		data := `{"short":"new","full":"http://example.com/","user_id":"u","created_at":"2022-02-01T00:00:00Z"}` + "\n" +
+			`{"short":"old","full":"HTTP://Example.com","user_id":"u","created_at":"2022-01-01T00:00:00Z"}`
+		require.NoError(t, os.WriteFile(tempfilepath, []byte(data), 0666))
+		store, err := NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+
+		r, err := NewRecord("http://example.com:80", "other")
+		require.NoError(t, err)
+		r.Canonical = "http://example.com/"
+		var conflictErr *RecordConflictError
+		require.ErrorAs(t, store.Store(ctx, r), &conflictErr)
+		assert.Equal(t, "old", conflictErr.OldRecord.Short, "the oldest of duplicates is returned")
+	})
+
+	t.Run("stores fresh records of the batch with conflicts", func(t *testing.T) {
+		resetFileContents(t, tempfilepath)
+		store, err := NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+
+		r1, err := NewRecord("http://example.com/testme", "testUser2")
+		require.NoError(t, err)
+		r2, err := NewRecord("http://example.com/batch", "testUser2")
+		require.NoError(t, err)
+
+		err = store.StoreBatch(ctx, []Record{r1, r2})
+		var e *BatchConflictError
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, "test", e.Conflicts[r1.Short].Short)
+		assert.Len(t, e.Conflicts, 1)
+
+		store, err = NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+		_, err = store.Load(ctx, r2.Short)
+		assert.NoError(t, err)
+	})
+
+	t.Run("counts clicks across instances", func(t *testing.T) {
+		resetFileContents(t, tempfilepath)
+		store, err := NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+
+		r, err := NewRecord("http://example.com/once", "testUser")
+		require.NoError(t, err)
+		r.MaxClicks = 1
+		require.NoError(t, store.Store(ctx, r))
+
+		_, err = store.RegisterClick(ctx, r.Short)
+		require.NoError(t, err)
+
+		store, err = NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+		_, err = store.RegisterClick(ctx, r.Short)
+		assert.ErrorIs(t, err, ErrClicksExhausted)
+	})
+
+	t.Run("saves clicks of unlimited records in batches", func(t *testing.T) {
+		resetFileContents(t, tempfilepath)
+		store, err := NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+		before, err := os.ReadFile(tempfilepath)
+		require.NoError(t, err)
+
+		for i := 0; i < clickSaveBatch-1; i++ {
+			_, err = store.RegisterClick(ctx, "test")
+			require.NoError(t, err)
+		}
+		after, err := os.ReadFile(tempfilepath)
+		require.NoError(t, err)
+		assert.Equal(t, before, after, "redirects don't rewrite the file")
+
+		require.NoError(t, store.Flush())
+		store, err = NewFileStorage(tempfilepath)
+		require.NoError(t, err)
+		r, err := store.Load(ctx, "test")
+		require.NoError(t, err)
+		assert.Equal(t, int64(clickSaveBatch-1), r.Clicks)
+	})
+
 	err := os.WriteFile(tempfilepath, []byte("{\"short\":\"asd\",\"full\":\"http://example.com/tes"), 0666)
 	require.NoError(t, err)
 	t.Run("returns errors when fails to read file", func(t *testing.T) {
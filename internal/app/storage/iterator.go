@@ -0,0 +1,89 @@
+package storage
+
+import "sort"
+
+// RecordIterator iterates over records without loading all of them at once. Usage is similar to sql.Rows:
+//
+//	for it.Next() {
+//		r := it.Record()
+//	}
+//	err := it.Err()
+//
+// Iterator must be closed after use
+type RecordIterator interface {
+	// Next prepares next record, returns false when there are no more records or error occurred
+	Next() bool
+	// Record returns current record
+	Record() Record
+	// Err returns error occurred during iteration
+	Err() error
+	Close() error
+}
+
+// sliceIterator iterates over records already loaded in memory
+type sliceIterator struct {
+	records []Record
+	current int
+}
+
+func newSliceIterator(records []Record) *sliceIterator {
+	return &sliceIterator{records: records, current: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.current+1 >= len(it.records) {
+		return false
+	}
+	it.current++
+	return true
+}
+
+func (it *sliceIterator) Record() Record {
+	return it.records[it.current]
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	it.records = nil
+	return nil
+}
+
+// sortByCreation orders records by creation time, records created at the same time are ordered by key
+func sortByCreation(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreatedAt.Equal(records[j].CreatedAt) {
+			return lessKey(records[i].Domain, records[i].Short, records[j].Domain, records[j].Short)
+		}
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+}
+
+// sortByKey orders records by domain and short
+func sortByKey(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		return lessKey(records[i].Domain, records[i].Short, records[j].Domain, records[j].Short)
+	})
+}
+
+// recordsAfter returns records ordered by domain and short, which follow the key
+func recordsAfter(records RecordMap, after string) []Record {
+	domain, short := SplitKey(after)
+	result := make([]Record, 0, len(records))
+	for _, r := range records {
+		if after == "" || lessKey(domain, short, r.Domain, r.Short) {
+			result = append(result, r)
+		}
+	}
+	sortByKey(result)
+	return result
+}
+
+func lessKey(domainA, shortA, domainB, shortB string) bool {
+	if domainA != domainB {
+		return domainA < domainB
+	}
+	return shortA < shortB
+}
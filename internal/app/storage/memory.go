@@ -2,38 +2,90 @@ package storage
 
 import (
 	"context"
+	"sync"
 )
 
 var _ Storager = &MemoryStorage{}
 
 type MemoryStorage struct {
+	mu      sync.RWMutex
 	records RecordMap
+	// index of records by dedup key, built on first store
+	index *dedupIndex
+	dedup DedupScope
+	// workspaces with their members, created on first use
+	workspaces *workspaceSet
 }
 
 func NewMemoryStorage(records RecordMap) *MemoryStorage {
 	return &MemoryStorage{records: records}
 }
 
+// SetDedupScope changes which records are considered duplicates, global by default
+func (s *MemoryStorage) SetDedupScope(scope DedupScope) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dedup = scope
+	s.index = nil
+}
+
 func (s *MemoryStorage) Store(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.records == nil {
 		s.records = make(RecordMap)
 	}
-	s.records[record.Short] = record //Record{Short: short, Full: full, UserID: userID}
+	if s.index == nil {
+		s.index = newDedupIndex(s.dedup, s.records)
+	}
+	if err := s.index.findConflict(s.records, record); err != nil {
+		return err
+	}
+	s.records[record.Key()] = record
+	s.index.add(record)
 	return nil
 }
 
 func (s *MemoryStorage) StoreBatch(_ context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.records == nil {
 		s.records = make(RecordMap)
 	}
+	if s.index == nil {
+		s.index = newDedupIndex(s.dedup, s.records)
+	}
+	fresh, conflictErr := s.index.split(s.records, records)
+	for _, record := range fresh {
+		s.records[record.Key()] = record
+		s.index.add(record)
+	}
+	if conflictErr != nil {
+		return conflictErr
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Update(_ context.Context, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	for _, record := range records {
-		s.records[record.Short] = record
+	r, ok := s.records[record.Key()]
+	if !ok {
+		return NewRecordNotFoundError(record.Key())
 	}
+	applySettings(&r, record)
+	s.records[record.Key()] = r
 	return nil
 }
 
 func (s *MemoryStorage) Load(_ context.Context, short string) (Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if r, ok := s.records[short]; ok {
 		return r, nil
 	}
@@ -41,6 +93,9 @@ func (s *MemoryStorage) Load(_ context.Context, short string) (Record, error) {
 }
 
 func (s *MemoryStorage) LoadBatch(_ context.Context, shorts []string) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	recordsList := make([]Record, 0)
 	for _, short := range shorts {
 		r, ok := s.records[short]
@@ -53,6 +108,9 @@ func (s *MemoryStorage) LoadBatch(_ context.Context, shorts []string) ([]Record,
 }
 
 func (s *MemoryStorage) LoadForUser(_ context.Context, userID string) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	recordsList := make([]Record, 0)
 	for _, record := range s.records {
 		if record.UserID == userID {
@@ -62,15 +120,38 @@ func (s *MemoryStorage) LoadForUser(_ context.Context, userID string) ([]Record,
 	return recordsList, nil
 }
 
+func (s *MemoryStorage) IterateForUser(ctx context.Context, userID string) (RecordIterator, error) {
+	records, err := s.LoadForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sortByCreation(records)
+	return newSliceIterator(records), nil
+}
+
+func (s *MemoryStorage) IterateAll(_ context.Context, after string) (RecordIterator, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return newSliceIterator(recordsAfter(s.records, after)), nil
+}
+
 func (s *MemoryStorage) Delete(_ context.Context, short string) error {
-	if _, ok := s.records[short]; !ok {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[short]
+	if !ok {
 		return NewRecordNotFoundError(short)
 	}
-	delete(s.records, short)
+	s.remove(r)
 	return nil
 }
 
 func (s *MemoryStorage) DeleteBatch(ctx context.Context, shorts []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// check all shorts exists
 	for _, short := range shorts {
 		if _, ok := s.records[short]; !ok {
@@ -79,11 +160,146 @@ func (s *MemoryStorage) DeleteBatch(ctx context.Context, shorts []string) error
 	}
 	// delete them
 	for _, short := range shorts {
-		delete(s.records, short)
+		s.remove(s.records[short])
+	}
+	return nil
+}
+
+// remove deletes record from records and the index
+func (s *MemoryStorage) remove(r Record) {
+	delete(s.records, r.Key())
+	if s.index != nil {
+		s.index.remove(r)
+	}
+}
+
+func (s *MemoryStorage) RegisterClick(_ context.Context, short string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[short]
+	if !ok {
+		return Record{}, NewRecordNotFoundError(short)
+	}
+	if r.Deleted || r.Disabled {
+		return r, nil
+	}
+	if r.Exhausted() {
+		return r, ErrClicksExhausted
+	}
+	r.Clicks++
+	s.records[short] = r
+	return r, nil
+}
+
+func (s *MemoryStorage) Restore(_ context.Context, short string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[short]
+	if !ok {
+		return NewRecordNotFoundError(short)
 	}
+	r.Deleted = false
+	s.records[short] = r
 	return nil
 }
 
+func (s *MemoryStorage) SetDisabled(_ context.Context, short string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[short]
+	if !ok {
+		return NewRecordNotFoundError(short)
+	}
+	r.Disabled = disabled
+	s.records[short] = r
+	return nil
+}
+
+func (s *MemoryStorage) Reassign(_ context.Context, short, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index == nil {
+		s.index = newDedupIndex(s.dedup, s.records)
+	}
+	return s.index.reassign(s.records, short, userID)
+}
+
+func (s *MemoryStorage) Stats(_ context.Context) (Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return recordsStats(s.records), nil
+}
+
+func (s *MemoryStorage) PurgeDeleted(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return purgeDeleted(s.records, s.index), nil
+}
+
 func (s *MemoryStorage) Ping(_ context.Context) error {
 	return nil
 }
+
+// workspaceSet returns workspaces of the storage, caller must hold the lock
+func (s *MemoryStorage) workspaceSet() *workspaceSet {
+	if s.workspaces == nil {
+		s.workspaces = newWorkspaceSet()
+	}
+	return s.workspaces
+}
+
+func (s *MemoryStorage) CreateWorkspace(_ context.Context, w Workspace, ownerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workspaceSet().create(w, ownerID)
+	return nil
+}
+
+func (s *MemoryStorage) LoadWorkspacesForUser(_ context.Context, userID string) ([]Membership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaceSet().forUser(userID), nil
+}
+
+func (s *MemoryStorage) LoadMembers(_ context.Context, workspaceID string) ([]Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaceSet().members(workspaceID)
+}
+
+func (s *MemoryStorage) MemberRole(_ context.Context, workspaceID, userID string) (Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaceSet().role(workspaceID, userID)
+}
+
+func (s *MemoryStorage) SetMember(_ context.Context, m Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaceSet().setMember(m)
+}
+
+func (s *MemoryStorage) RemoveMember(_ context.Context, workspaceID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.workspaceSet().removeMember(workspaceID, userID)
+}
+
+func (s *MemoryStorage) LoadForWorkspace(_ context.Context, workspaceID string) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return recordsOfWorkspace(s.records, workspaceID), nil
+}
@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -149,7 +153,7 @@ func TestMemoryStorage_Store(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Len(t, records, 1)
 
-		err = store.Store(ctx, Record{"test2", "http://example.com/testme2", "testUser", false})
+		err = store.Store(ctx, Record{Short: "test2", Full: "http://example.com/testme2", UserID: "testUser"})
 		assert.NoError(t, err)
 
 		records, err = store.LoadForUser(ctx, "testUser")
@@ -159,9 +163,9 @@ func TestMemoryStorage_Store(t *testing.T) {
 
 	t.Run("not return other user's shorts", func(t *testing.T) {
 		store := &MemoryStorage{records: defaultRecords()}
-		err := store.Store(ctx, Record{"test2", "http://example.com/testme2", "testUser2", false})
+		err := store.Store(ctx, Record{Short: "test2", Full: "http://example.com/testme2", UserID: "testUser2"})
 		assert.NoError(t, err)
-		err = store.Store(ctx, Record{"test3", "http://example.com/testme3", "testUser2", false})
+		err = store.Store(ctx, Record{Short: "test3", Full: "http://example.com/testme3", UserID: "testUser2"})
 		assert.NoError(t, err)
 
 		records, err := store.LoadForUser(ctx, "testUser")
@@ -215,3 +219,334 @@ func TestNewMemoryStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryStorage_RegisterClick(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("counts clicks until limit is reached", func(t *testing.T) {
+		store := NewMemoryStorage(RecordMap{
+			"key1": {Short: "key1", Full: "http://example.com", UserID: "testUser", MaxClicks: 2},
+		})
+
+		r, err := store.RegisterClick(ctx, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), r.Clicks)
+
+		r, err = store.RegisterClick(ctx, "key1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), r.Clicks)
+
+		r, err = store.RegisterClick(ctx, "key1")
+		assert.ErrorIs(t, err, ErrClicksExhausted)
+		assert.Equal(t, int64(2), r.Clicks)
+	})
+
+	t.Run("not limited when max clicks is zero", func(t *testing.T) {
+		store := NewMemoryStorage(defaultRecords())
+		for i := 0; i < 10; i++ {
+			_, err := store.RegisterClick(ctx, "test")
+			require.NoError(t, err)
+		}
+		r, err := store.Load(ctx, "test")
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), r.Clicks)
+	})
+
+	t.Run("concurrent clicks not overshoot limit", func(t *testing.T) {
+		store := NewMemoryStorage(RecordMap{
+			"key1": {Short: "key1", Full: "http://example.com", UserID: "testUser", MaxClicks: 5},
+		})
+
+		var succeeded int64
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.RegisterClick(ctx, "key1"); err == nil {
+					atomic.AddInt64(&succeeded, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(5), succeeded)
+	})
+
+	t.Run("returns error on not found", func(t *testing.T) {
+		store := NewMemoryStorage(nil)
+		_, err := store.RegisterClick(ctx, "key1")
+		var e *RecordNotFoundError
+		assert.ErrorAs(t, err, &e)
+	})
+}
+
+func TestMemoryStorage_Update(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage(RecordMap{
+		"key1": {Short: "key1", Full: "http://example.com", UserID: "testUser", Clicks: 3},
+	})
+
+	err := store.Update(ctx, Record{Short: "key1", Full: "http://other.com", RedirectStatus: 301, Passthrough: PassthroughMerge})
+	require.NoError(t, err)
+
+	r, err := store.Load(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, 301, r.RedirectStatus)
+	assert.Equal(t, PassthroughMerge, r.Passthrough)
+	assert.Equal(t, "http://example.com", r.Full, "only settings are updated")
+	assert.Equal(t, "testUser", r.UserID, "only settings are updated")
+	assert.Equal(t, int64(3), r.Clicks, "only settings are updated")
+
+	err = store.Update(ctx, Record{Short: "key2"})
+	var e *RecordNotFoundError
+	assert.ErrorAs(t, err, &e)
+}
+
+func TestMemoryStorage_CanonicalConflict(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage(RecordMap{
+		"key1": {Short: "key1", Full: "HTTP://Example.com:80", Canonical: "http://example.com/", UserID: "testUser"},
+	})
+
+	err := store.Store(ctx, Record{Short: "key2", Full: "http://example.com", Canonical: "http://example.com/"})
+	var conflict *RecordConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "key1", conflict.OldRecord.Short)
+
+	err = store.StoreBatch(ctx, []Record{
+		{Short: "key3", Full: "http://other.com", Canonical: "http://other.com/"},
+		{Short: "key4", Full: "http://example.com/", Canonical: "http://example.com/"},
+		{Short: "key5", Full: "http://other.com/", Canonical: "http://other.com/"},
+	})
+	var batchConflict *BatchConflictError
+	require.ErrorAs(t, err, &batchConflict)
+	assert.Equal(t, map[string]Record{
+		"key4": store.records["key1"],
+		"key5": store.records["key3"],
+	}, batchConflict.Conflicts)
+	_, err = store.Load(ctx, "key3")
+	assert.NoError(t, err, "fresh records of the batch are stored")
+	_, err = store.Load(ctx, "key4")
+	assert.Error(t, err)
+
+	err = store.StoreBatch(ctx, []Record{
+		{Short: "key3", Full: "http://taken.com", Canonical: "http://taken.com/"},
+	})
+	require.ErrorAs(t, err, &batchConflict)
+	assert.Equal(t, []string{"key3"}, batchConflict.Taken)
+	assert.ErrorIs(t, store.Store(ctx, Record{Short: "key3", Full: "http://taken.com"}), ErrShortTaken)
+
+	require.NoError(t, store.Delete(ctx, "key1"))
+	assert.NoError(t, store.Store(ctx, Record{Short: "key2", Full: "http://example.com", Canonical: "http://example.com/"}))
+}
+
+func TestMemoryStorage_DedupScope(t *testing.T) {
+	ctx := context.Background()
+	records := func() RecordMap {
+		return RecordMap{
+			"key1": {Short: "key1", Full: "http://example.com/", UserID: "userA"},
+		}
+	}
+	tests := []struct {
+		name      string
+		scope     DedupScope
+		otherUser bool
+		sameUser  bool
+	}{
+		{name: "global scope conflicts across users", scope: DedupGlobal, otherUser: true, sameUser: true},
+		{name: "user scope conflicts only for the same user", scope: DedupUser, otherUser: false, sameUser: true},
+		{name: "none scope never conflicts", scope: DedupNone, otherUser: false, sameUser: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStorage(records())
+			store.SetDedupScope(tt.scope)
+
+			var conflict *RecordConflictError
+			err := store.Store(ctx, Record{Short: "key2", Full: "http://example.com/", UserID: "userB"})
+			if assert.Equal(t, tt.otherUser, errors.As(err, &conflict), "other user") && tt.otherUser {
+				assert.Equal(t, tt.scope, conflict.Scope)
+				assert.Equal(t, "key1", conflict.OldRecord.Short)
+			}
+
+			err = store.Store(ctx, Record{Short: "key3", Full: "http://example.com/", UserID: "userA"})
+			if assert.Equal(t, tt.sameUser, errors.As(err, &conflict), "same user") && tt.sameUser {
+				assert.Equal(t, tt.scope, conflict.Scope)
+			}
+		})
+	}
+}
+
+func TestParseDedupScope(t *testing.T) {
+	scope, err := ParseDedupScope("")
+	require.NoError(t, err)
+	assert.Equal(t, DedupGlobal, scope)
+
+	scope, err = ParseDedupScope("user")
+	require.NoError(t, err)
+	assert.Equal(t, DedupUser, scope)
+
+	_, err = ParseDedupScope("domain")
+	assert.Error(t, err)
+}
+
+func TestMemoryStorage_IterateForUser(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStorage(RecordMap{
+		"key1": {Short: "key1", Full: "http://example.com/1", UserID: "testUser", CreatedAt: now.Add(time.Minute)},
+		"key2": {Short: "key2", Full: "http://example.com/2", UserID: "testUser", CreatedAt: now, Deleted: true},
+		"key3": {Short: "key3", Full: "http://example.com/3", UserID: "otherUser", CreatedAt: now},
+	})
+
+	it, err := store.IterateForUser(context.Background(), "testUser")
+	require.NoError(t, err)
+	defer it.Close()
+
+	var shorts []string
+	for it.Next() {
+		shorts = append(shorts, it.Record().Short)
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []string{"key2", "key1"}, shorts)
+}
+
+func TestMemoryStorage_Admin(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage(RecordMap{
+		"key1": {Short: "key1", Full: "http://example.com/1", UserID: "userA", Deleted: true, Clicks: 2},
+		"key2": {Short: "key2", Full: "http://example.com/2", UserID: "userB", Clicks: 3},
+		"key3": {Short: "key3", Full: "http://example.com/1", UserID: "userB"},
+	})
+	store.SetDedupScope(DedupUser)
+
+	require.NoError(t, store.Restore(ctx, "key1"))
+	r, err := store.Load(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, r.Deleted)
+
+	require.NoError(t, store.SetDisabled(ctx, "key2", true))
+	r, err = store.RegisterClick(ctx, "key2")
+	require.NoError(t, err)
+	assert.True(t, r.Disabled)
+	assert.Equal(t, int64(3), r.Clicks, "disabled link is not counted")
+
+	var conflict *RecordConflictError
+	require.ErrorAs(t, store.Reassign(ctx, "key1", "userB"), &conflict, "userB has the same url")
+	assert.Equal(t, "key3", conflict.OldRecord.Short)
+	require.NoError(t, store.Reassign(ctx, "key2", "userA"))
+	r, err = store.Load(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "userA", r.UserID)
+
+	var notFound *RecordNotFoundError
+	assert.ErrorAs(t, store.Restore(ctx, "missing"), &notFound)
+	assert.ErrorAs(t, store.SetDisabled(ctx, "missing", true), &notFound)
+	assert.ErrorAs(t, store.Reassign(ctx, "missing", "userA"), &notFound)
+
+	stats, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Records: 3, Deleted: 0, Disabled: 1, Users: 2, Clicks: 5}, stats)
+}
+
+func TestMemoryStorage_PurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage(RecordMap{
+		"key1": {Short: "key1", Full: "http://example.com/1", UserID: "userA", Deleted: true},
+		"key2": {Short: "key2", Full: "http://example.com/2", UserID: "userA"},
+	})
+
+	purged, err := store.PurgeDeleted(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	var notFound *RecordNotFoundError
+	_, err = store.Load(ctx, "key1")
+	assert.ErrorAs(t, err, &notFound)
+	_, err = store.Load(ctx, "key2")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Store(ctx, Record{Short: "key3", Full: "http://example.com/1", UserID: "userA"}),
+		"url of the purged record can be shortened again")
+}
+
+func TestMemoryStorage_Domains(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage(nil)
+
+	require.NoError(t, store.Store(ctx, Record{Short: "promo", Full: "http://example.com/1", UserID: "userA"}))
+	require.NoError(t, store.Store(ctx, Record{Short: "promo", Full: "http://example.com/2", UserID: "userA", Domain: "go.example.com"}),
+		"shorts of different domains don't collide")
+	require.NoError(t, store.Store(ctx, Record{Short: "other", Full: "http://example.com/1", UserID: "userA", Domain: "go.example.com"}),
+		"the same url is shortened once per domain")
+	assert.ErrorIs(t, store.Store(ctx, Record{Short: "promo", Full: "http://example.com/3", UserID: "userA", Domain: "go.example.com"}), ErrShortTaken)
+
+	r, err := store.Load(ctx, "promo")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/1", r.Full)
+	r, err = store.RegisterClick(ctx, Key("go.example.com", "promo"))
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/2", r.Full)
+	assert.Equal(t, int64(1), r.Clicks)
+
+	it, err := store.IterateAll(ctx, "promo")
+	require.NoError(t, err)
+	defer it.Close()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Record().Key())
+	}
+	assert.Equal(t, []string{"go.example.com/other", "go.example.com/promo"}, keys)
+}
+
+func TestSplitKey(t *testing.T) {
+	for _, key := range []string{"promo", "go.example.com/promo", "localhost:8080/promo"} {
+		domain, short := SplitKey(key)
+		assert.Equal(t, key, Key(domain, short))
+		assert.Equal(t, "promo", short)
+	}
+}
+
+func TestMemoryStorage_Workspaces(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage(nil)
+
+	w, err := NewWorkspace("team")
+	require.NoError(t, err)
+	require.NoError(t, store.CreateWorkspace(ctx, w, "owner"))
+	require.NoError(t, store.SetMember(ctx, Member{WorkspaceID: w.ID, UserID: "viewer", Role: RoleViewer}))
+	assert.ErrorIs(t, store.SetMember(ctx, Member{WorkspaceID: "missing", UserID: "viewer", Role: RoleViewer}), ErrWorkspaceNotFound)
+
+	role, err := store.MemberRole(ctx, w.ID, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, RoleAdmin, role, "creator of the workspace is its admin")
+	role, err = store.MemberRole(ctx, w.ID, "stranger")
+	require.NoError(t, err)
+	assert.Empty(t, role)
+
+	members, err := store.LoadMembers(ctx, w.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []Member{{w.ID, "owner", RoleAdmin}, {w.ID, "viewer", RoleViewer}}, members)
+	memberships, err := store.LoadWorkspacesForUser(ctx, "viewer")
+	require.NoError(t, err)
+	assert.Equal(t, []Membership{{Workspace: w, Role: RoleViewer}}, memberships)
+
+	require.NoError(t, store.Store(ctx, Record{Short: "shared", Full: "http://example.com/1", UserID: "owner", WorkspaceID: w.ID}))
+	require.NoError(t, store.Store(ctx, Record{Short: "personal", Full: "http://example.com/2", UserID: "owner"}))
+	records, err := store.LoadForWorkspace(ctx, w.ID)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "shared", records[0].Short)
+
+	require.NoError(t, store.RemoveMember(ctx, w.ID, "viewer"))
+	var notFound *RecordNotFoundError
+	assert.ErrorAs(t, store.RemoveMember(ctx, w.ID, "viewer"), &notFound)
+}
+
+func TestRole_Allows(t *testing.T) {
+	assert.True(t, RoleAdmin.Allows(RoleEditor))
+	assert.True(t, RoleEditor.Allows(RoleEditor))
+	assert.False(t, RoleViewer.Allows(RoleEditor))
+	assert.False(t, Role("").Allows(RoleViewer))
+
+	_, err := ParseRole("owner")
+	assert.Error(t, err)
+}
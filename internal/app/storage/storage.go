@@ -2,8 +2,13 @@ package storage
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/putalexey/go-practicum/internal/app/urlnormalizer"
+	"github.com/putalexey/go-practicum/internal/app/utm"
 )
 
 type Record struct {
@@ -11,6 +16,110 @@ type Record struct {
 	Full    string `json:"full"`
 	UserID  string `json:"user_id"`
 	Deleted bool
+	// Disabled records are kept, but don't redirect. Links are disabled by operators
+	Disabled bool `json:"disabled,omitempty"`
+	// Canonical is normalized full url, used to detect conflicts. Full url is used, when empty, so records
+	// stored before normalization conflict only with exactly the same urls
+	Canonical string `json:"canonical,omitempty"`
+	// MaxClicks limits number of redirects by the short, 0 - unlimited
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// Clicks is number of redirects made by the short
+	Clicks int64 `json:"clicks,omitempty"`
+	// Interstitial shows "you are leaving" page before redirect
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectStatus is http status used for redirect, 0 - default (307)
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// Passthrough defines how query of the short url is passed to the full url
+	Passthrough Passthrough `json:"passthrough,omitempty"`
+	// BaseURL is full url without UTM tags, set when url was built from tags
+	BaseURL   string    `json:"base_url,omitempty"`
+	UTM       utm.Tags  `json:"utm"`
+	CreatedAt time.Time `json:"created_at"`
+	// Domain is short domain of the record, empty for the domain of the base url. Shorts are unique per domain
+	Domain string `json:"domain,omitempty"`
+	// WorkspaceID is workspace sharing the record, empty for personal records of the user
+	WorkspaceID string `json:"workspace_id,omitempty"`
+}
+
+// Key returns key of the record in the storage, see Key
+func (r Record) Key() string {
+	return Key(r.Domain, r.Short)
+}
+
+// Key returns key of the short in the storage: the short itself for the domain of the base url
+// and "domain/short" for other domains
+func Key(domain, short string) string {
+	if domain == "" {
+		return short
+	}
+	return domain + "/" + short
+}
+
+// SplitKey returns domain and short of the key
+func SplitKey(key string) (domain, short string) {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// Passthrough is mode of passing query params from the short url to the full url
+type Passthrough string
+
+const (
+	// PassthroughNone ignores query of the short url
+	PassthroughNone Passthrough = ""
+	// PassthroughMerge adds params missing in the full url, params of the full url take precedence
+	PassthroughMerge Passthrough = "merge"
+	// PassthroughOverride adds params to the full url, params of the short url take precedence
+	PassthroughOverride Passthrough = "override"
+)
+
+// applySettings copies user editable settings from src record to dst
+func applySettings(dst *Record, src Record) {
+	dst.MaxClicks = src.MaxClicks
+	dst.Interstitial = src.Interstitial
+	dst.RedirectStatus = src.RedirectStatus
+	dst.Passthrough = src.Passthrough
+}
+
+// CanonicalURL returns url used to detect conflicting records
+func (r Record) CanonicalURL() string {
+	if r.Canonical == "" {
+		return r.Full
+	}
+	return r.Canonical
+}
+
+// Canonicalize returns canonical form of the full url of the record. UTM tags of the record are kept in the
+// canonical form, even if the normalizer strips tracking params, so links of different campaigns don't conflict
+func (r Record) Canonicalize(normalizer urlnormalizer.Canonicalizer) (string, error) {
+	if r.UTM.IsEmpty() {
+		return normalizer.Canonical(r.Full)
+	}
+	canonical, err := normalizer.Canonical(r.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	return withQuery(canonical, r.UTM.Query()), nil
+}
+
+// withQuery appends query params to the url before its fragment
+func withQuery(rawURL, query string) string {
+	fragment := ""
+	if i := strings.IndexByte(rawURL, '#'); i >= 0 {
+		rawURL, fragment = rawURL[:i], rawURL[i:]
+	}
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + query + fragment
+}
+
+// Exhausted reports whether record has reached its clicks limit
+func (r Record) Exhausted() bool {
+	return r.MaxClicks > 0 && r.Clicks >= r.MaxClicks
 }
 
 func NewRecord(full, userID string) (Record, error) {
@@ -20,22 +129,112 @@ func NewRecord(full, userID string) (Record, error) {
 	}
 
 	r := Record{
-		Short:  recordID.String(),
-		Full:   full,
-		UserID: userID,
+		Short:     recordID.String(),
+		Full:      full,
+		UserID:    userID,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
 	}
 	return r, nil
 }
 
 type RecordMap map[string]Record
 
+// Storager keeps records. Methods taking short accept key of the record, see Key
 type Storager interface {
 	Store(ctx context.Context, r Record) error
+	// StoreBatch saves records, which don't conflict with already stored ones.
+	// Returns BatchConflictError with conflicting records, other records are stored in that case
 	StoreBatch(ctx context.Context, records []Record) error
+	// Update saves editable settings of the record: max clicks, interstitial, redirect status and passthrough
+	Update(ctx context.Context, r Record) error
 	Load(ctx context.Context, short string) (Record, error)
 	LoadBatch(ctx context.Context, shorts []string) ([]Record, error)
 	LoadForUser(ctx context.Context, userID string) ([]Record, error)
+	// IterateForUser returns iterator over all records of the user including deleted ones, ordered by creation time
+	IterateForUser(ctx context.Context, userID string) (RecordIterator, error)
+	// IterateAll returns iterator over all records after the key, ordered by domain and short.
+	// Empty after starts from the first record
+	IterateAll(ctx context.Context, after string) (RecordIterator, error)
 	Delete(ctx context.Context, short string) error
 	DeleteBatch(ctx context.Context, shorts []string) error
+	// Restore reverts deletion of the record
+	Restore(ctx context.Context, short string) error
+	// SetDisabled disables or enables redirects by the short
+	SetDisabled(ctx context.Context, short string, disabled bool) error
+	// Reassign changes owner of the record. Returns RecordConflictError, if the new owner has the same url
+	// in the user dedup scope
+	Reassign(ctx context.Context, short, userID string) error
+	// RegisterClick atomically counts a redirect by the short and returns updated record.
+	// Returns ErrClicksExhausted with the record, if the record reached its clicks limit.
+	// Deleted and disabled records are returned as is, without counting.
+	RegisterClick(ctx context.Context, short string) (Record, error)
+	// Stats returns aggregate numbers of the stored records
+	Stats(ctx context.Context) (Stats, error)
+	// PurgeDeleted removes deleted records permanently, returns number of removed records
+	PurgeDeleted(ctx context.Context) (int64, error)
 	Ping(ctx context.Context) error
+
+	// CreateWorkspace saves the workspace with the owner as its admin
+	CreateWorkspace(ctx context.Context, w Workspace, ownerID string) error
+	// LoadWorkspacesForUser returns workspaces, the user is member of, with user's roles
+	LoadWorkspacesForUser(ctx context.Context, userID string) ([]Membership, error)
+	// LoadMembers returns members of the workspace, ErrWorkspaceNotFound if it doesn't exist
+	LoadMembers(ctx context.Context, workspaceID string) ([]Member, error)
+	// MemberRole returns role of the user in the workspace, empty for users, who aren't members
+	MemberRole(ctx context.Context, workspaceID, userID string) (Role, error)
+	// SetMember adds member to the workspace or changes role of the member
+	SetMember(ctx context.Context, m Member) error
+	// RemoveMember removes user from the workspace, returns RecordNotFoundError, if user isn't member
+	RemoveMember(ctx context.Context, workspaceID, userID string) error
+	// LoadForWorkspace returns not deleted records of the workspace
+	LoadForWorkspace(ctx context.Context, workspaceID string) ([]Record, error)
+}
+
+// Stats are aggregate numbers of the stored records
+type Stats struct {
+	Records  int64 `json:"records"`
+	Deleted  int64 `json:"deleted"`
+	Disabled int64 `json:"disabled"`
+	Users    int64 `json:"users"`
+	Clicks   int64 `json:"clicks"`
+}
+
+// add counts the record in the stats, users are counted separately
+func (st *Stats) add(r Record) {
+	st.Records++
+	if r.Deleted {
+		st.Deleted++
+	}
+	if r.Disabled {
+		st.Disabled++
+	}
+	st.Clicks += r.Clicks
+}
+
+// recordsStats counts stats of the records in memory
+func recordsStats(records RecordMap) Stats {
+	st := Stats{}
+	users := make(map[string]bool)
+	for _, r := range records {
+		st.add(r)
+		users[r.UserID] = true
+	}
+	st.Users = int64(len(users))
+	return st
+}
+
+// purgeDeleted removes deleted records from memory and the index, if it's built
+func purgeDeleted(records RecordMap, index *dedupIndex) int64 {
+	var purged int64
+	for key, r := range records {
+		if !r.Deleted {
+			continue
+		}
+		delete(records, key)
+		if index != nil {
+			index.remove(r)
+		}
+		purged++
+	}
+	return purged
 }
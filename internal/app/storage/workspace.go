@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Role of the member in the workspace. Each role grants permissions of the previous ones
+type Role string
+
+const (
+	// RoleViewer lists links of the workspace and its members
+	RoleViewer Role = "viewer"
+	// RoleEditor creates, edits and deletes links of the workspace
+	RoleEditor Role = "editor"
+	// RoleAdmin manages members of the workspace
+	RoleAdmin Role = "admin"
+)
+
+var roleLevels = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// ParseRole returns role by its name
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, expected viewer, editor or admin", name)
+	}
+	return role, nil
+}
+
+// Allows reports whether the role grants permissions of the required role. Empty role allows nothing
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] > 0 && roleLevels[r] >= roleLevels[required]
+}
+
+// Workspace groups links shared by its members
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Member is user with role in the workspace
+type Member struct {
+	WorkspaceID string `json:"workspace_id"`
+	UserID      string `json:"user_id"`
+	Role        Role   `json:"role"`
+}
+
+// Membership is workspace of the user with the user's role in it
+type Membership struct {
+	Workspace
+	Role Role `json:"role"`
+}
+
+var ErrWorkspaceNotFound = errors.New("workspace not found")
+
+func NewWorkspace(name string) (Workspace, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return Workspace{}, err
+	}
+	return Workspace{ID: id.String(), Name: name, CreatedAt: time.Now().UTC().Truncate(time.Second)}, nil
+}
+
+// workspaceSet keeps workspaces and roles of their members, used by in-memory storages
+type workspaceSet struct {
+	Workspaces map[string]Workspace       `json:"workspaces"`
+	Members    map[string]map[string]Role `json:"members"`
+}
+
+func newWorkspaceSet() *workspaceSet {
+	return &workspaceSet{
+		Workspaces: make(map[string]Workspace),
+		Members:    make(map[string]map[string]Role),
+	}
+}
+
+func (ws *workspaceSet) create(w Workspace, ownerID string) {
+	ws.Workspaces[w.ID] = w
+	ws.Members[w.ID] = map[string]Role{ownerID: RoleAdmin}
+}
+
+func (ws *workspaceSet) setMember(m Member) error {
+	members, ok := ws.Members[m.WorkspaceID]
+	if !ok {
+		return ErrWorkspaceNotFound
+	}
+	members[m.UserID] = m.Role
+	return nil
+}
+
+func (ws *workspaceSet) removeMember(workspaceID, userID string) error {
+	members, ok := ws.Members[workspaceID]
+	if !ok {
+		return ErrWorkspaceNotFound
+	}
+	if _, ok = members[userID]; !ok {
+		return NewRecordNotFoundError(userID)
+	}
+	delete(members, userID)
+	return nil
+}
+
+// members returns members of the workspace ordered by user id
+func (ws *workspaceSet) members(workspaceID string) ([]Member, error) {
+	roles, ok := ws.Members[workspaceID]
+	if !ok {
+		return nil, ErrWorkspaceNotFound
+	}
+	members := make([]Member, 0, len(roles))
+	for userID, role := range roles {
+		members = append(members, Member{WorkspaceID: workspaceID, UserID: userID, Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+func (ws *workspaceSet) role(workspaceID, userID string) (Role, error) {
+	members, ok := ws.Members[workspaceID]
+	if !ok {
+		return "", ErrWorkspaceNotFound
+	}
+	return members[userID], nil
+}
+
+// forUser returns workspaces of the user ordered by creation time
+func (ws *workspaceSet) forUser(userID string) []Membership {
+	memberships := make([]Membership, 0)
+	for id, members := range ws.Members {
+		if role, ok := members[userID]; ok {
+			memberships = append(memberships, Membership{Workspace: ws.Workspaces[id], Role: role})
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		if memberships[i].CreatedAt.Equal(memberships[j].CreatedAt) {
+			return memberships[i].ID < memberships[j].ID
+		}
+		return memberships[i].CreatedAt.Before(memberships[j].CreatedAt)
+	})
+	return memberships
+}
+
+// recordsOfWorkspace returns not deleted records of the workspace
+func recordsOfWorkspace(records RecordMap, workspaceID string) []Record {
+	result := make([]Record, 0)
+	for _, r := range records {
+		if r.WorkspaceID == workspaceID && !r.Deleted {
+			result = append(result, r)
+		}
+	}
+	sortByCreation(result)
+	return result
+}
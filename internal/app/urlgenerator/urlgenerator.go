@@ -2,5 +2,6 @@ package urlgenerator
 
 type URLGenerator interface {
 	GenerateShort(fullURL string) string
-	GetURL(short string) string
+	// GetURL returns absolute url of the record by its storage key
+	GetURL(key string) string
 }
@@ -0,0 +1,171 @@
+// Package urlnormalizer builds canonical form of the urls, used to detect the same urls written differently
+package urlnormalizer
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts of the schemes, removed from the canonical url
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// trackingParams are query params which don't change the page, removed when StripTrackingParams is enabled
+var trackingParams = map[string]bool{
+	"fbclid":    true,
+	"gclid":     true,
+	"dclid":     true,
+	"msclkid":   true,
+	"yclid":     true,
+	"mc_cid":    true,
+	"mc_eid":    true,
+	"_ga":       true,
+	"_openstat": true,
+}
+
+// Canonicalizer converts urls to canonical form
+type Canonicalizer interface {
+	Canonical(rawURL string) (string, error)
+}
+
+// Normalizer converts urls to canonical form
+type Normalizer struct {
+	// StripTrackingParams removes utm_* and known click id params from the query
+	StripTrackingParams bool
+}
+
+// Canonical returns canonical form of the url: scheme and host are lowercased, host is converted to punycode,
+// default port is removed, empty path replaced with "/" and percent-encoding is normalized
+func (n Normalizer) Canonical(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		// not an absolute url, nothing to normalize except encoding
+		return normalizeEscapes(rawURL), nil
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); ip == nil {
+		host, err = idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("invalid host %s: %w", u.Hostname(), err)
+		}
+	} else if strings.Contains(host, ":") {
+		host = "[" + ip.String() + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host = host + ":" + port
+	}
+	u.Host = host
+
+	path := normalizeEscapes(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+
+	query := u.RawQuery
+	if n.StripTrackingParams {
+		query = stripTracking(query)
+	}
+	query = normalizeEscapes(query)
+
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteString("@")
+	}
+	b.WriteString(u.Host)
+	b.WriteString(path)
+	if query != "" {
+		b.WriteString("?")
+		b.WriteString(query)
+	}
+	if u.Fragment != "" {
+		b.WriteString("#")
+		b.WriteString(normalizeEscapes(u.EscapedFragment()))
+	}
+	return b.String(), nil
+}
+
+// stripTracking removes tracking params from the raw query, keeping order of other params
+func stripTracking(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		name := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name = param[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "utm_") || trackingParams[name] {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	return strings.Join(kept, "&")
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters and uppercases hex digits of other escapes
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether c is unreserved character by RFC 3986
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,50 @@
+package urlnormalizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizer_Canonical(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer Normalizer
+		url        string
+		want       string
+		wantErr    bool
+	}{
+		{name: "lowercases scheme and host", url: "HTTP://Example.COM/Path", want: "http://example.com/Path"},
+		{name: "adds root path", url: "http://example.com", want: "http://example.com/"},
+		{name: "removes default http port", url: "http://example.com:80/", want: "http://example.com/"},
+		{name: "removes default https port", url: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "keeps other ports", url: "http://example.com:8080/", want: "http://example.com:8080/"},
+		{name: "converts idn to punycode", url: "http://пример.рф/", want: "http://xn--e1afmkfd.xn--p1ai/"},
+		{name: "decodes unreserved escapes", url: "http://example.com/%7Euser/%61bc", want: "http://example.com/~user/abc"},
+		{name: "uppercases escapes", url: "http://example.com/a%2fb?q=%3d", want: "http://example.com/a%2Fb?q=%3D"},
+		{name: "normalizes ipv6 host", url: "http://[2001:DB8::0001]:80/", want: "http://[2001:db8::1]/"},
+		{name: "keeps tracking params by default", url: "http://example.com/?utm_source=x&a=1", want: "http://example.com/?utm_source=x&a=1"},
+		{
+			name:       "strips tracking params",
+			normalizer: Normalizer{StripTrackingParams: true},
+			url:        "http://example.com/?utm_source=x&a=1&fbclid=abc&b=2",
+			want:       "http://example.com/?a=1&b=2",
+		},
+		{
+			name:       "strips empty query",
+			normalizer: Normalizer{StripTrackingParams: true},
+			url:        "http://example.com/?utm_source=x",
+			want:       "http://example.com/",
+		},
+		{name: "invalid url", url: "http://exa mple.com/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.normalizer.Canonical(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Canonical() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
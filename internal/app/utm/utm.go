@@ -0,0 +1,108 @@
+// Package utm builds campaign tagged urls from the base url and UTM tags
+package utm
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const maxTagLength = 255
+
+var ErrSourceRequired = errors.New("utm source is required")
+
+// Tags are UTM parameters of the campaign
+type Tags struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// IsEmpty reports whether no tag is set
+func (t Tags) IsEmpty() bool {
+	return t == Tags{}
+}
+
+// Normalize trims tags, source, medium and campaign are lowercased, so they are grouped consistently
+func (t Tags) Normalize() Tags {
+	return Tags{
+		Source:   strings.ToLower(strings.TrimSpace(t.Source)),
+		Medium:   strings.ToLower(strings.TrimSpace(t.Medium)),
+		Campaign: strings.ToLower(strings.TrimSpace(t.Campaign)),
+		Term:     strings.TrimSpace(t.Term),
+		Content:  strings.TrimSpace(t.Content),
+	}
+}
+
+// Validate checks tags can be added to url
+func (t Tags) Validate() error {
+	if t.Source == "" {
+		return ErrSourceRequired
+	}
+	for name, value := range t.params() {
+		if len(value) > maxTagLength {
+			return fmt.Errorf("%s is longer than %d characters", name, maxTagLength)
+		}
+	}
+	return nil
+}
+
+// Query returns set tags as url query, params are ordered by name
+func (t Tags) Query() string {
+	query := url.Values{}
+	for key, value := range t.params() {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	return query.Encode()
+}
+
+func (t Tags) params() map[string]string {
+	return map[string]string{
+		"utm_source":   t.Source,
+		"utm_medium":   t.Medium,
+		"utm_campaign": t.Campaign,
+		"utm_term":     t.Term,
+		"utm_content":  t.Content,
+	}
+}
+
+// Build normalizes tags and adds them to the base url. UTM params, already present in base, are replaced.
+// Returns tagged url, base url without UTM params and normalized tags
+func Build(base string, tags Tags) (tagged string, untagged string, normalized Tags, err error) {
+	normalized = tags.Normalize()
+	if err = normalized.Validate(); err != nil {
+		return "", "", Tags{}, err
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", "", Tags{}, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", "", Tags{}, fmt.Errorf("url must be absolute: %s", base)
+	}
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	untagged = u.String()
+
+	for key, value := range normalized.params() {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	tagged = u.String()
+
+	return tagged, untagged, normalized, nil
+}
@@ -0,0 +1,55 @@
+package utm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         string
+		tags         Tags
+		wantTagged   string
+		wantUntagged string
+		wantErr      bool
+	}{
+		{
+			name:         "adds tags to url",
+			base:         "http://example.com/page?id=1",
+			tags:         Tags{Source: " Newsletter ", Medium: "Email", Campaign: "Spring Sale"},
+			wantTagged:   "http://example.com/page?id=1&utm_campaign=spring+sale&utm_medium=email&utm_source=newsletter",
+			wantUntagged: "http://example.com/page?id=1",
+		},
+		{
+			name:         "replaces tags present in url",
+			base:         "http://example.com/?utm_source=old&utm_term=old",
+			tags:         Tags{Source: "new"},
+			wantTagged:   "http://example.com/?utm_source=new",
+			wantUntagged: "http://example.com/",
+		},
+		{
+			name:    "source is required",
+			base:    "http://example.com/",
+			tags:    Tags{Campaign: "sale"},
+			wantErr: true,
+		},
+		{
+			name:    "relative url fails",
+			base:    "/page",
+			tags:    Tags{Source: "newsletter"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tagged, untagged, _, err := Build(tt.base, tt.tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.wantTagged, tagged)
+			assert.Equal(t, tt.wantUntagged, untagged)
+		})
+	}
+}
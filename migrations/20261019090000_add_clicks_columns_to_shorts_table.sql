@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column max_clicks bigint NOT NULL DEFAULT 0;
+alter table shorts add column clicks bigint NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table shorts drop column clicks;
+alter table shorts drop column max_clicks;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column interstitial bool NOT NULL DEFAULT false;
+alter table shorts add column created_at timestamp with time zone NOT NULL DEFAULT now();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table shorts drop column created_at;
+alter table shorts drop column interstitial;
+-- +goose StatementEnd
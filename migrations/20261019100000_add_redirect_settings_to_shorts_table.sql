@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column redirect_status smallint NOT NULL DEFAULT 0;
+alter table shorts add column passthrough varchar(16) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table shorts drop column passthrough;
+alter table shorts drop column redirect_status;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column base_url varchar(2048) NOT NULL DEFAULT '';
+alter table shorts add column utm_source varchar(255) NOT NULL DEFAULT '';
+alter table shorts add column utm_medium varchar(255) NOT NULL DEFAULT '';
+alter table shorts add column utm_campaign varchar(255) NOT NULL DEFAULT '';
+alter table shorts add column utm_term varchar(255) NOT NULL DEFAULT '';
+alter table shorts add column utm_content varchar(255) NOT NULL DEFAULT '';
+create index if not exists shorts_user_id_utm_campaign_idx ON shorts (user_id, utm_campaign);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists shorts_user_id_utm_campaign_idx;
+alter table shorts drop column utm_content;
+alter table shorts drop column utm_term;
+alter table shorts drop column utm_campaign;
+alter table shorts drop column utm_medium;
+alter table shorts drop column utm_source;
+alter table shorts drop column base_url;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- Canonical urls of existing rows are normalized by Go migration 20261019140000_backfill_canonical_urls,
+-- registered by the storage package.
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column canonical varchar(2048);
+update shorts set canonical = original;
+alter table shorts alter column canonical set NOT NULL;
+drop index if exists shorts_original_idx;
+create unique index shorts_canonical_idx ON shorts (canonical);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists shorts_canonical_idx;
+create unique index shorts_original_idx ON shorts (original);
+alter table shorts drop column canonical;
+-- +goose StatementEnd
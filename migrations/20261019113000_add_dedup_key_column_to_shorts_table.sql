@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column dedup_key varchar(2100);
+update shorts set dedup_key = canonical;
+drop index if exists shorts_canonical_idx;
+create unique index shorts_dedup_key_idx ON shorts (dedup_key);
+create index shorts_canonical_idx ON shorts (canonical);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists shorts_canonical_idx;
+drop index if exists shorts_dedup_key_idx;
+create unique index shorts_canonical_idx ON shorts (canonical);
+alter table shorts drop column dedup_key;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column disabled boolean NOT NULL default FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table shorts drop column disabled;
+-- +goose StatementEnd
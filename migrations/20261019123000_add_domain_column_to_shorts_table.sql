@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shorts add column domain varchar(255) NOT NULL DEFAULT '';
+alter table shorts drop constraint shorts_pkey;
+alter table shorts add primary key (domain, short);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+delete from shorts where domain <> '';
+alter table shorts drop constraint shorts_pkey;
+alter table shorts add primary key (short);
+alter table shorts drop column domain;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists workspaces (
+  id varchar(36) primary key,
+  name varchar(255) NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+create table if not exists workspace_members (
+  workspace_id varchar(36) NOT NULL references workspaces (id) on delete cascade,
+  user_id varchar(255) NOT NULL,
+  role varchar(16) NOT NULL,
+  primary key (workspace_id, user_id)
+);
+create index if not exists workspace_members_user_id_idx ON workspace_members (user_id);
+alter table shorts add column workspace_id varchar(36) NOT NULL DEFAULT '';
+create index if not exists shorts_workspace_id_idx ON shorts (workspace_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists shorts_workspace_id_idx;
+alter table shorts drop column workspace_id;
+drop table if exists workspace_members;
+drop table if exists workspaces;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists storage_settings (
+  name varchar(64) primary key,
+  value varchar(255) NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists storage_settings;
+-- +goose StatementEnd
@@ -0,0 +1,369 @@
+// Package client is Go client of the shortener HTTP API.
+//
+// Users are identified by the auth cookie, which server sets on the first request. Client keeps it in the cookie jar,
+// so all requests of the client are made by the same user. Cookie can be saved with AuthCookie and passed
+// to WithAuthCookie to act as the same user later.
+//
+//	c, err := client.New("http://localhost:8080", client.WithGzip(true), client.WithRetries(3, 100*time.Millisecond))
+//	short, err := c.Shorten(ctx, client.ShortenRequest{URL: "https://example.com"})
+//	var conflict *client.ConflictError
+//	if errors.As(err, &conflict) {
+//		// url was shortened earlier, conflict.ShortURL is the old short url
+//	}
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthCookieName is name of the cookie identifying the user
+const AuthCookieName = "auth"
+
+// maxErrorSize limits the body read from the error response
+const maxErrorSize = 64 * 1024
+
+// Client of the shortener
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	noRedirect *http.Client
+	authCookie string
+	apiKey     string
+	apiHeader  string
+	gzip       bool
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// Option configures the client
+type Option func(c *Client)
+
+// WithHTTPClient sets http client used for the requests. Client must have cookie jar to keep the auth cookie
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAuthCookie sets auth cookie of the user, saved earlier with AuthCookie
+func WithAuthCookie(value string) Option {
+	return func(c *Client) {
+		c.authCookie = value
+	}
+}
+
+// WithAPIKey sends key in the header with every request, e.g. to the gateway in front of the shortener
+func WithAPIKey(header, key string) Option {
+	return func(c *Client) {
+		c.apiHeader = header
+		c.apiKey = key
+	}
+}
+
+// WithGzip compresses request bodies and asks server to compress responses
+func WithGzip(enabled bool) Option {
+	return func(c *Client) {
+		c.gzip = enabled
+	}
+}
+
+// WithRetries retries failed requests up to retries times, when server is unavailable or responds
+// with 429, 502, 503 or 504 status. Delay starts with backoff and doubles after each attempt
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithMaxBackoff limits delay between retries, 10 seconds by default
+func WithMaxBackoff(maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// New creates client of the shortener with base url, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme of the base url: %q", u.Scheme)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		backoff:    100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient = &http.Client{Jar: jar, Timeout: 30 * time.Second}
+	}
+	noRedirect := *c.httpClient
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	c.noRedirect = &noRedirect
+
+	if c.authCookie != "" {
+		if c.httpClient.Jar == nil {
+			return nil, errors.New("http client has no cookie jar for the auth cookie")
+		}
+		c.httpClient.Jar.SetCookies(c.baseURL, []*http.Cookie{{Name: AuthCookieName, Value: c.authCookie, Path: "/"}})
+	}
+	return c, nil
+}
+
+// AuthCookie returns auth cookie of the user, empty before the first request
+func (c *Client) AuthCookie() string {
+	if c.httpClient.Jar == nil {
+		return ""
+	}
+	for _, cookie := range c.httpClient.Jar.Cookies(c.baseURL) {
+		if cookie.Name == AuthCookieName {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// request to the shortener
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	contentType string
+	body        []byte
+	// stream is sent instead of body, such requests are not retried
+	stream     io.Reader
+	noRedirect bool
+}
+
+// do sends request, retrying it when server is unavailable. Body of the response is decompressed
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+
+	body := req.body
+	if c.gzip && len(body) > 0 {
+		var err error
+		if body, err = compress(body); err != nil {
+			return nil, err
+		}
+	}
+	httpClient := c.httpClient
+	if req.noRedirect {
+		httpClient = c.noRedirect
+	}
+
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if req.stream != nil {
+			reqBody = req.stream
+			if c.gzip {
+				reqBody = compressStream(req.stream)
+			}
+		} else if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), reqBody)
+		if err != nil {
+			return nil, err
+		}
+		c.setHeaders(httpReq, req)
+
+		resp, err := httpClient.Do(httpReq)
+		retry := attempt < c.retries && req.stream == nil && ctx.Err() == nil &&
+			(err != nil || retryableStatus(resp.StatusCode))
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			return decompress(resp)
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorSize))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(c.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) setHeaders(httpReq *http.Request, req request) {
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if c.gzip {
+		httpReq.Header.Set("Accept-Encoding", "gzip")
+		if httpReq.Body != nil {
+			httpReq.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set(c.apiHeader, c.apiKey)
+	}
+}
+
+// delay returns exponential delay before the retry with jitter, so clients don't retry at the same time
+func (c *Client) delay(attempt int) time.Duration {
+	d := c.backoff << attempt
+	if d > c.maxBackoff || d <= 0 {
+		d = c.maxBackoff
+	}
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+	return d/2 + time.Duration(c.rand.Int63n(int64(d/2)+1))
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressStream compresses reader while it is sent
+func compressStream(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// gzipBody closes both gzip reader and body of the response
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+func decompress(resp *http.Response) (*http.Response, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return resp, nil
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if errors.Is(err, io.EOF) {
+		// empty body, e.g. of 204 response
+		return resp, nil
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = gzipBody{Reader: gz, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	return resp, nil
+}
+
+// doJSON sends in as json body, if set, and decodes response of the expected status to out, if set
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out interface{}, expected ...int) (int, error) {
+	req := request{method: method, path: path}
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		req.body = data
+		req.contentType = "application/json"
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if !hasStatus(resp.StatusCode, expected) {
+		return resp.StatusCode, responseError(resp)
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("shortener: cannot decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func hasStatus(code int, expected []int) bool {
+	for _, e := range expected {
+		if code == e {
+			return true
+		}
+	}
+	return false
+}
+
+// responseError creates Error from the json or plain text response
+func responseError(resp *http.Response) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+	if err != nil {
+		return err
+	}
+	return newError(resp.StatusCode, data)
+}
+
+func newError(statusCode int, data []byte) *Error {
+	e := &Error{StatusCode: statusCode, Message: strings.TrimSpace(string(data))}
+	response := errorResponse{}
+	if json.Unmarshal(data, &response) == nil && response.Error != "" {
+		e.Message = response.Error
+	}
+	return e
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/putalexey/go-practicum/internal/app/shortener"
+	"github.com/putalexey/go-practicum/internal/app/storage"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	var handler http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	handler = shortener.NewRouter(context.Background(), srv.URL, storage.NewMemoryStorage(nil))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+
+	for _, gzip := range []bool{false, true} {
+		srv := newServer(t)
+		c, err := New(srv.URL, WithGzip(gzip))
+		require.NoError(t, err)
+
+		require.NoError(t, c.Ping(ctx))
+
+		created, err := c.Shorten(ctx, ShortenRequest{URL: "https://example.com/shorten", QR: true})
+		require.NoError(t, err)
+		assert.Contains(t, created.Result, srv.URL)
+		assert.Equal(t, created.Result+"/qr", created.QR)
+
+		_, err = c.Shorten(ctx, ShortenRequest{URL: "https://example.com/shorten"})
+		var conflict *ConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, created.Result, conflict.ShortURL)
+		assert.Equal(t, "global", conflict.DedupScope)
+
+		short, err := c.ShortenText(ctx, "https://example.com/shorten")
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, created.Result, short)
+
+		results, err := c.ShortenBatch(ctx, []BatchItem{
+			{CorrelationID: "1", OriginalURL: "https://example.com/batch"},
+			{CorrelationID: "2", OriginalURL: "https://example.com/shorten"},
+			{CorrelationID: "3", OriginalURL: "example"},
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		assert.NotEmpty(t, results[0].ShortURL)
+		assert.True(t, results[1].Conflict)
+		assert.NotEmpty(t, results[2].Error)
+
+		bulk := make([]BulkResult, 0)
+		err = c.ImportBulkItems(ctx, []BulkItem{{CorrelationID: "a", OriginalURL: "https://example.com/bulk"}}, func(r BulkResult) error {
+			bulk = append(bulk, r)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, bulk, 1)
+		assert.NotEmpty(t, bulk[0].ShortURL)
+
+		items, err := c.ListURLs(ctx)
+		require.NoError(t, err)
+		assert.Len(t, items, 3)
+
+		id := ShortID(created.Result)
+		resolution, err := c.Resolve(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, Resolution{StatusCode: http.StatusTemporaryRedirect, Location: "https://example.com/shorten"}, resolution)
+
+		maxClicks := int64(10)
+		info, err := c.Update(ctx, id, UpdateRequest{MaxClicks: &maxClicks})
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), info.MaxClicks)
+		assert.Equal(t, int64(1), info.Clicks)
+
+		image, contentType, err := c.QRCode(ctx, id, QROptions{Format: "svg"})
+		require.NoError(t, err)
+		assert.Equal(t, "image/svg+xml", contentType)
+		assert.NotEmpty(t, image)
+
+		export, err := c.Export(ctx, "csv")
+		require.NoError(t, err)
+		data, err := io.ReadAll(export)
+		require.NoError(t, err)
+		require.NoError(t, export.Close())
+		assert.Contains(t, string(data), "https://example.com/bulk")
+
+		// the same user with the saved cookie
+		same, err := New(srv.URL, WithAuthCookie(c.AuthCookie()))
+		require.NoError(t, err)
+		items, err = same.ListURLs(ctx)
+		require.NoError(t, err)
+		assert.Len(t, items, 3)
+
+		require.NoError(t, c.Delete(ctx, []string{id}))
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(newServer(t).URL)
+	require.NoError(t, err)
+
+	_, err = c.Resolve(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = c.Shorten(ctx, ShortenRequest{URL: "example"})
+	var e *Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, http.StatusBadRequest, e.StatusCode)
+	assert.NotEmpty(t, e.Message)
+
+	_, err = New("ftp://example.com")
+	assert.Error(t, err)
+}
+
+func TestClient_Retries(t *testing.T) {
+	ctx := context.Background()
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	t.Run("fails without retries", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		c, err := New(srv.URL)
+		require.NoError(t, err)
+		err = c.Ping(ctx)
+		var e *Error
+		require.ErrorAs(t, err, &e)
+		assert.Equal(t, http.StatusServiceUnavailable, e.StatusCode)
+		assert.Equal(t, "unavailable", e.Message)
+	})
+
+	t.Run("retries until success", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		c, err := New(srv.URL, WithRetries(3, time.Millisecond))
+		require.NoError(t, err)
+		require.NoError(t, c.Ping(ctx))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	})
+
+	t.Run("stops on context cancel", func(t *testing.T) {
+		atomic.StoreInt32(&attempts, 0)
+		c, err := New(srv.URL, WithRetries(3, time.Hour))
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.True(t, errors.Is(c.Ping(ctx), context.DeadlineExceeded))
+	})
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotFound is matched by errors of the requests to unknown short urls
+var ErrNotFound = errors.New("not found")
+
+// ErrGone is matched by errors of the requests to deleted, disabled or exhausted short urls
+var ErrGone = errors.New("gone")
+
+// Error is returned, when server responds with unexpected status
+type Error struct {
+	StatusCode int
+	// Message is the error field of the json response or the text of the plain response
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("shortener: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("shortener: %d %s", e.StatusCode, e.Message)
+}
+
+// Is makes errors.Is(err, ErrNotFound) and errors.Is(err, ErrGone) work by status code
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrGone:
+		return e.StatusCode == http.StatusGone
+	}
+	return false
+}
+
+// ConflictError is returned, when url was already shortened earlier, old short url is kept in the error
+type ConflictError struct {
+	ShortURL string
+	// DedupScope is "global", when url was shortened by any user, "user" - by the current user.
+	// Empty for plain text requests
+	DedupScope string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("shortener: url already shortened: %s", e.ShortURL)
+}
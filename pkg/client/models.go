@@ -0,0 +1,141 @@
+package client
+
+import "time"
+
+// UTM tags added to the shortened url, source is required
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Settings are optional settings of the short url
+type Settings struct {
+	// MaxClicks makes link self-destruct after number of redirects, 0 - unlimited
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// Interstitial shows "you are leaving" page before redirect
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectStatus is http status of redirect: 301, 302, 307 or 308. Default is 307
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// Passthrough passes query of the short url to the full url: "merge" or "override"
+	Passthrough string `json:"passthrough,omitempty"`
+}
+
+// ShortenRequest is url to shorten with its options
+type ShortenRequest struct {
+	URL string `json:"url"`
+	// QR requests link to the QR code image of the short url
+	QR  bool `json:"qr,omitempty"`
+	UTM *UTM `json:"utm,omitempty"`
+	Settings
+}
+
+// ShortenResponse is the created short url
+type ShortenResponse struct {
+	Result string `json:"result"`
+	QR     string `json:"qr,omitempty"`
+	// DedupScope is set on conflict
+	DedupScope string `json:"dedup_scope,omitempty"`
+}
+
+// BatchItem is url of the batch to shorten
+type BatchItem struct {
+	CorrelationID string `json:"correlation_id"`
+	OriginalURL   string `json:"original_url"`
+	UTM           *UTM   `json:"utm,omitempty"`
+	Settings
+}
+
+// BatchResult is result of the batch item
+type BatchResult struct {
+	CorrelationID string `json:"correlation_id"`
+	ShortURL      string `json:"short_url,omitempty"`
+	// Conflict is true, when url was added earlier, old short url is returned
+	Conflict bool `json:"conflict,omitempty"`
+	// Error describes why url of the item was not saved
+	Error string `json:"error,omitempty"`
+}
+
+// BulkItem is a line of the bulk import
+type BulkItem struct {
+	CorrelationID string `json:"correlation_id"`
+	OriginalURL   string `json:"original_url"`
+	// Alias is the short of the url, generated if empty
+	Alias string `json:"alias,omitempty"`
+}
+
+// BulkResult is result of the bulk import line
+type BulkResult struct {
+	// Line is number of the line in the import, 0 if error is not related to a line
+	Line          int    `json:"line"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Conflict      bool   `json:"conflict,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// URLItem is url shortened by the user
+type URLItem struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	// BaseURL is original url without UTM tags
+	BaseURL string `json:"base_url,omitempty"`
+	UTM     *UTM   `json:"utm,omitempty"`
+}
+
+// Campaign is list of urls tagged with the campaign
+type Campaign struct {
+	Campaign string    `json:"campaign"`
+	URLs     []URLItem `json:"urls"`
+}
+
+// ExportItem is a record of the user urls export in json or ndjson format
+type ExportItem struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	Deleted     bool      `json:"deleted"`
+	Clicks      int64     `json:"clicks"`
+}
+
+// UpdateRequest changes settings of the short url, only not nil fields are changed
+type UpdateRequest struct {
+	MaxClicks      *int64  `json:"max_clicks,omitempty"`
+	Interstitial   *bool   `json:"interstitial,omitempty"`
+	RedirectStatus *int    `json:"redirect_status,omitempty"`
+	Passthrough    *string `json:"passthrough,omitempty"`
+}
+
+// ShortInfo is short url with its settings
+type ShortInfo struct {
+	ShortURL       string `json:"short_url"`
+	OriginalURL    string `json:"original_url"`
+	MaxClicks      int64  `json:"max_clicks"`
+	Clicks         int64  `json:"clicks"`
+	Interstitial   bool   `json:"interstitial"`
+	RedirectStatus int    `json:"redirect_status"`
+	Passthrough    string `json:"passthrough"`
+}
+
+// Resolution is the response of the short url, redirects are not followed
+type Resolution struct {
+	StatusCode int
+	// Location is the full url, empty when server shows interstitial page instead of redirect
+	Location string
+}
+
+// QROptions of the QR code image, zero values use server defaults
+type QROptions struct {
+	// Format is "png" or "svg"
+	Format string
+	Size   int
+	Margin *int
+	// Level is error correction level: L, M, Q or H
+	Level string
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
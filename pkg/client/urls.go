@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ShortID returns id of the short url, e.g. "abc" for "http://localhost:8080/abc"
+func ShortID(shortURL string) string {
+	u, err := url.Parse(shortURL)
+	if err != nil {
+		return shortURL
+	}
+	return path.Base(u.Path)
+}
+
+// Ping checks the server and its storage
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/ping"})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// ShortenText shortens url with the plain text request. When url was shortened earlier,
+// old short url is returned with *ConflictError
+func (c *Client) ShortenText(ctx context.Context, fullURL string) (string, error) {
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/", contentType: "text/plain", body: []byte(fullURL)})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusConflict:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		short := strings.TrimSpace(string(data))
+		if resp.StatusCode == http.StatusConflict {
+			return short, &ConflictError{ShortURL: short}
+		}
+		return short, nil
+	default:
+		return "", responseError(resp)
+	}
+}
+
+// Shorten shortens url with its options. When url was shortened earlier,
+// response with old short url is returned with *ConflictError
+func (c *Client) Shorten(ctx context.Context, req ShortenRequest) (ShortenResponse, error) {
+	response := ShortenResponse{}
+	status, err := c.doJSON(ctx, http.MethodPost, "/api/shorten", req, &response, http.StatusCreated, http.StatusConflict)
+	if err != nil {
+		return response, err
+	}
+	if status == http.StatusConflict {
+		return response, &ConflictError{ShortURL: response.Result, DedupScope: response.DedupScope}
+	}
+	return response, nil
+}
+
+// ShortenBatch shortens batch of urls. Results of the items are returned without error,
+// even if some or all of the items conflict or have errors
+func (c *Client) ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	req := request{method: http.MethodPost, path: "/api/shorten/batch", contentType: "application/json"}
+	var err error
+	if req.body, err = json.Marshal(items); err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusMultiStatus, http.StatusConflict, http.StatusBadRequest:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]BatchResult, 0, len(items))
+		if json.Unmarshal(data, &results) == nil {
+			return results, nil
+		}
+		// request itself is wrong
+		return nil, newError(resp.StatusCode, data)
+	default:
+		return nil, responseError(resp)
+	}
+}
+
+// ImportBulk imports lines of body in NDJSON or CSV format, depending on contentType:
+// "application/x-ndjson" or "text/csv". fn is called for each result as it is streamed back,
+// error of fn stops reading the results. Import is not retried, because body can be read only once
+func (c *Client) ImportBulk(ctx context.Context, body io.Reader, contentType string, fn func(BulkResult) error) error {
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/api/shorten/bulk", contentType: contentType, stream: body})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		result := BulkResult{}
+		if err = json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return fmt.Errorf("shortener: cannot decode response: %w", err)
+		}
+		if err = fn(result); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ImportBulkItems imports items in NDJSON format, see ImportBulk
+func (c *Client) ImportBulkItems(ctx context.Context, items []BulkItem, fn func(BulkResult) error) error {
+	pr, pw := io.Pipe()
+	go func() {
+		encoder := json.NewEncoder(pw)
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	err := c.ImportBulk(ctx, pr, "application/x-ndjson", fn)
+	pr.Close()
+	return err
+}
+
+// ListURLs returns urls shortened by the user, empty if there are none
+func (c *Client) ListURLs(ctx context.Context) ([]URLItem, error) {
+	items := make([]URLItem, 0)
+	_, err := c.doJSON(ctx, http.MethodGet, "/api/user/urls", nil, &items, http.StatusOK, http.StatusNoContent)
+	return items, err
+}
+
+// ListCampaigns returns urls of the user with UTM tags grouped by campaign
+func (c *Client) ListCampaigns(ctx context.Context) ([]Campaign, error) {
+	campaigns := make([]Campaign, 0)
+	_, err := c.doJSON(ctx, http.MethodGet, "/api/user/campaigns", nil, &campaigns, http.StatusOK, http.StatusNoContent)
+	return campaigns, err
+}
+
+// Export returns export of all urls of the user, including deleted, in "json", "ndjson" or "csv" format.
+// Caller must close the export
+func (c *Client) Export(ctx context.Context, format string) (io.ReadCloser, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/api/user/urls/export", query: query})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// Delete queues deletion of the user's short urls by ids, urls are deleted eventually
+func (c *Client) Delete(ctx context.Context, ids []string) error {
+	_, err := c.doJSON(ctx, http.MethodDelete, "/api/user/urls", ids, nil, http.StatusAccepted)
+	return err
+}
+
+// Update changes settings of the user's short url by id
+func (c *Client) Update(ctx context.Context, id string, req UpdateRequest) (ShortInfo, error) {
+	info := ShortInfo{}
+	_, err := c.doJSON(ctx, http.MethodPatch, "/api/user/urls/"+url.PathEscape(id), req, &info, http.StatusOK)
+	return info, err
+}
+
+// Resolve returns where short url with the id leads, without following the redirect.
+// Resolving counts as a click of the short url
+func (c *Client) Resolve(ctx context.Context, id string) (Resolution, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/" + url.PathEscape(id), noRedirect: true})
+	if err != nil {
+		return Resolution{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return Resolution{StatusCode: resp.StatusCode, Location: resp.Header.Get("Location")}, nil
+	case resp.StatusCode == http.StatusOK:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return Resolution{StatusCode: resp.StatusCode}, nil
+	default:
+		return Resolution{}, responseError(resp)
+	}
+}
+
+// Preview returns html preview page of the short url with the id, without counting a click
+func (c *Client) Preview(ctx context.Context, id string) (string, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/" + url.PathEscape(id) + "+"})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// QRCode returns QR code image of the short url with the id and its content type
+func (c *Client) QRCode(ctx context.Context, id string, opts QROptions) ([]byte, string, error) {
+	query := url.Values{}
+	if opts.Format != "" {
+		query.Set("format", opts.Format)
+	}
+	if opts.Size > 0 {
+		query.Set("size", strconv.Itoa(opts.Size))
+	}
+	if opts.Margin != nil {
+		query.Set("margin", strconv.Itoa(*opts.Margin))
+	}
+	if opts.Level != "" {
+		query.Set("level", opts.Level)
+	}
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/" + url.PathEscape(id) + "/qr", query: query})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", responseError(resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}